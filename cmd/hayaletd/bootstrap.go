@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go-trade/internal/app"
+	"go-trade/internal/auth"
+	"go-trade/internal/config"
+	"go-trade/internal/model"
+
+	"golang.org/x/term"
+)
+
+// bootstrapAdmin creates the first ADMIN user in the dashboard user store.
+// It refuses to run once an enabled admin exists, so further users are
+// managed through the API, and while the daemon is running, since the
+// daemon's next save of users.json would drop the new admin.
+func bootstrapAdmin(cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("bootstrap-admin", flag.ExitOnError)
+	username := fs.String("username", "admin", "admin username")
+	password := fs.String("password", "", "admin password (default: $HAYALET_ADMIN_PASSWORD or prompt)")
+	locale := fs.String("locale", cfg.Dashboard.DefaultLocale, "dashboard locale (tr or en)")
+	fs.Parse(args)
+
+	release, err := app.LockDataDir(cfg.App.DataDir)
+	if errors.Is(err, app.ErrDaemonRunning) {
+		return errors.New("hayaletd is running; stop it first, then start it again after the admin is created")
+	}
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	users, err := auth.OpenUserStore(filepath.Join(cfg.App.DataDir, "users.json"))
+	if err != nil {
+		return err
+	}
+	if users.HasAdmin() {
+		return errors.New("an admin user already exists; manage users via the API")
+	}
+
+	pw := *password
+	if pw == "" {
+		pw = os.Getenv("HAYALET_ADMIN_PASSWORD")
+	}
+	if pw == "" {
+		if pw, err = readPassword(*username); err != nil {
+			return fmt.Errorf("reading password: %w", err)
+		}
+	}
+
+	user, err := users.Create(*username, pw, model.RoleAdmin, *locale)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("created admin %q (%s)\n", user.Username, user.ID)
+	return nil
+}
+
+// readPassword prompts for the password without echoing it. Piped input
+// is read as one line.
+func readPassword(username string) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return "", err
+		}
+		return strings.TrimRight(line, "\r\n"), nil
+	}
+	fmt.Fprintf(os.Stderr, "password for %s: ", username)
+	pw, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	return string(pw), err
+}
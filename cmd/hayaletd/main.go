@@ -12,6 +12,10 @@ import (
 
 func main() {
 	configPath := flag.String("config", "config/config.yaml", "path to configuration file")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s [-config path] [bootstrap-admin [-username name] [-password pw]]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
 	flag.Parse()
 
 	cfg, err := config.Load(*configPath)
@@ -20,6 +24,14 @@ func main() {
 		os.Exit(1)
 	}
 
+	if flag.Arg(0) == "bootstrap-admin" {
+		if err := bootstrapAdmin(cfg, flag.Args()[1:]); err != nil {
+			fmt.Fprintf(os.Stderr, "bootstrap-admin: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	a := app.New(cfg)
 	if err := a.Run(); err != nil {
 		fmt.Fprintf(os.Stderr, "fatal: %v\n", err)
@@ -4,11 +4,10 @@ go 1.25.6
 
 require (
 	go.uber.org/zap v1.27.1
+	golang.org/x/sys v0.41.0
+	golang.org/x/term v0.40.0
 	gopkg.in/natefinch/lumberjack.v2 v2.2.1
 	gopkg.in/yaml.v3 v3.0.1
 )
 
-require (
-	go.uber.org/multierr v1.10.0 // indirect
-	golang.org/x/sys v0.41.0 // indirect
-)
+require go.uber.org/multierr v1.10.0 // indirect
@@ -0,0 +1,109 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-trade/internal/audit"
+	"go-trade/internal/model"
+
+	"go.uber.org/zap"
+)
+
+// Audit query page sizes.
+const (
+	defaultAuditLimit = 200
+	maxAuditLimit     = 5000
+)
+
+// recordOperator appends an operator action by the calling user to the
+// audit log.
+func (s *Server) recordOperator(r *http.Request, action, reason string, detail map[string]string) {
+	if s.audit == nil {
+		return
+	}
+	p, _ := userFrom(r)
+	err := s.audit.Append(audit.Entry{
+		Kind:   audit.KindOperator,
+		Actor:  "api:" + p.Username,
+		Action: action,
+		Reason: reason,
+		Detail: detail,
+	})
+	if err != nil {
+		s.logger.Error("audit_write_failed", zap.String("action", action), zap.Error(err))
+	}
+}
+
+// handleAuditQuery returns audit entries, newest first. Query parameters:
+// from, to (RFC 3339), kind, actor, accountId, symbol, reason (substring)
+// and limit (default 200, max 5000).
+func (s *Server) handleAuditQuery(w http.ResponseWriter, r *http.Request) {
+	if s.audit == nil {
+		writeError(w, http.StatusServiceUnavailable, "AUDIT_DISABLED", "audit log is not available", nil)
+		return
+	}
+	q := r.URL.Query()
+	f := audit.Filter{
+		Kind:      strings.ToUpper(q.Get("kind")),
+		Actor:     q.Get("actor"),
+		AccountID: q.Get("accountId"),
+		Symbol:    strings.ToUpper(q.Get("symbol")),
+		Reason:    q.Get("reason"),
+		Limit:     defaultAuditLimit,
+	}
+	var errs []model.FieldError
+	for _, p := range []struct {
+		name string
+		dst  *time.Time
+	}{{"from", &f.From}, {"to", &f.To}} {
+		if v := q.Get(p.name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				errs = append(errs, model.FieldError{Field: p.name, Message: "must be an RFC 3339 time"})
+				continue
+			}
+			*p.dst = t
+		}
+	}
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			errs = append(errs, model.FieldError{Field: "limit", Message: "must be a positive integer"})
+		}
+		f.Limit = min(n, maxAuditLimit)
+	}
+	if len(errs) > 0 {
+		writeError(w, http.StatusBadRequest, "VALIDATION_FAILED", "invalid audit query", errs)
+		return
+	}
+
+	entries, err := s.audit.Query(f)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL", err.Error(), nil)
+		return
+	}
+	writeJSON(w, http.StatusOK, model.APIResponse{
+		Data:      entries,
+		Timestamp: time.Now(),
+	})
+}
+
+// handleAuditVerify checks the hash chain of the whole audit log.
+func (s *Server) handleAuditVerify(w http.ResponseWriter, r *http.Request) {
+	if s.audit == nil {
+		writeError(w, http.StatusServiceUnavailable, "AUDIT_DISABLED", "audit log is not available", nil)
+		return
+	}
+	res, err := s.audit.Verify()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL", err.Error(), nil)
+		return
+	}
+	writeJSON(w, http.StatusOK, model.APIResponse{
+		Data:      res,
+		Timestamp: time.Now(),
+	})
+}
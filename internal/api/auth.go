@@ -0,0 +1,264 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"go-trade/internal/auth"
+	"go-trade/internal/model"
+
+	"go.uber.org/zap"
+)
+
+// roleRank orders roles by privilege; a route requiring a role admits every
+// role of equal or higher rank.
+var roleRank = map[model.UserRole]int{
+	model.RoleViewer:   1,
+	model.RoleOperator: 2,
+	model.RoleAdmin:    3,
+}
+
+// resetAllowedPaths are the only routes a user with a pending forced
+// password reset may call.
+var resetAllowedPaths = map[string]bool{
+	"/api/auth/password": true,
+	"/api/auth/me":       true,
+	"/api/auth/logout":   true,
+}
+
+// userCtxKey is the request context key for the authenticated principal.
+type userCtxKey struct{}
+
+// principal is an authenticated user and the session its token belongs to.
+type principal struct {
+	auth.User
+	SessionID string
+}
+
+// loginRequest is the body of POST /api/auth/login.
+type loginRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// refreshRequest is the body of POST /api/auth/refresh.
+type refreshRequest struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+// loginResponse is returned by login and refresh.
+type loginResponse struct {
+	auth.TokenPair
+	User model.DashboardUser `json:"user"`
+}
+
+// requireRole wraps a handler so it only runs for an authenticated user
+// holding at least the given role.
+func (s *Server) requireRole(role model.UserRole, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, err := s.authenticate(r)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="hayalet"`)
+			writeJSON(w, http.StatusUnauthorized, model.APIResponse{
+				Error:     err.Error(),
+				Timestamp: time.Now(),
+			})
+			return
+		}
+		if !s.checkLimit(w, r, s.userLimit, "user:"+user.ID) {
+			return
+		}
+		if user.MustResetPass && !resetAllowedPaths[r.URL.Path] {
+			writeJSON(w, http.StatusForbidden, model.APIResponse{
+				Error:     "password reset required",
+				Timestamp: time.Now(),
+			})
+			return
+		}
+		if roleRank[user.Role] < roleRank[role] {
+			s.logger.Warn("api_forbidden",
+				zap.String("user", user.Username),
+				zap.String("role", string(user.Role)),
+				zap.String("path", r.URL.Path),
+			)
+			writeJSON(w, http.StatusForbidden, model.APIResponse{
+				Error:     "requires " + string(role) + " role",
+				Timestamp: time.Now(),
+			})
+			return
+		}
+		next(w, r.WithContext(context.WithValue(r.Context(), userCtxKey{}, user)))
+	}
+}
+
+// authenticate resolves the access token of a request to a live user. The
+// token is read from the Authorization header, or from the "token" query
+// parameter for WebSocket upgrades where browsers cannot set headers.
+func (s *Server) authenticate(r *http.Request) (principal, error) {
+	token, err := requestToken(r)
+	if err != nil {
+		return principal{}, err
+	}
+
+	now := time.Now()
+	claims, err := s.tokens.Parse(token, auth.TokenAccess, now)
+	if err != nil {
+		return principal{}, err
+	}
+	user, err := s.users.ValidateSession(claims.SessionID, now)
+	if err != nil {
+		return principal{}, err
+	}
+	return principal{User: user, SessionID: claims.SessionID}, nil
+}
+
+// requestToken extracts the access token used by authenticate.
+func requestToken(r *http.Request) (string, error) {
+	token := ""
+	if h := r.Header.Get("Authorization"); h != "" {
+		scheme, rest, ok := strings.Cut(h, " ")
+		if !ok || !strings.EqualFold(scheme, "Bearer") {
+			return "", errors.New("bearer token required")
+		}
+		token = strings.TrimSpace(rest)
+	} else if r.URL.Path == "/ws" {
+		token = r.URL.Query().Get("token")
+	}
+	if token == "" {
+		return "", errors.New("authentication required")
+	}
+	return token, nil
+}
+
+// userFrom returns the authenticated principal stored by requireRole.
+func userFrom(r *http.Request) (principal, bool) {
+	p, ok := r.Context().Value(userCtxKey{}).(principal)
+	return p, ok
+}
+
+// handleLogin exchanges credentials for an access/refresh token pair.
+func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
+	var req loginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, model.APIResponse{
+			Error:     "invalid JSON: " + err.Error(),
+			Timestamp: time.Now(),
+		})
+		return
+	}
+
+	user, err := s.users.Authenticate(req.Username, req.Password)
+	if err != nil {
+		s.logger.Warn("api_login_failed",
+			zap.String("username", req.Username),
+			zap.String("remote", r.RemoteAddr),
+			zap.Error(err),
+		)
+		writeJSON(w, http.StatusUnauthorized, model.APIResponse{
+			Error:     auth.ErrBadCredentials.Error(),
+			Timestamp: time.Now(),
+		})
+		return
+	}
+
+	now := time.Now()
+	sess, err := s.users.StartSession(user, r.RemoteAddr, s.tokens.RefreshTTL(), now)
+	if err != nil {
+		s.writeTokenError(w, err)
+		return
+	}
+	s.writeTokens(w, user, sess, now)
+	s.logger.Info("api_login", zap.String("username", user.Username), zap.String("session", sess.ID))
+}
+
+// handleRefresh rotates a refresh token and issues a new token pair.
+func (s *Server) handleRefresh(w http.ResponseWriter, r *http.Request) {
+	var req refreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, model.APIResponse{
+			Error:     "invalid JSON: " + err.Error(),
+			Timestamp: time.Now(),
+		})
+		return
+	}
+
+	now := time.Now()
+	claims, err := s.tokens.Parse(req.RefreshToken, auth.TokenRefresh, now)
+	if err != nil {
+		writeJSON(w, http.StatusUnauthorized, model.APIResponse{
+			Error:     err.Error(),
+			Timestamp: now,
+		})
+		return
+	}
+	sess, err := s.users.RotateSession(claims.SessionID, claims.Nonce, s.tokens.RefreshTTL(), now)
+	if err != nil {
+		if errors.Is(err, auth.ErrSessionInvalid) {
+			s.logger.Warn("api_refresh_rejected", zap.String("session", claims.SessionID))
+			writeJSON(w, http.StatusUnauthorized, model.APIResponse{
+				Error:     err.Error(),
+				Timestamp: now,
+			})
+			return
+		}
+		s.writeTokenError(w, err)
+		return
+	}
+	user, ok := s.users.Get(sess.UserID)
+	if !ok {
+		writeJSON(w, http.StatusUnauthorized, model.APIResponse{
+			Error:     auth.ErrSessionInvalid.Error(),
+			Timestamp: now,
+		})
+		return
+	}
+	s.writeTokens(w, user, sess, now)
+}
+
+// handleLogout revokes the caller's session.
+func (s *Server) handleLogout(w http.ResponseWriter, r *http.Request) {
+	p, _ := userFrom(r)
+	if err := s.users.EndSession(p.SessionID); err != nil {
+		s.logger.Warn("api_logout_failed", zap.Error(err))
+	}
+	s.hub.CloseEndedSessions()
+	writeJSON(w, http.StatusOK, model.APIResponse{
+		Data:      map[string]string{"status": "logged_out"},
+		Timestamp: time.Now(),
+	})
+}
+
+// handleMe returns the authenticated user.
+func (s *Server) handleMe(w http.ResponseWriter, r *http.Request) {
+	user, _ := userFrom(r)
+	writeJSON(w, http.StatusOK, model.APIResponse{
+		Data:      user.Info(),
+		Timestamp: time.Now(),
+	})
+}
+
+// writeTokens issues and writes a token pair for a session.
+func (s *Server) writeTokens(w http.ResponseWriter, user auth.User, sess auth.Session, now time.Time) {
+	pair, err := s.tokens.Issue(user, sess.ID, sess.Nonce, now)
+	if err != nil {
+		s.writeTokenError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, model.APIResponse{
+		Data:      loginResponse{TokenPair: pair, User: user.DashboardUser},
+		Timestamp: now,
+	})
+}
+
+// writeTokenError reports an internal failure while issuing tokens.
+func (s *Server) writeTokenError(w http.ResponseWriter, err error) {
+	s.logger.Error("api_token_issue_failed", zap.Error(err))
+	writeJSON(w, http.StatusInternalServerError, model.APIResponse{
+		Error:     "could not issue tokens",
+		Timestamp: time.Now(),
+	})
+}
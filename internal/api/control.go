@@ -0,0 +1,77 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"go-trade/internal/engine"
+	"go-trade/internal/model"
+)
+
+// controlActions maps /api/control/{action} onto command types.
+var controlActions = map[string]model.CommandType{
+	"pause":  model.CommandPause,
+	"resume": model.CommandResume,
+	"freeze": model.CommandFreeze,
+}
+
+// controlRequest is the body of POST /api/control/{action}. Empty fields
+// widen the scope; an empty body acts globally.
+type controlRequest struct {
+	AccountID string `json:"accountId"`
+	Symbol    string `json:"symbol"`
+	Strategy  string `json:"strategy"`
+	Reason    string `json:"reason"`
+}
+
+// validate normalises and checks the scope.
+func (req *controlRequest) validate() []model.FieldError {
+	var errs []model.FieldError
+	req.AccountID = strings.TrimSpace(req.AccountID)
+	req.Symbol = strings.ToUpper(strings.TrimSpace(req.Symbol))
+	req.Strategy = strings.ToLower(strings.TrimSpace(req.Strategy))
+	if req.Symbol != "" && !symbolPattern.MatchString(req.Symbol) {
+		errs = append(errs, model.FieldError{Field: "symbol", Message: "must be a broker symbol like EURUSD"})
+	}
+	if err := engine.ValidateScope(engine.Scope{Strategy: req.Strategy}); err != nil {
+		errs = append(errs, model.FieldError{Field: "strategy", Message: err.Error()})
+	}
+	if len(req.Reason) > 64 {
+		errs = append(errs, model.FieldError{Field: "reason", Message: "at most 64 characters"})
+	}
+	return errs
+}
+
+// handleControlList returns every active pause and freeze.
+func (s *Server) handleControlList(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, model.APIResponse{
+		Data:      s.engine.TradingStates(),
+		Timestamp: time.Now(),
+	})
+}
+
+// handleControlAction pauses, resumes or freezes trading at a scope.
+func (s *Server) handleControlAction(w http.ResponseWriter, r *http.Request) {
+	action := r.PathValue("action")
+	typ, ok := controlActions[action]
+	if !ok {
+		writeError(w, http.StatusNotFound, "UNKNOWN_ACTION", "action must be one of pause, resume, freeze", nil)
+		return
+	}
+	var req controlRequest
+	if r.ContentLength != 0 && !decodeStrict(w, r, &req) {
+		return
+	}
+	if errs := req.validate(); len(errs) > 0 {
+		writeError(w, http.StatusBadRequest, "VALIDATION_FAILED", "invalid scope", errs)
+		return
+	}
+	s.execute(w, r, model.Command{
+		Type:      typ,
+		AccountID: req.AccountID,
+		Symbol:    req.Symbol,
+		Strategy:  req.Strategy,
+		Reason:    reasonOr(req.Reason, "API_"+strings.ToUpper(action)),
+	})
+}
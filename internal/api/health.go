@@ -0,0 +1,24 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"go-trade/internal/model"
+)
+
+// handleReadyz reports whether the engine can trade, with the outcome of
+// each check. It answers 503 when any check fails so load balancers and
+// orchestrators stop routing to an instance that is up but not usable.
+func (s *Server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+	ready := s.engine.Readiness(now)
+	status := http.StatusOK
+	if !ready.Ready {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, model.APIResponse{
+		Data:      ready,
+		Timestamp: now,
+	})
+}
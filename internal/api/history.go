@@ -0,0 +1,156 @@
+package api
+
+import (
+	"encoding/csv"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-trade/internal/engine"
+	"go-trade/internal/model"
+)
+
+// Price history limits. The latest limit items of the range are returned.
+const (
+	defaultHistoryLimit = 1000
+	maxHistoryLimit     = 5000
+)
+
+// historyQuery is the time range, limit and format of a history request.
+type historyQuery struct {
+	from, to time.Time
+	limit    int
+	csv      bool
+}
+
+// parseHistoryQuery reads from, to (RFC 3339), limit and format (json or
+// csv; an Accept of text/csv also selects CSV).
+func parseHistoryQuery(r *http.Request, q url.Values) (historyQuery, []model.FieldError) {
+	hq := historyQuery{limit: defaultHistoryLimit}
+	var errs []model.FieldError
+	for _, p := range []struct {
+		name string
+		dst  *time.Time
+	}{{"from", &hq.from}, {"to", &hq.to}} {
+		if v := q.Get(p.name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				errs = append(errs, model.FieldError{Field: p.name, Message: "must be an RFC 3339 time"})
+				continue
+			}
+			*p.dst = t
+		}
+	}
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			errs = append(errs, model.FieldError{Field: "limit", Message: "must be a positive integer"})
+		}
+		hq.limit = min(n, maxHistoryLimit)
+	}
+	switch strings.ToLower(q.Get("format")) {
+	case "":
+		hq.csv = strings.Contains(r.Header.Get("Accept"), "text/csv")
+	case "json":
+	case "csv":
+		hq.csv = true
+	default:
+		errs = append(errs, model.FieldError{Field: "format", Message: "must be json or csv"})
+	}
+	return hq, errs
+}
+
+// inRange reports whether t lies in [from, to]; zero bounds are open.
+func (hq historyQuery) inRange(t time.Time) bool {
+	return (hq.from.IsZero() || !t.Before(hq.from)) && (hq.to.IsZero() || !t.After(hq.to))
+}
+
+// handleTickHistory returns the buffered ticks of one symbol, oldest
+// first.
+func (s *Server) handleTickHistory(w http.ResponseWriter, r *http.Request) {
+	symbol := strings.ToUpper(r.PathValue("symbol"))
+	hq, errs := parseHistoryQuery(r, r.URL.Query())
+	if len(errs) > 0 {
+		writeQueryErrors(w, errs)
+		return
+	}
+
+	ticks := []model.Tick{}
+	for _, t := range s.engine.Ticks(symbol) {
+		if hq.inRange(t.Time) {
+			ticks = append(ticks, t)
+		}
+	}
+	ticks = ticks[max(0, len(ticks)-hq.limit):]
+
+	if !hq.csv {
+		writeJSON(w, http.StatusOK, ticks)
+		return
+	}
+	rows := [][]string{{"time", "bid", "ask"}}
+	for _, t := range ticks {
+		rows = append(rows, []string{t.Time.UTC().Format(time.RFC3339Nano), formatPrice(t.Bid), formatPrice(t.Ask)})
+	}
+	writeCSV(w, symbol+"-ticks.csv", rows)
+}
+
+// handleCandles returns OHLC bars of one symbol from the engine's M1
+// history, oldest first; from and to select bars by open time. tf is one
+// of engine.Timeframes (default M1).
+func (s *Server) handleCandles(w http.ResponseWriter, r *http.Request) {
+	symbol := strings.ToUpper(r.PathValue("symbol"))
+	q := r.URL.Query()
+	hq, errs := parseHistoryQuery(r, q)
+	tfName := strings.ToUpper(q.Get("tf"))
+	if tfName == "" {
+		tfName = "M1"
+	}
+	tf, ok := engine.Timeframes[tfName]
+	if !ok {
+		errs = append(errs, model.FieldError{Field: "tf", Message: "must be one of M1, M5, M15, M30, H1"})
+	}
+	if len(errs) > 0 {
+		writeQueryErrors(w, errs)
+		return
+	}
+
+	candles := []engine.Candle{}
+	for _, c := range s.engine.Candles(symbol, tf) {
+		if hq.inRange(c.Time) {
+			candles = append(candles, c)
+		}
+	}
+	candles = candles[max(0, len(candles)-hq.limit):]
+
+	if !hq.csv {
+		writeJSON(w, http.StatusOK, candles)
+		return
+	}
+	rows := [][]string{{"time", "open", "high", "low", "close", "ticks", "partial"}}
+	for _, c := range candles {
+		rows = append(rows, []string{
+			c.Time.Format(time.RFC3339),
+			formatPrice(c.Open), formatPrice(c.High), formatPrice(c.Low), formatPrice(c.Close),
+			strconv.Itoa(c.Ticks), strconv.FormatBool(c.Partial),
+		})
+	}
+	writeCSV(w, symbol+"-"+tfName+".csv", rows)
+}
+
+func formatPrice(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// writeCSV writes rows as a CSV download named filename.
+func writeCSV(w http.ResponseWriter, filename string, rows [][]string) {
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	if cd := mime.FormatMediaType("attachment", map[string]string{"filename": filename}); cd != "" {
+		w.Header().Set("Content-Disposition", cd)
+	}
+	w.WriteHeader(http.StatusOK)
+	cw := csv.NewWriter(w)
+	cw.WriteAll(rows)
+}
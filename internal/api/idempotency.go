@@ -0,0 +1,156 @@
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"go-trade/internal/model"
+)
+
+// idempotencyTTL is how long a stored response is replayed for its key.
+const idempotencyTTL = 24 * time.Hour
+
+// maxCommandBody caps typed command request bodies.
+const maxCommandBody = 64 << 10
+
+// idempotentEntry is the recorded outcome of one idempotency key.
+type idempotentEntry struct {
+	bodyHash [32]byte
+	done     bool
+	status   int
+	body     []byte
+	expires  time.Time
+}
+
+// idempotencyStore remembers responses by Idempotency-Key.
+type idempotencyStore struct {
+	mu      sync.Mutex
+	entries map[string]*idempotentEntry
+}
+
+// newIdempotencyStore creates an empty store.
+func newIdempotencyStore() *idempotencyStore {
+	return &idempotencyStore{entries: make(map[string]*idempotentEntry)}
+}
+
+// begin claims key for a request body. It returns the existing entry when
+// the key was used before, or nil when the caller should run the request.
+func (st *idempotencyStore) begin(key string, hash [32]byte, now time.Time) *idempotentEntry {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	for k, e := range st.entries {
+		if e.done && now.After(e.expires) {
+			delete(st.entries, k)
+		}
+	}
+	if e, ok := st.entries[key]; ok {
+		c := *e
+		return &c
+	}
+	st.entries[key] = &idempotentEntry{bodyHash: hash}
+	return nil
+}
+
+// finish stores the response for key. A retryable response, one for a
+// command that never reached the engine, releases the key instead so the
+// request can be retried; any other response, 5xx included, is replayed.
+func (st *idempotencyStore) finish(key string, status int, body []byte, retryable bool, now time.Time) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	e, ok := st.entries[key]
+	if !ok {
+		return
+	}
+	if retryable {
+		delete(st.entries, key)
+		return
+	}
+	e.done = true
+	e.status = status
+	e.body = body
+	e.expires = now.Add(idempotencyTTL)
+}
+
+// recordingWriter copies the response body while writing it.
+type recordingWriter struct {
+	http.ResponseWriter
+	status    int
+	buf       bytes.Buffer
+	retryable bool
+}
+
+// markRetryable flags the response so its Idempotency-Key is released
+// rather than stored. It is a no-op without an Idempotency-Key.
+func markRetryable(w http.ResponseWriter) {
+	if rec, ok := w.(*recordingWriter); ok {
+		rec.retryable = true
+	}
+}
+
+func (w *recordingWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *recordingWriter) Write(p []byte) (int, error) {
+	w.buf.Write(p)
+	return w.ResponseWriter.Write(p)
+}
+
+// idempotent replays the stored response when a request repeats an
+// Idempotency-Key with the same body. Keys are scoped per user and route.
+func (s *Server) idempotent(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Idempotency-Key")
+		if key == "" {
+			next(w, r)
+			return
+		}
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxCommandBody+1))
+		if err != nil || len(body) > maxCommandBody {
+			writeError(w, http.StatusRequestEntityTooLarge, "PAYLOAD_TOO_LARGE", "payload too large", nil)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		p, _ := userFrom(r)
+		scoped := p.ID + "|" + r.Method + " " + r.URL.Path + "|" + key
+		hash := sha256.Sum256(body)
+		now := time.Now()
+
+		if prev := s.idempotency.begin(scoped, hash, now); prev != nil {
+			switch {
+			case prev.bodyHash != hash:
+				writeError(w, http.StatusUnprocessableEntity, "IDEMPOTENCY_MISMATCH",
+					"Idempotency-Key reused with a different request body", nil)
+			case !prev.done:
+				writeError(w, http.StatusConflict, "IDEMPOTENCY_IN_PROGRESS",
+					"a request with this Idempotency-Key is still running", nil)
+			default:
+				w.Header().Set("Content-Type", "application/json")
+				w.Header().Set("Idempotent-Replayed", "true")
+				w.WriteHeader(prev.status)
+				w.Write(prev.body)
+			}
+			return
+		}
+
+		rec := &recordingWriter{ResponseWriter: w, status: http.StatusOK}
+		next(rec, r)
+		s.idempotency.finish(scoped, rec.status, rec.buf.Bytes(), rec.retryable, time.Now())
+	}
+}
+
+// writeError writes an error envelope with a machine-readable code.
+func writeError(w http.ResponseWriter, status int, code, msg string, details []model.FieldError) {
+	writeJSON(w, status, model.APIResponse{
+		Error:     msg,
+		Code:      code,
+		Details:   details,
+		Timestamp: time.Now(),
+	})
+}
@@ -0,0 +1,367 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-trade/internal/engine"
+	"go-trade/internal/model"
+)
+
+// Tick listings return the most recent ticks; the store keeps a bounded
+// buffer per symbol, so the cap mostly matters for ?symbol= lists.
+const (
+	defaultTickLimit = 100
+	maxTickLimit     = 1000
+)
+
+// listQuery holds the parameters shared by the list endpoints:
+// sort=field,-field (minus for descending), fields=a,b (projection),
+// limit and offset. Field names are the JSON names of the item type.
+type listQuery struct {
+	sort   []sortKey
+	fields []string
+	limit  int // 0 = no limit
+	offset int
+}
+
+type sortKey struct {
+	index []int
+	desc  bool
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// jsonFields maps the JSON field names of struct type t to their indexes.
+func jsonFields(t reflect.Type) map[string][]int {
+	out := make(map[string][]int, t.NumField())
+	for _, f := range reflect.VisibleFields(t) {
+		if !f.IsExported() || f.Anonymous {
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		out[name] = f.Index
+	}
+	return out
+}
+
+// parseListQuery reads sort, fields, limit and offset for items of type
+// T. defaultSort applies when sort is absent; maxLimit caps limit (0 =
+// uncapped) and defaultLimit applies when limit is absent.
+func parseListQuery[T any](q url.Values, defaultSort string, defaultLimit, maxLimit int) (listQuery, []model.FieldError) {
+	known := jsonFields(reflect.TypeFor[T]())
+	lq := listQuery{limit: defaultLimit}
+	var errs []model.FieldError
+
+	sortParam := splitParams(q["sort"])
+	if len(sortParam) == 0 {
+		sortParam = splitParams([]string{defaultSort})
+	}
+	for _, name := range sortParam {
+		desc := strings.HasPrefix(name, "-")
+		idx, ok := known[strings.TrimPrefix(name, "-")]
+		if !ok {
+			errs = append(errs, model.FieldError{Field: "sort", Message: "unknown field " + strings.TrimPrefix(name, "-")})
+			continue
+		}
+		lq.sort = append(lq.sort, sortKey{index: idx, desc: desc})
+	}
+	for _, name := range splitParams(q["fields"]) {
+		if _, ok := known[name]; !ok {
+			errs = append(errs, model.FieldError{Field: "fields", Message: "unknown field " + name})
+			continue
+		}
+		lq.fields = append(lq.fields, name)
+	}
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			errs = append(errs, model.FieldError{Field: "limit", Message: "must be a positive integer"})
+		}
+		lq.limit = n
+	}
+	if maxLimit > 0 && lq.limit > maxLimit {
+		lq.limit = maxLimit
+	}
+	if v := q.Get("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			errs = append(errs, model.FieldError{Field: "offset", Message: "must be a non-negative integer"})
+		}
+		lq.offset = n
+	}
+	return lq, errs
+}
+
+// writeList sorts, pages and projects items and writes them as a bare
+// JSON array, like the original /api/positions. X-Total-Count holds the
+// number of items before paging.
+func writeList[T any](w http.ResponseWriter, items []T, lq listQuery) {
+	if len(lq.sort) > 0 {
+		slices.SortStableFunc(items, func(a, b T) int {
+			va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+			for _, k := range lq.sort {
+				c := compareValues(va.FieldByIndex(k.index), vb.FieldByIndex(k.index))
+				if k.desc {
+					c = -c
+				}
+				if c != 0 {
+					return c
+				}
+			}
+			return 0
+		})
+	}
+	total := len(items)
+	items = items[min(lq.offset, total):]
+	if lq.limit > 0 && len(items) > lq.limit {
+		items = items[:lq.limit]
+	}
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+
+	if len(lq.fields) == 0 {
+		if items == nil {
+			items = []T{}
+		}
+		writeJSON(w, http.StatusOK, items)
+		return
+	}
+	known := jsonFields(reflect.TypeFor[T]())
+	out := make([]map[string]any, len(items))
+	for i, item := range items {
+		v := reflect.ValueOf(item)
+		m := make(map[string]any, len(lq.fields))
+		for _, name := range lq.fields {
+			m[name] = v.FieldByIndex(known[name]).Interface()
+		}
+		out[i] = m
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// compareValues orders two values of the same sortable kind.
+func compareValues(a, b reflect.Value) int {
+	if a.Type() == timeType {
+		return a.Interface().(time.Time).Compare(b.Interface().(time.Time))
+	}
+	switch a.Kind() {
+	case reflect.String:
+		return strings.Compare(a.String(), b.String())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return cmpOrdered(a.Int(), b.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return cmpOrdered(a.Uint(), b.Uint())
+	case reflect.Float32, reflect.Float64:
+		return cmpOrdered(a.Float(), b.Float())
+	case reflect.Bool:
+		return cmpOrdered(boolInt(a.Bool()), boolInt(b.Bool()))
+	}
+	return 0
+}
+
+func cmpOrdered[N int64 | uint64 | float64](a, b N) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func boolInt(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// stringSet builds a lookup of a comma-separated parameter, upper-casing
+// the values when upper is set. An empty set matches everything.
+func stringSet(q url.Values, name string, upper bool) map[string]bool {
+	values := splitParams(q[name])
+	if len(values) == 0 {
+		return nil
+	}
+	set := make(map[string]bool, len(values))
+	for _, v := range values {
+		if upper {
+			v = strings.ToUpper(v)
+		}
+		set[v] = true
+	}
+	return set
+}
+
+// matchSet reports whether v is in set; a nil set matches everything.
+func matchSet(set map[string]bool, v string) bool {
+	return set == nil || set[v]
+}
+
+// boolParam reads an optional true/false parameter.
+func boolParam(q url.Values, name string, errs *[]model.FieldError) *bool {
+	v := q.Get(name)
+	if v == "" {
+		return nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		*errs = append(*errs, model.FieldError{Field: name, Message: "must be true or false"})
+		return nil
+	}
+	return &b
+}
+
+// intParam reads an optional integer parameter.
+func intParam(q url.Values, name string, errs *[]model.FieldError) *int {
+	v := q.Get(name)
+	if v == "" {
+		return nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		*errs = append(*errs, model.FieldError{Field: name, Message: "must be an integer"})
+		return nil
+	}
+	return &n
+}
+
+func writeQueryErrors(w http.ResponseWriter, errs []model.FieldError) {
+	writeError(w, http.StatusBadRequest, "VALIDATION_FAILED", "invalid query", errs)
+}
+
+// handlePositions lists positions and pending orders. Filters: accountId,
+// symbol, side, magicMin, magicMax, pending.
+func (s *Server) handlePositions(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	lq, errs := parseListQuery[model.Position](q, "id", 0, 0)
+	accounts := stringSet(q, "accountId", false)
+	symbols := stringSet(q, "symbol", true)
+	sides := stringSet(q, "side", true)
+	for side := range sides {
+		if model.Side(side) != model.SideBuy && model.Side(side) != model.SideSell {
+			errs = append(errs, model.FieldError{Field: "side", Message: fmt.Sprintf("must be %s or %s", model.SideBuy, model.SideSell)})
+			break
+		}
+	}
+	magicMin := intParam(q, "magicMin", &errs)
+	magicMax := intParam(q, "magicMax", &errs)
+	pending := boolParam(q, "pending", &errs)
+	if len(errs) > 0 {
+		writeQueryErrors(w, errs)
+		return
+	}
+
+	var out []model.Position
+	for _, p := range s.engine.Positions() {
+		switch {
+		case !matchSet(accounts, p.AccountID), !matchSet(symbols, p.Symbol), !matchSet(sides, string(p.Side)):
+		case magicMin != nil && p.Magic < *magicMin, magicMax != nil && p.Magic > *magicMax:
+		case pending != nil && p.Pending != *pending:
+		default:
+			out = append(out, p)
+		}
+	}
+	writeList(w, out, lq)
+}
+
+// handleAccounts lists account states. Filters: accountId, guardLevel.
+func (s *Server) handleAccounts(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	lq, errs := parseListQuery[model.AccountState](q, "accountId", 0, 0)
+	if len(errs) > 0 {
+		writeQueryErrors(w, errs)
+		return
+	}
+	accounts := stringSet(q, "accountId", false)
+	levels := stringSet(q, "guardLevel", true)
+
+	var out []model.AccountState
+	for _, a := range s.engine.Accounts() {
+		if matchSet(accounts, a.AccountID) && matchSet(levels, string(a.GuardLevel)) {
+			out = append(out, a)
+		}
+	}
+	writeList(w, out, lq)
+}
+
+// handleSymbols lists the latest quote per symbol. Filters: symbol,
+// hasTick.
+func (s *Server) handleSymbols(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	lq, errs := parseListQuery[engine.SymbolSnapshot](q, "symbol", 0, 0)
+	hasTick := boolParam(q, "hasTick", &errs)
+	if len(errs) > 0 {
+		writeQueryErrors(w, errs)
+		return
+	}
+	symbols := stringSet(q, "symbol", true)
+
+	var out []engine.SymbolSnapshot
+	for _, sym := range s.engine.Symbols() {
+		if matchSet(symbols, sym.Symbol) && (hasTick == nil || sym.HasTick == *hasTick) {
+			out = append(out, sym)
+		}
+	}
+	writeList(w, out, lq)
+}
+
+// handleTicks lists the buffered recent ticks, newest first by default.
+// Filter: symbol (all symbols when absent).
+func (s *Server) handleTicks(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	lq, errs := parseListQuery[model.Tick](q, "-time,symbol", defaultTickLimit, maxTickLimit)
+	if len(errs) > 0 {
+		writeQueryErrors(w, errs)
+		return
+	}
+	symbols := stringSet(q, "symbol", true)
+	if symbols == nil {
+		symbols = make(map[string]bool)
+		for _, sym := range s.engine.Symbols() {
+			symbols[sym.Symbol] = true
+		}
+	}
+
+	var out []model.Tick
+	for sym := range symbols {
+		out = append(out, s.engine.Ticks(sym)...)
+	}
+	writeList(w, out, lq)
+}
+
+// handleCommands lists the last commands dispatched by the engine, newest
+// first by default. Filters: accountId, symbol, type, source.
+func (s *Server) handleCommands(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	lq, errs := parseListQuery[model.Command](q, "-time", 0, 0)
+	if len(errs) > 0 {
+		writeQueryErrors(w, errs)
+		return
+	}
+	accounts := stringSet(q, "accountId", false)
+	symbols := stringSet(q, "symbol", true)
+	types := stringSet(q, "type", true)
+	sources := stringSet(q, "source", false)
+
+	var out []model.Command
+	for _, c := range s.engine.RecentCommands() {
+		if matchSet(accounts, c.AccountID) && matchSet(symbols, c.Symbol) &&
+			matchSet(types, string(c.Type)) && matchSet(sources, c.Source) {
+			out = append(out, c)
+		}
+	}
+	writeList(w, out, lq)
+}
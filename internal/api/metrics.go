@@ -0,0 +1,52 @@
+package api
+
+import (
+	"crypto/subtle"
+	"net"
+	"net/http"
+
+	"go-trade/internal/metrics"
+
+	"go.uber.org/zap"
+)
+
+// handlePrometheus serves /metrics in the Prometheus text format. When
+// api.metricsToken is set the scraper must send it as a bearer token;
+// without one only loopback clients are served, since the metrics expose
+// account IDs, equity and drawdown.
+func (s *Server) handlePrometheus(w http.ResponseWriter, r *http.Request) {
+	if s.metricsToken == "" {
+		if ip := net.ParseIP(clientIP(r)); ip == nil || !ip.IsLoopback() {
+			http.Error(w, "metrics are served to localhost only unless api.metricsToken is set", http.StatusForbidden)
+			return
+		}
+	} else {
+		got := []byte(r.Header.Get("Authorization"))
+		want := []byte("Bearer " + s.metricsToken)
+		if subtle.ConstantTimeCompare(got, want) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="metrics"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", metrics.ContentType)
+	mw := metrics.NewWriter(w)
+	s.engine.WritePrometheus(mw)
+
+	stats := s.RateLimitStats()
+	mw.Gauge("hayalet_ws_clients", "Connected WebSocket clients.",
+		metrics.Sample{Value: float64(s.hub.ClientCount())})
+	mw.Counter("hayalet_ws_dropped_total", "Hub messages dropped from slow WebSocket clients and gRPC streams.",
+		metrics.Sample{Value: float64(s.hub.Dropped())})
+	mw.Counter("hayalet_api_requests_total", "Requests to /api routes.",
+		metrics.Sample{Value: float64(stats.Requests)})
+	mw.Counter("hayalet_api_rate_limited_total", "Requests rejected by a rate limiter.",
+		metrics.Sample{Labels: metrics.L("limiter", "ip"), Value: float64(stats.LimitedIP)},
+		metrics.Sample{Labels: metrics.L("limiter", "user"), Value: float64(stats.LimitedUser)},
+		metrics.Sample{Labels: metrics.L("limiter", "strict"), Value: float64(stats.LimitedStrict)},
+	)
+	if err := mw.Flush(); err != nil {
+		s.logger.Debug("metrics_write_failed", zap.Error(err))
+	}
+}
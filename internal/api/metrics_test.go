@@ -0,0 +1,126 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go-trade/internal/config"
+	"go-trade/internal/metrics"
+
+	"go.uber.org/zap"
+)
+
+// promEngine is an EngineReader that writes a fixed set of engine metrics.
+type promEngine struct{ EngineReader }
+
+func (promEngine) StatusJSON() ([]byte, error) { return []byte("{}"), nil }
+
+func (promEngine) WritePrometheus(w *metrics.Writer) {
+	w.Counter("hayalet_ticks_total", "Ticks read from the bridge.", metrics.Sample{Value: 42})
+	w.Gauge("hayalet_account_equity", "Account equity.",
+		metrics.Sample{Labels: metrics.L("account", "1001"), Value: 10250.5},
+		metrics.Sample{Labels: metrics.L("account", `demo "a"\b`), Value: 0},
+	)
+	h := metrics.NewHistogram(0.01, 0.1)
+	h.Observe(0.005)
+	h.Observe(0.05)
+	h.Observe(2)
+	w.Histogram("hayalet_step_duration_seconds", "Engine step duration.", h.Snapshot())
+}
+
+func newMetricsServer(token string) *Server {
+	return &Server{
+		engine:       promEngine{},
+		hub:          NewHub(config.WebSocketConfig{}, promEngine{}.StatusJSON, zap.NewNop()),
+		logger:       zap.NewNop(),
+		metricsToken: token,
+		ipLimit:      newRateLimiter("ip", 60, 10),
+		userLimit:    newRateLimiter("user", 60, 10),
+		strictLimit:  newRateLimiter("strict", 60, 10),
+	}
+}
+
+func TestPrometheusExposition(t *testing.T) {
+	s := newMetricsServer("")
+	s.requests.Store(7)
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.RemoteAddr = "127.0.0.1:50000"
+	s.handlePrometheus(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+	if got := rec.Header().Get("Content-Type"); got != metrics.ContentType {
+		t.Errorf("Content-Type = %q, want %q", got, metrics.ContentType)
+	}
+	want := `# HELP hayalet_ticks_total Ticks read from the bridge.
+# TYPE hayalet_ticks_total counter
+hayalet_ticks_total 42
+# HELP hayalet_account_equity Account equity.
+# TYPE hayalet_account_equity gauge
+hayalet_account_equity{account="1001"} 10250.5
+hayalet_account_equity{account="demo \"a\"\\b"} 0
+# HELP hayalet_step_duration_seconds Engine step duration.
+# TYPE hayalet_step_duration_seconds histogram
+hayalet_step_duration_seconds_bucket{le="0.01"} 1
+hayalet_step_duration_seconds_bucket{le="0.1"} 2
+hayalet_step_duration_seconds_bucket{le="+Inf"} 3
+hayalet_step_duration_seconds_sum 2.055
+hayalet_step_duration_seconds_count 3
+# HELP hayalet_ws_clients Connected WebSocket clients.
+# TYPE hayalet_ws_clients gauge
+hayalet_ws_clients 0
+# HELP hayalet_ws_dropped_total Hub messages dropped from slow WebSocket clients and gRPC streams.
+# TYPE hayalet_ws_dropped_total counter
+hayalet_ws_dropped_total 0
+# HELP hayalet_api_requests_total Requests to /api routes.
+# TYPE hayalet_api_requests_total counter
+hayalet_api_requests_total 7
+# HELP hayalet_api_rate_limited_total Requests rejected by a rate limiter.
+# TYPE hayalet_api_rate_limited_total counter
+hayalet_api_rate_limited_total{limiter="ip"} 0
+hayalet_api_rate_limited_total{limiter="user"} 0
+hayalet_api_rate_limited_total{limiter="strict"} 0
+`
+	if got := rec.Body.String(); got != want {
+		t.Errorf("exposition mismatch\ngot:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestPrometheusAuth(t *testing.T) {
+	tests := []struct {
+		name   string
+		token  string
+		remote string
+		auth   string
+		want   int
+	}{
+		{"no token, loopback v4", "", "127.0.0.1:1234", "", http.StatusOK},
+		{"no token, loopback v6", "", "[::1]:1234", "", http.StatusOK},
+		{"no token, remote", "", "192.0.2.10:1234", "", http.StatusForbidden},
+		{"no token, remote with bearer", "", "192.0.2.10:1234", "Bearer x", http.StatusForbidden},
+		{"token, remote, valid", "s3cret", "192.0.2.10:1234", "Bearer s3cret", http.StatusOK},
+		{"token, remote, wrong", "s3cret", "192.0.2.10:1234", "Bearer nope", http.StatusUnauthorized},
+		{"token, loopback, missing", "s3cret", "127.0.0.1:1234", "", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newMetricsServer(tt.token)
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+			req.RemoteAddr = tt.remote
+			if tt.auth != "" {
+				req.Header.Set("Authorization", tt.auth)
+			}
+			s.handlePrometheus(rec, req)
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.want)
+			}
+			if tt.want == http.StatusUnauthorized && rec.Header().Get("WWW-Authenticate") == "" {
+				t.Error("missing WWW-Authenticate")
+			}
+		})
+	}
+}
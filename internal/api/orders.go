@@ -0,0 +1,334 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-trade/internal/engine"
+	"go-trade/internal/model"
+
+	"go.uber.org/zap"
+)
+
+// Defaults for how long a typed command waits for its execution report.
+const (
+	defaultCommandWait = 5 * time.Second
+	maxCommandWait     = 30 * time.Second
+)
+
+// symbolPattern matches broker symbol names such as EURUSD, XAUUSD.m or US30#.
+var symbolPattern = regexp.MustCompile(`^[A-Z0-9][A-Z0-9._#-]{1,19}$`)
+
+// orderLimits bounds manual order volumes.
+type orderLimits struct {
+	lotStep float64
+	minLot  float64
+	maxLot  float64
+	magic   int // magic of manual orders
+}
+
+// orderRequest is the body of POST /api/orders.
+type orderRequest struct {
+	AccountID string     `json:"accountId"`
+	Symbol    string     `json:"symbol"`
+	Side      model.Side `json:"side"`
+	Volume    float64    `json:"volume"`
+	SL        float64    `json:"sl"`
+	TP        float64    `json:"tp"`
+	Comment   string     `json:"comment"`
+}
+
+// closeRequest is the optional body of POST /api/positions/{ticket}/close.
+// With neither Volume nor Fraction the whole position is closed.
+type closeRequest struct {
+	AccountID string  `json:"accountId"`
+	Volume    float64 `json:"volume"`
+	Fraction  float64 `json:"fraction"`
+	Comment   string  `json:"comment"`
+}
+
+// accountActions maps /api/accounts/{id}/{action} onto command types.
+var accountActions = map[string]model.CommandType{
+	"pause":     model.CommandPause,
+	"resume":    model.CommandResume,
+	"freeze":    model.CommandFreeze,
+	"hedge":     model.CommandHedgeAll,
+	"close-all": model.CommandCloseAll,
+}
+
+// validate checks an order against the schema and lot limits.
+func (req *orderRequest) validate(lim orderLimits) []model.FieldError {
+	var errs []model.FieldError
+	req.Symbol = strings.ToUpper(strings.TrimSpace(req.Symbol))
+	req.Side = model.Side(strings.ToUpper(string(req.Side)))
+
+	if strings.TrimSpace(req.AccountID) == "" {
+		errs = append(errs, model.FieldError{Field: "accountId", Message: "required"})
+	}
+	if !symbolPattern.MatchString(req.Symbol) {
+		errs = append(errs, model.FieldError{Field: "symbol", Message: "must be a broker symbol like EURUSD"})
+	}
+	if req.Side != model.SideBuy && req.Side != model.SideSell {
+		errs = append(errs, model.FieldError{Field: "side", Message: "must be BUY or SELL"})
+	}
+	errs = append(errs, validateVolume("volume", req.Volume, lim)...)
+	if req.SL < 0 {
+		errs = append(errs, model.FieldError{Field: "sl", Message: "must not be negative"})
+	}
+	if req.TP < 0 {
+		errs = append(errs, model.FieldError{Field: "tp", Message: "must not be negative"})
+	}
+	if req.SL > 0 && req.TP > 0 {
+		if req.Side == model.SideBuy && req.SL >= req.TP {
+			errs = append(errs, model.FieldError{Field: "sl", Message: "must be below tp for BUY"})
+		}
+		if req.Side == model.SideSell && req.SL <= req.TP {
+			errs = append(errs, model.FieldError{Field: "sl", Message: "must be above tp for SELL"})
+		}
+	}
+	if len(req.Comment) > 64 {
+		errs = append(errs, model.FieldError{Field: "comment", Message: "at most 64 characters"})
+	}
+	return errs
+}
+
+// validate checks a close request.
+func (req *closeRequest) validate(lim orderLimits) []model.FieldError {
+	var errs []model.FieldError
+	if req.Volume != 0 && req.Fraction != 0 {
+		errs = append(errs, model.FieldError{Field: "fraction", Message: "set either volume or fraction, not both"})
+	}
+	if req.Volume != 0 {
+		errs = append(errs, validateVolume("volume", req.Volume, lim)...)
+	}
+	if req.Fraction < 0 || req.Fraction > 1 {
+		errs = append(errs, model.FieldError{Field: "fraction", Message: "must be between 0 and 1"})
+	}
+	if len(req.Comment) > 64 {
+		errs = append(errs, model.FieldError{Field: "comment", Message: "at most 64 characters"})
+	}
+	return errs
+}
+
+// validateCommand checks a raw command by type, reusing the typed
+// endpoint rules.
+func validateCommand(cmd *model.Command, lim orderLimits) []model.FieldError {
+	cmd.Type = model.CommandType(strings.ToUpper(string(cmd.Type)))
+	if cmd.Magic != 0 {
+		// Engine strategies own every other magic range
+		return []model.FieldError{{Field: "magic", Message: "must not be set; manual orders use the configured magic"}}
+	}
+	switch cmd.Type {
+	case model.CommandOpen:
+		req := orderRequest{
+			AccountID: cmd.AccountID,
+			Symbol:    cmd.Symbol,
+			Side:      cmd.Side,
+			Volume:    cmd.Volume,
+			SL:        cmd.SL,
+			TP:        cmd.TP,
+		}
+		errs := req.validate(lim)
+		cmd.Symbol, cmd.Side, cmd.Magic = req.Symbol, req.Side, lim.magic
+		return errs
+	case model.CommandClose, model.CommandPartialClose, model.CommandModify:
+		if cmd.Ticket <= 0 {
+			return []model.FieldError{{Field: "ticket", Message: "required"}}
+		}
+		if cmd.Type == model.CommandPartialClose {
+			req := closeRequest{Volume: cmd.Volume, Fraction: cmd.Fraction}
+			if cmd.Volume == 0 && cmd.Fraction == 0 {
+				return []model.FieldError{{Field: "volume", Message: "volume or fraction required"}}
+			}
+			return req.validate(lim)
+		}
+		return nil
+	case model.CommandPause, model.CommandResume, model.CommandFreeze:
+		req := controlRequest{AccountID: cmd.AccountID, Symbol: cmd.Symbol, Strategy: cmd.Strategy, Reason: cmd.Reason}
+		errs := req.validate()
+		cmd.AccountID, cmd.Symbol, cmd.Strategy = req.AccountID, req.Symbol, req.Strategy
+		return errs
+	case model.CommandHedgeAll, model.CommandCloseAll:
+		return nil
+	}
+	return []model.FieldError{{Field: "type", Message: "unknown command type"}}
+}
+
+// validateVolume checks a lot size against the configured limits.
+func validateVolume(field string, v float64, lim orderLimits) []model.FieldError {
+	switch {
+	case v <= 0 || math.IsNaN(v):
+		return []model.FieldError{{Field: field, Message: "must be positive"}}
+	case v < lim.minLot:
+		return []model.FieldError{{Field: field, Message: fmt.Sprintf("below minimum lot %g", lim.minLot)}}
+	case lim.maxLot > 0 && v > lim.maxLot:
+		return []model.FieldError{{Field: field, Message: fmt.Sprintf("above maximum lot %g", lim.maxLot)}}
+	case lim.lotStep > 0 && math.Abs(v/lim.lotStep-math.Round(v/lim.lotStep)) > 1e-6:
+		return []model.FieldError{{Field: field, Message: fmt.Sprintf("must be a multiple of %g", lim.lotStep)}}
+	}
+	return nil
+}
+
+// handleOrderCreate opens a manual market order.
+func (s *Server) handleOrderCreate(w http.ResponseWriter, r *http.Request) {
+	var req orderRequest
+	if !decodeStrict(w, r, &req) {
+		return
+	}
+	if errs := req.validate(s.limits); len(errs) > 0 {
+		writeError(w, http.StatusBadRequest, "VALIDATION_FAILED", "invalid order", errs)
+		return
+	}
+	s.execute(w, r, model.Command{
+		Type:      model.CommandOpen,
+		AccountID: req.AccountID,
+		Symbol:    req.Symbol,
+		Side:      req.Side,
+		Volume:    req.Volume,
+		SL:        req.SL,
+		TP:        req.TP,
+		Magic:     s.limits.magic,
+		Reason:    reasonOr(req.Comment, "API_ORDER"),
+	})
+}
+
+// handlePositionClose fully or partially closes a position by ticket.
+func (s *Server) handlePositionClose(w http.ResponseWriter, r *http.Request) {
+	ticket, err := strconv.ParseInt(r.PathValue("ticket"), 10, 64)
+	if err != nil || ticket <= 0 {
+		writeError(w, http.StatusBadRequest, "VALIDATION_FAILED", "invalid ticket",
+			[]model.FieldError{{Field: "ticket", Message: "must be a positive integer"}})
+		return
+	}
+	var req closeRequest
+	if r.ContentLength != 0 && !decodeStrict(w, r, &req) {
+		return
+	}
+	if errs := req.validate(s.limits); len(errs) > 0 {
+		writeError(w, http.StatusBadRequest, "VALIDATION_FAILED", "invalid close request", errs)
+		return
+	}
+
+	cmd := model.Command{
+		Type:      model.CommandClose,
+		AccountID: req.AccountID,
+		Ticket:    ticket,
+		Reason:    reasonOr(req.Comment, "API_CLOSE"),
+	}
+	if req.Volume > 0 || req.Fraction > 0 {
+		cmd.Type = model.CommandPartialClose
+		cmd.Volume = req.Volume
+		cmd.Fraction = req.Fraction
+	}
+	s.execute(w, r, cmd)
+}
+
+// handleAccountAction pauses, resumes, freezes, hedges or flattens an account.
+func (s *Server) handleAccountAction(w http.ResponseWriter, r *http.Request) {
+	typ, ok := accountActions[r.PathValue("action")]
+	if !ok {
+		writeError(w, http.StatusNotFound, "UNKNOWN_ACTION",
+			"action must be one of pause, resume, freeze, hedge, close-all", nil)
+		return
+	}
+	s.execute(w, r, model.Command{
+		Type:      typ,
+		AccountID: r.PathValue("id"),
+		Reason:    "API_" + strings.ToUpper(strings.ReplaceAll(r.PathValue("action"), "-", "_")),
+	})
+}
+
+// execute runs a command synchronously and writes its result. The wait
+// query parameter bounds how long to wait for a fill (default 5s, max 30s;
+// 0 returns as soon as the command is sent). Acceptance by the engine has
+// its own timeout, so a short wait never turns a sent order into an error.
+func (s *Server) execute(w http.ResponseWriter, r *http.Request, cmd model.Command) {
+	wait := defaultCommandWait
+	if v := r.URL.Query().Get("wait"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			writeError(w, http.StatusBadRequest, "VALIDATION_FAILED", "invalid wait",
+				[]model.FieldError{{Field: "wait", Message: "must be a duration like 5s"}})
+			return
+		}
+		wait = min(d, maxCommandWait)
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), wait)
+	defer cancel()
+
+	p, _ := userFrom(r)
+	cmd.Source = "api:" + p.Username
+	res, err := s.engine.ExecuteCommand(ctx, cmd)
+	if err != nil {
+		// The engine never took the command, so a retry is safe.
+		markRetryable(w)
+		if errors.Is(err, engine.ErrEngineBusy) {
+			writeError(w, http.StatusGatewayTimeout, "ENGINE_BUSY", err.Error(), nil)
+			return
+		}
+		writeError(w, http.StatusServiceUnavailable, "CANCELLED", "request cancelled before the engine took the command", nil)
+		return
+	}
+
+	s.logger.Info("api_command",
+		zap.String("id", res.ID),
+		zap.String("type", string(res.Command.Type)),
+		zap.String("status", string(res.Status)),
+		zap.String("account", res.Command.AccountID),
+		zap.String("symbol", res.Command.Symbol),
+		zap.Int64("ticket", res.Ticket),
+		zap.String("user", p.Username),
+	)
+
+	status := http.StatusOK
+	switch res.Status {
+	case model.CommandSent:
+		status = http.StatusAccepted
+	case model.CommandRejected:
+		switch res.Code {
+		case engine.CodeNotFound:
+			status = http.StatusNotFound
+		case engine.CodeUnsupported, engine.CodeInvalidScope:
+			status = http.StatusBadRequest
+		case engine.CodeInvalidVolume:
+			status = http.StatusUnprocessableEntity
+		default:
+			status = http.StatusUnprocessableEntity
+		}
+	case model.CommandFailed:
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, model.APIResponse{
+		Data:      res,
+		Error:     res.Error,
+		Code:      res.Code,
+		Timestamp: time.Now(),
+	})
+}
+
+// decodeStrict decodes a JSON body rejecting unknown fields.
+func decodeStrict(w http.ResponseWriter, r *http.Request, v any) bool {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxCommandBody))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_JSON", "invalid JSON: "+err.Error(), nil)
+		return false
+	}
+	return true
+}
+
+// reasonOr returns the trimmed comment, or def when empty.
+func reasonOr(comment, def string) string {
+	if c := strings.TrimSpace(comment); c != "" {
+		return c
+	}
+	return def
+}
@@ -0,0 +1,155 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"go-trade/internal/engine"
+	"go-trade/internal/model"
+)
+
+// overrideRequest is the body of POST /api/overrides. Exactly one of
+// ExpiresAt and Duration sets the lifetime.
+type overrideRequest struct {
+	Kind      model.OverrideKind `json:"kind"`
+	AccountID string             `json:"accountId"`
+	Symbol    string             `json:"symbol"`
+	Value     string             `json:"value"`
+	Reason    string             `json:"reason"`
+	ExpiresAt *time.Time         `json:"expiresAt"`
+	Duration  string             `json:"duration"`
+}
+
+// overridePatch is the body of PATCH /api/overrides/{id}.
+type overridePatch struct {
+	Reason    *string    `json:"reason"`
+	ExpiresAt *time.Time `json:"expiresAt"`
+	Duration  string     `json:"duration"`
+}
+
+// overrideExpiry resolves an expiresAt/duration pair.
+func overrideExpiry(expiresAt *time.Time, duration string, now time.Time) (*time.Time, []model.FieldError) {
+	switch {
+	case expiresAt != nil && duration != "":
+		return nil, []model.FieldError{{Field: "duration", Message: "set either expiresAt or duration, not both"}}
+	case duration != "":
+		d, err := time.ParseDuration(duration)
+		if err != nil || d <= 0 {
+			return nil, []model.FieldError{{Field: "duration", Message: "must be a positive duration like 2h"}}
+		}
+		t := now.Add(d)
+		return &t, nil
+	}
+	return expiresAt, nil
+}
+
+// handleOverrideList returns the active overrides.
+func (s *Server) handleOverrideList(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, model.APIResponse{
+		Data:      s.engine.Overrides(),
+		Timestamp: time.Now(),
+	})
+}
+
+// handleOverrideHistory returns the override audit trail.
+func (s *Server) handleOverrideHistory(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, model.APIResponse{
+		Data:      s.engine.OverrideHistory(),
+		Timestamp: time.Now(),
+	})
+}
+
+// handleOverrideCreate registers an override authored by the caller.
+func (s *Server) handleOverrideCreate(w http.ResponseWriter, r *http.Request) {
+	var req overrideRequest
+	if !decodeStrict(w, r, &req) {
+		return
+	}
+	now := time.Now()
+	expires, errs := overrideExpiry(req.ExpiresAt, req.Duration, now)
+	if expires == nil && errs == nil {
+		errs = []model.FieldError{{Field: "expiresAt", Message: "expiresAt or duration required"}}
+	}
+	if sym := strings.ToUpper(strings.TrimSpace(req.Symbol)); sym != "" && !symbolPattern.MatchString(sym) {
+		errs = append(errs, model.FieldError{Field: "symbol", Message: "must be a broker symbol like EURUSD"})
+	}
+	if len(req.Reason) > 256 {
+		errs = append(errs, model.FieldError{Field: "reason", Message: "at most 256 characters"})
+	}
+	if len(errs) > 0 {
+		writeError(w, http.StatusBadRequest, "VALIDATION_FAILED", "invalid override", errs)
+		return
+	}
+
+	p, _ := userFrom(r)
+	o, err := s.engine.CreateOverride(model.Override{
+		Kind:      req.Kind,
+		AccountID: req.AccountID,
+		Symbol:    req.Symbol,
+		Value:     req.Value,
+		Reason:    req.Reason,
+		Author:    p.Username,
+		ExpiresAt: *expires,
+	}, now)
+	if err != nil {
+		writeOverrideError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, model.APIResponse{
+		Data:      o,
+		Timestamp: time.Now(),
+	})
+}
+
+// handleOverrideUpdate changes the expiry or reason of an override.
+func (s *Server) handleOverrideUpdate(w http.ResponseWriter, r *http.Request) {
+	var req overridePatch
+	if !decodeStrict(w, r, &req) {
+		return
+	}
+	now := time.Now()
+	expires, errs := overrideExpiry(req.ExpiresAt, req.Duration, now)
+	if len(errs) > 0 {
+		writeError(w, http.StatusBadRequest, "VALIDATION_FAILED", "invalid override update", errs)
+		return
+	}
+	p, _ := userFrom(r)
+	o, err := s.engine.UpdateOverride(r.PathValue("id"),
+		engine.OverrideUpdate{ExpiresAt: expires, Reason: req.Reason}, p.Username, now)
+	if err != nil {
+		writeOverrideError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, model.APIResponse{
+		Data:      o,
+		Timestamp: time.Now(),
+	})
+}
+
+// handleOverrideDelete removes an override before it expires.
+func (s *Server) handleOverrideDelete(w http.ResponseWriter, r *http.Request) {
+	p, _ := userFrom(r)
+	o, err := s.engine.RemoveOverride(r.PathValue("id"), p.Username, time.Now())
+	if err != nil {
+		writeOverrideError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, model.APIResponse{
+		Data:      o,
+		Timestamp: time.Now(),
+	})
+}
+
+// writeOverrideError maps override registry errors onto HTTP statuses.
+func writeOverrideError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, engine.ErrOverrideNotFound):
+		writeError(w, http.StatusNotFound, "NOT_FOUND", err.Error(), nil)
+	case errors.Is(err, engine.ErrInvalidOverride):
+		writeError(w, http.StatusBadRequest, "VALIDATION_FAILED", err.Error(), nil)
+	default:
+		writeError(w, http.StatusInternalServerError, "INTERNAL", err.Error(), nil)
+	}
+}
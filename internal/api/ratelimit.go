@@ -0,0 +1,166 @@
+package api
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go-trade/internal/model"
+
+	"go.uber.org/zap"
+)
+
+// bucketIdleTTL is how long an untouched bucket is kept before it is swept.
+const bucketIdleTTL = 10 * time.Minute
+
+// tokenBucket holds the tokens left for one key.
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateLimiter is a keyed token-bucket limiter refilling at perMinute/60
+// tokens per second up to burst.
+type rateLimiter struct {
+	name      string
+	rate      float64 // tokens per second
+	burst     float64
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+	limited   atomic.Int64
+}
+
+// newRateLimiter creates a limiter. A non-positive perMinute disables it.
+func newRateLimiter(name string, perMinute, burst int) *rateLimiter {
+	if burst <= 0 {
+		burst = 1
+	}
+	return &rateLimiter{
+		name:    name,
+		rate:    float64(perMinute) / 60,
+		burst:   float64(burst),
+		buckets: make(map[string]*tokenBucket),
+	}
+}
+
+// allow takes a token for key. When none is left it returns false and how
+// long until the next token is available.
+func (l *rateLimiter) allow(key string, now time.Time) (bool, time.Duration) {
+	if l.rate <= 0 {
+		return true, 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastSweep) > time.Minute {
+		for k, b := range l.buckets {
+			if now.Sub(b.last) > bucketIdleTTL {
+				delete(l.buckets, k)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	l.limited.Add(1)
+	wait := time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	return false, wait
+}
+
+// RateLimitStats reports how many requests each limiter rejected.
+type RateLimitStats struct {
+	Requests      int64 `json:"requests"`
+	LimitedIP     int64 `json:"limitedIp"`
+	LimitedUser   int64 `json:"limitedUser"`
+	LimitedStrict int64 `json:"limitedStrict"`
+}
+
+// RateLimitStats returns the rate limiter counters.
+func (s *Server) RateLimitStats() RateLimitStats {
+	return RateLimitStats{
+		Requests:      s.requests.Load(),
+		LimitedIP:     s.ipLimit.limited.Load(),
+		LimitedUser:   s.userLimit.limited.Load(),
+		LimitedStrict: s.strictLimit.limited.Load(),
+	}
+}
+
+// ipRateLimit applies the per-IP limit to every /api route except the
+// health check.
+func (s *Server) ipRateLimit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/api/") || r.URL.Path == "/api/health" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		s.requests.Add(1)
+		if !s.checkLimit(w, r, s.ipLimit, "ip:"+clientIP(r)) {
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// strict wraps the write-heavy routes (/api/command, the signal webhook)
+// with the stricter limiter, keyed by user when authenticated, else by IP.
+func (s *Server) strict(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := "ip:" + clientIP(r)
+		if p, ok := userFrom(r); ok {
+			key = "user:" + p.ID
+		}
+		if !s.checkLimit(w, r, s.strictLimit, key) {
+			return
+		}
+		next(w, r)
+	}
+}
+
+// checkLimit takes a token from l for key, writing a 429 with Retry-After
+// when the bucket is empty.
+func (s *Server) checkLimit(w http.ResponseWriter, r *http.Request, l *rateLimiter, key string) bool {
+	ok, wait := l.allow(key, time.Now())
+	if ok {
+		return true
+	}
+	secs := int(math.Ceil(wait.Seconds()))
+	if secs < 1 {
+		secs = 1
+	}
+	s.logger.Warn("api_rate_limited",
+		zap.String("limiter", l.name),
+		zap.String("key", key),
+		zap.String("path", r.URL.Path),
+	)
+	w.Header().Set("Retry-After", strconv.Itoa(secs))
+	writeJSON(w, http.StatusTooManyRequests, model.APIResponse{
+		Error:     "rate limit exceeded",
+		Timestamp: time.Now(),
+	})
+	return false
+}
+
+// clientIP returns the host part of the request's remote address.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
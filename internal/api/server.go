@@ -5,8 +5,14 @@ import (
 	"encoding/json"
 	"net/http"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"go-trade/internal/audit"
+	"go-trade/internal/auth"
+	"go-trade/internal/config"
+	"go-trade/internal/engine"
+	"go-trade/internal/metrics"
 	"go-trade/internal/model"
 
 	"go.uber.org/zap"
@@ -15,46 +21,171 @@ import (
 // EngineReader provides read-only access to engine state.
 type EngineReader interface {
 	StatusJSON() ([]byte, error)
-	PushCommand(cmd model.Command)
+	ExecuteCommand(ctx context.Context, cmd model.Command) (model.CommandResult, error)
 	GridStatesJSON() ([]byte, error)
+	Positions() []model.Position
+	Accounts() []model.AccountState
+	Symbols() []engine.SymbolSnapshot
+	Ticks(symbol string) []model.Tick
+	Candles(symbol string, tf time.Duration) []engine.Candle
+	RecentCommands() []model.Command
+	PushSignal(sig model.Signal) error
+	SignalByID(id string) (model.Signal, bool)
+	SignalSourcesJSON() ([]byte, error)
+	SetSignalSourceEnabled(name string, enabled bool)
+	TradingStates() []engine.ScopeState
+	Overrides() []model.Override
+	OverrideHistory() []model.OverrideEvent
+	CreateOverride(o model.Override, now time.Time) (model.Override, error)
+	UpdateOverride(id string, upd engine.OverrideUpdate, actor string, now time.Time) (model.Override, error)
+	RemoveOverride(id, actor string, now time.Time) (model.Override, error)
+	WritePrometheus(w *metrics.Writer)
+	Readiness(now time.Time) engine.Readiness
 }
 
 // Server is the REST API + WebSocket server.
 type Server struct {
 	engine  EngineReader
 	hub     *Hub
+	signals *signalVerifier
+	users   *auth.UserStore
+	audit   *audit.Log
+	tokens  *auth.TokenIssuer
 	logger  *zap.Logger
+	limits  orderLimits
+
+	metricsToken string
+
+	idempotency *idempotencyStore
+
+	ipLimit     *rateLimiter
+	userLimit   *rateLimiter
+	strictLimit *rateLimiter
+	requests    atomic.Int64
+
 	mux     *http.ServeMux
+	static  http.Handler // nil when the dashboard is disabled
 	srv     *http.Server
 	address string
 }
 
-// NewServer creates an API server.
-func NewServer(address string, engine EngineReader, logger *zap.Logger) *Server {
+// NewServer creates an API server. users backs login and token validation;
+// trail, when not nil, records operator actions and serves /api/audit.
+func NewServer(cfg *config.Config, engine EngineReader, users *auth.UserStore, trail *audit.Log, logger *zap.Logger) *Server {
+	tokens := auth.NewTokenIssuer(cfg.API.JwtSecret,
+		time.Duration(cfg.API.AccessTokenMinutes)*time.Minute,
+		time.Duration(cfg.API.RefreshTokenHours)*time.Hour,
+	)
 	s := &Server{
 		engine:  engine,
-		hub:     NewHub(logger),
+		hub:     NewHub(cfg.API.WebSocket, engine.StatusJSON, logger),
+		signals: newSignalVerifier(cfg.Signal.Secret),
+		users:   users,
+		audit:   trail,
+		tokens:  tokens,
 		logger:  logger,
 		mux:     http.NewServeMux(),
-		address: address,
+		address: cfg.API.ListenAddress,
+		limits: orderLimits{
+			lotStep: cfg.Engine.LotStep,
+			minLot:  cfg.Engine.MinLot,
+			maxLot:  cfg.Engine.MaxOrderLot,
+			magic:   cfg.Engine.ManualMagic,
+		},
+
+		metricsToken: cfg.API.MetricsToken,
+		idempotency:  newIdempotencyStore(),
+
+		ipLimit:     newRateLimiter("ip", cfg.API.RateLimitPerMinute, cfg.API.RateLimitBurst),
+		userLimit:   newRateLimiter("user", cfg.API.RateLimitPerMinute, cfg.API.RateLimitBurst),
+		strictLimit: newRateLimiter("strict", cfg.API.StrictRateLimitPerMinute, cfg.API.StrictRateLimitBurst),
+	}
+	if cfg.Dashboard.Enabled {
+		s.static = newStaticHandler(dashboardFS(cfg.Dashboard.StaticPath, logger))
+	}
+	s.hub.sessionOf = func(r *http.Request) (string, error) {
+		p, err := s.authenticate(r)
+		return p.SessionID, err
+	}
+	s.hub.sessionLive = func(id string) bool {
+		_, err := users.ValidateSession(id, time.Now())
+		return err == nil
 	}
 	s.registerRoutes()
 	return s
 }
 
+// Handler returns the REST API handler with per-IP rate limiting, for
+// transports that replay requests through it (WebSocket RPC, gRPC).
+func (s *Server) Handler() http.Handler {
+	return s.ipRateLimit(s.mux)
+}
+
 // Hub returns the WebSocket hub for broadcasting.
 func (s *Server) HubRef() *Hub {
 	return s.hub
 }
 
+// registerRoutes wires every route with the minimum role allowed to call
+// it (see the role matrix in docs/architecture.md). /api/health, /healthz,
+// /readyz, the login endpoints and the signal webhook, which has its own
+// HMAC auth, are public. /metrics is guarded by api.metricsToken, or kept
+// to localhost without one, instead of a user session. The dashboard's static files are public too; its data
+// comes from the authenticated API.
 func (s *Server) registerRoutes() {
-	s.mux.HandleFunc("/api/status", s.handleStatus)
-	s.mux.HandleFunc("/api/positions", s.handlePositions)
-	s.mux.HandleFunc("/api/accounts", s.handleAccounts)
-	s.mux.HandleFunc("/api/grids", s.handleGrids)
-	s.mux.HandleFunc("/api/command", s.handleCommand)
+	s.mux.HandleFunc("POST /api/auth/login", s.handleLogin)
+	s.mux.HandleFunc("POST /api/auth/refresh", s.handleRefresh)
+	s.mux.HandleFunc("POST /api/auth/logout", s.requireRole(model.RoleViewer, s.handleLogout))
+	s.mux.HandleFunc("GET /api/auth/me", s.requireRole(model.RoleViewer, s.handleMe))
+	s.mux.HandleFunc("POST /api/auth/password", s.requireRole(model.RoleViewer, s.handleChangePassword))
+
+	s.mux.HandleFunc("GET /api/users", s.requireRole(model.RoleAdmin, s.handleUserList))
+	s.mux.HandleFunc("POST /api/users", s.requireRole(model.RoleAdmin, s.handleUserCreate))
+	s.mux.HandleFunc("PATCH /api/users/{id}", s.requireRole(model.RoleAdmin, s.handleUserUpdate))
+	s.mux.HandleFunc("DELETE /api/users/{id}", s.requireRole(model.RoleAdmin, s.handleUserDelete))
+	s.mux.HandleFunc("POST /api/users/{id}/reset-password", s.requireRole(model.RoleAdmin, s.handleUserResetPassword))
+	s.mux.HandleFunc("POST /api/users/{id}/{action}", s.requireRole(model.RoleAdmin, s.handleUserToggle))
+	s.mux.HandleFunc("GET /api/sessions", s.requireRole(model.RoleAdmin, s.handleSessionList))
+	s.mux.HandleFunc("DELETE /api/sessions/{id}", s.requireRole(model.RoleAdmin, s.handleSessionRevoke))
+
+	s.mux.HandleFunc("/api/status", s.requireRole(model.RoleViewer, s.handleStatus))
+	s.mux.HandleFunc("/api/positions", s.requireRole(model.RoleViewer, s.handlePositions))
+	s.mux.HandleFunc("/api/accounts", s.requireRole(model.RoleViewer, s.handleAccounts))
+	s.mux.HandleFunc("/api/grids", s.requireRole(model.RoleViewer, s.handleGrids))
+	s.mux.HandleFunc("GET /api/symbols", s.requireRole(model.RoleViewer, s.handleSymbols))
+	s.mux.HandleFunc("GET /api/ticks", s.requireRole(model.RoleViewer, s.handleTicks))
+	s.mux.HandleFunc("GET /api/ticks/{symbol}", s.requireRole(model.RoleViewer, s.handleTickHistory))
+	s.mux.HandleFunc("GET /api/candles/{symbol}", s.requireRole(model.RoleViewer, s.handleCandles))
+	s.mux.HandleFunc("GET /api/commands", s.requireRole(model.RoleViewer, s.handleCommands))
+	s.mux.HandleFunc("/api/command", s.requireRole(model.RoleOperator, s.strict(s.idempotent(s.handleCommand))))
+	s.mux.HandleFunc("POST /api/orders", s.requireRole(model.RoleOperator, s.strict(s.idempotent(s.handleOrderCreate))))
+	s.mux.HandleFunc("POST /api/positions/{ticket}/close", s.requireRole(model.RoleOperator, s.strict(s.idempotent(s.handlePositionClose))))
+	s.mux.HandleFunc("POST /api/accounts/{id}/{action}", s.requireRole(model.RoleOperator, s.strict(s.idempotent(s.handleAccountAction))))
+	s.mux.HandleFunc("GET /api/control", s.requireRole(model.RoleViewer, s.handleControlList))
+	s.mux.HandleFunc("POST /api/control/{action}", s.requireRole(model.RoleOperator, s.strict(s.idempotent(s.handleControlAction))))
+	s.mux.HandleFunc("GET /api/overrides", s.requireRole(model.RoleViewer, s.handleOverrideList))
+	s.mux.HandleFunc("GET /api/overrides/history", s.requireRole(model.RoleViewer, s.handleOverrideHistory))
+	s.mux.HandleFunc("POST /api/overrides", s.requireRole(model.RoleOperator, s.strict(s.idempotent(s.handleOverrideCreate))))
+	s.mux.HandleFunc("PATCH /api/overrides/{id}", s.requireRole(model.RoleOperator, s.handleOverrideUpdate))
+	s.mux.HandleFunc("DELETE /api/overrides/{id}", s.requireRole(model.RoleOperator, s.handleOverrideDelete))
+	s.mux.HandleFunc("GET /api/audit", s.requireRole(model.RoleOperator, s.handleAuditQuery))
+	s.mux.HandleFunc("GET /api/audit/verify", s.requireRole(model.RoleAdmin, s.handleAuditVerify))
+	s.mux.HandleFunc("/api/signal", s.strict(s.handleSignal))
+	s.mux.HandleFunc("GET /api/signal/{id}", s.requireRole(model.RoleViewer, s.handleSignalLookup))
+	s.mux.HandleFunc("GET /api/signal/sources", s.requireRole(model.RoleViewer, s.handleSignalSources))
+	s.mux.HandleFunc("POST /api/signal/sources/{name}/{action}", s.requireRole(model.RoleOperator, s.handleSignalSourceToggle))
 	s.mux.HandleFunc("/api/health", s.handleHealth)
-	s.mux.HandleFunc("/ws", s.handleWebSocket)
+	s.mux.HandleFunc("GET /api/metrics", s.requireRole(model.RoleViewer, s.handleAPIMetrics))
+	s.mux.HandleFunc("GET /metrics", s.handlePrometheus)
+	s.mux.HandleFunc("GET /healthz", s.handleHealth)
+	s.mux.HandleFunc("GET /readyz", s.handleReadyz)
+	s.mux.HandleFunc("/ws", s.requireRole(model.RoleViewer, s.handleWebSocket))
+
+	// Everything else is the dashboard. Registered without a method so it
+	// does not conflict with the method-less API routes.
+	if s.static != nil {
+		s.mux.Handle("/", s.static)
+	}
 }
 
 // Run starts the HTTP server and the WebSocket hub.
@@ -63,7 +194,7 @@ func (s *Server) Run(ctx context.Context) error {
 
 	s.srv = &http.Server{
 		Addr:    s.address,
-		Handler: corsMiddleware(s.mux),
+		Handler: corsMiddleware(s.ipRateLimit(s.mux)),
 	}
 
 	errCh := make(chan error, 1)
@@ -91,41 +222,15 @@ func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
-	data, err := s.engine.StatusJSON()
-	if err != nil {
-		writeJSON(w, http.StatusInternalServerError, model.APIResponse{
-			Error:     err.Error(),
-			Timestamp: time.Now(),
-		})
-		return
-	}
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	w.Write(data)
-}
-
-func (s *Server) handlePositions(w http.ResponseWriter, r *http.Request) {
-	data, err := s.engine.StatusJSON()
-	if err != nil {
-		writeJSON(w, http.StatusInternalServerError, model.APIResponse{
-			Error:     err.Error(),
-			Timestamp: time.Now(),
-		})
-		return
-	}
-	// Extract positions from status
-	var status map[string]json.RawMessage
-	json.Unmarshal(data, &status)
-	snapshot := status["snapshot"]
-	var snap map[string]json.RawMessage
-	json.Unmarshal(snapshot, &snap)
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	w.Write(snap["positions"])
+// handleAPIMetrics returns API request and rate limiting counters.
+func (s *Server) handleAPIMetrics(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, model.APIResponse{
+		Data:      s.RateLimitStats(),
+		Timestamp: time.Now(),
+	})
 }
 
-func (s *Server) handleAccounts(w http.ResponseWriter, r *http.Request) {
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
 	data, err := s.engine.StatusJSON()
 	if err != nil {
 		writeJSON(w, http.StatusInternalServerError, model.APIResponse{
@@ -134,14 +239,9 @@ func (s *Server) handleAccounts(w http.ResponseWriter, r *http.Request) {
 		})
 		return
 	}
-	var status map[string]json.RawMessage
-	json.Unmarshal(data, &status)
-	snapshot := status["snapshot"]
-	var snap map[string]json.RawMessage
-	json.Unmarshal(snapshot, &snap)
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	w.Write(snap["accounts"])
+	w.Write(data)
 }
 
 func (s *Server) handleGrids(w http.ResponseWriter, r *http.Request) {
@@ -158,6 +258,8 @@ func (s *Server) handleGrids(w http.ResponseWriter, r *http.Request) {
 	w.Write(data)
 }
 
+// handleCommand accepts a raw model.Command for backward compatibility.
+// It is validated like the typed endpoints and executed synchronously.
 func (s *Server) handleCommand(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		writeJSON(w, http.StatusMethodNotAllowed, model.APIResponse{
@@ -168,31 +270,18 @@ func (s *Server) handleCommand(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var cmd model.Command
-	if err := json.NewDecoder(r.Body).Decode(&cmd); err != nil {
-		writeJSON(w, http.StatusBadRequest, model.APIResponse{
-			Error:     "invalid JSON: " + err.Error(),
-			Timestamp: time.Now(),
-		})
+	if !decodeStrict(w, r, &cmd) {
 		return
 	}
-
-	cmd.Time = time.Now()
-	s.engine.PushCommand(cmd)
-
-	s.logger.Info("api_command",
-		zap.String("type", string(cmd.Type)),
-		zap.String("symbol", cmd.Symbol),
-		zap.String("account", cmd.AccountID),
-	)
-
-	writeJSON(w, http.StatusOK, model.APIResponse{
-		Data:      map[string]string{"status": "queued"},
-		Timestamp: time.Now(),
-	})
+	if errs := validateCommand(&cmd, s.limits); len(errs) > 0 {
+		writeError(w, http.StatusBadRequest, "VALIDATION_FAILED", "invalid command", errs)
+		return
+	}
+	s.execute(w, r, cmd)
 }
 
 func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
-	s.hub.HandleUpgrade(w, r)
+	s.hub.HandleUpgrade(w, r, s.Handler())
 }
 
 func writeJSON(w http.ResponseWriter, status int, data any) {
@@ -204,7 +293,7 @@ func writeJSON(w http.ResponseWriter, status int, data any) {
 func corsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
 		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
 		if r.Method == http.MethodOptions {
 			w.WriteHeader(http.StatusNoContent)
@@ -214,90 +303,279 @@ func corsMiddleware(next http.Handler) http.Handler {
 	})
 }
 
-// Hub manages WebSocket client connections and broadcasting.
+// Hub manages WebSocket client connections and broadcasting. Messages
+// are matched against each client's subscription and pushed onto its
+// bounded queue (see wsQueue); a slow client loses its oldest high-rate
+// messages instead of blocking the hub or being disconnected.
 type Hub struct {
-	clients    map[*WSClient]bool
-	broadcast  chan []byte
-	register   chan *WSClient
-	unregister chan *WSClient
-	mu         sync.RWMutex
-	logger     *zap.Logger
+	clients     map[*WSClient]bool
+	subscribers map[*Subscriber]bool
+	mu          sync.RWMutex
+	logger      *zap.Logger
+	opts        wsOptions
+	dropped     atomic.Int64
+
+	// snapshot returns the full engine status for resync requests.
+	snapshot func() ([]byte, error)
+
+	// sessionOf resolves a request's login session; sessionLive reports
+	// whether one still is. Clients and subscribers of ended sessions
+	// (logout, revoke, disabled or deleted user) are closed.
+	sessionOf   func(r *http.Request) (string, error)
+	sessionLive func(id string) bool
+
+	// Throttled topics keep only the newest event per topic, account and
+	// symbol until the next flush.
+	throttle time.Duration
+	latestMu sync.Mutex
+	latest   map[string]engine.Event
 }
 
-// NewHub creates a WebSocket hub.
-func NewHub(logger *zap.Logger) *Hub {
+// NewHub creates a WebSocket hub. Throttled topics are sent at most once
+// per cfg.ThrottleMs (0 sends every event). snapshot serves resync
+// requests.
+func NewHub(cfg config.WebSocketConfig, snapshot func() ([]byte, error), logger *zap.Logger) *Hub {
 	return &Hub{
-		clients:    make(map[*WSClient]bool),
-		broadcast:  make(chan []byte, 256),
-		register:   make(chan *WSClient),
-		unregister: make(chan *WSClient),
-		logger:     logger,
+		clients:     make(map[*WSClient]bool),
+		subscribers: make(map[*Subscriber]bool),
+		logger:      logger,
+		opts:        newWSOptions(cfg),
+		snapshot:    snapshot,
+		throttle:    time.Duration(cfg.ThrottleMs) * time.Millisecond,
+		latest:      make(map[string]engine.Event),
 	}
 }
 
-// Broadcast sends a message to all connected clients.
+// Broadcast sends a message to all clients subscribed to msgType.
 func (h *Hub) Broadcast(msgType string, data any) {
-	msg := model.WSMessage{
-		Type:      msgType,
-		Data:      data,
-		Timestamp: time.Now(),
+	h.deliver(engine.Event{Topic: msgType, Data: data, Time: time.Now()})
+}
+
+// Publish forwards an engine event to subscribed clients. It is the
+// engine's event sink and never blocks.
+func (h *Hub) Publish(ev engine.Event) {
+	if h.Idle() {
+		return
 	}
-	buf, err := json.Marshal(msg)
-	if err != nil {
+	if h.throttle > 0 && throttledTopics[ev.Topic] {
+		h.latestMu.Lock()
+		h.latest[ev.Topic+"|"+ev.AccountID+"|"+ev.Symbol] = ev
+		h.latestMu.Unlock()
 		return
 	}
-	select {
-	case h.broadcast <- buf:
-	default:
-		// Drop if channel full
+	h.deliver(ev)
+}
+
+// encode builds the WebSocket message for one event.
+func (h *Hub) encode(ev engine.Event) ([]byte, bool) {
+	buf, err := json.Marshal(model.WSMessage{
+		Type:      ev.Topic,
+		Data:      ev.Data,
+		Timestamp: ev.Time,
+	})
+	if err != nil {
+		h.logger.Debug("ws_encode_failed", zap.String("topic", ev.Topic), zap.Error(err))
+		return nil, false
 	}
+	return buf, true
 }
 
-// ClientCount returns the number of connected clients.
+// ClientCount returns the number of connected WebSocket clients.
 func (h *Hub) ClientCount() int {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
 	return len(h.clients)
 }
 
-// Run processes hub events.
+// Idle reports whether nobody is listening, neither WebSocket clients nor
+// in-process subscribers.
+func (h *Hub) Idle() bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.clients) == 0 && len(h.subscribers) == 0
+}
+
+// Dropped returns how many queued messages were evicted from slow
+// clients' queues.
+func (h *Hub) Dropped() int64 {
+	return h.dropped.Load()
+}
+
+// Run flushes throttled topics and, every ping interval, closes the
+// clients and subscribers whose session ended, until ctx is cancelled.
 func (h *Hub) Run(ctx context.Context) {
+	var flush <-chan time.Time
+	if h.throttle > 0 {
+		ticker := time.NewTicker(h.throttle)
+		defer ticker.Stop()
+		flush = ticker.C
+	}
+	revalidate := time.NewTicker(h.opts.pingInterval)
+	defer revalidate.Stop()
 	for {
 		select {
 		case <-ctx.Done():
 			return
-		case client := <-h.register:
-			h.mu.Lock()
-			h.clients[client] = true
-			h.mu.Unlock()
-			h.logger.Info("ws_client_connected", zap.Int("total", len(h.clients)))
-		case client := <-h.unregister:
-			h.mu.Lock()
-			if _, ok := h.clients[client]; ok {
-				delete(h.clients, client)
-				close(client.send)
-			}
-			h.mu.Unlock()
-			h.logger.Info("ws_client_disconnected", zap.Int("total", len(h.clients)))
-		case msg := <-h.broadcast:
-			h.mu.RLock()
-			for client := range h.clients {
-				select {
-				case client.send <- msg:
-				default:
-					go func(c *WSClient) {
-						h.unregister <- c
-					}(client)
-				}
+		case <-flush:
+			h.flushLatest()
+		case <-revalidate.C:
+			h.CloseEndedSessions()
+		}
+	}
+}
+
+// SessionID returns the login session of an authenticated request, for
+// tagging a subscriber.
+func (h *Hub) SessionID(r *http.Request) (string, error) {
+	if h.sessionOf == nil {
+		return "", nil
+	}
+	return h.sessionOf(r)
+}
+
+// CloseEndedSessions closes every client and subscriber whose login
+// session is no longer live. It runs every ping interval and right after
+// a session or user is revoked.
+func (h *Hub) CloseEndedSessions() {
+	if h.sessionLive == nil {
+		return
+	}
+	live := make(map[string]bool)
+	check := func(id string) bool {
+		if id == "" {
+			return true
+		}
+		ok, seen := live[id]
+		if !seen {
+			ok = h.sessionLive(id)
+			live[id] = ok
+		}
+		return ok
+	}
+
+	var clients []*WSClient
+	var subs []*Subscriber
+	h.mu.RLock()
+	for c := range h.clients {
+		if !check(c.sessionID) {
+			clients = append(clients, c)
+		}
+	}
+	for s := range h.subscribers {
+		if !check(s.sessionID) {
+			subs = append(subs, s)
+		}
+	}
+	h.mu.RUnlock()
+
+	for _, c := range clients {
+		h.logger.Info("ws_client_session_ended", zap.String("remote", c.remoteAddr))
+		h.unregister(c)
+	}
+	for _, s := range subs {
+		s.revoked.Store(true)
+		s.Close()
+	}
+}
+
+// register adds a connected client.
+func (h *Hub) register(c *WSClient) {
+	h.mu.Lock()
+	h.clients[c] = true
+	total := len(h.clients)
+	h.mu.Unlock()
+	h.logger.Info("ws_client_connected", zap.Int("total", total))
+}
+
+// unregister removes a client and closes its queue, which makes the
+// writer start the close handshake.
+func (h *Hub) unregister(c *WSClient) {
+	h.mu.Lock()
+	_, ok := h.clients[c]
+	if ok {
+		delete(h.clients, c)
+		c.queue.close()
+	}
+	total := len(h.clients)
+	h.mu.Unlock()
+	if ok {
+		h.logger.Info("ws_client_disconnected", zap.Int("total", total))
+	}
+}
+
+// deliver queues an event for every client and subscriber whose
+// subscription matches. It is encoded once, when the first WebSocket
+// client wants it.
+func (h *Hub) deliver(ev engine.Event) {
+	msg := hubMessage{topic: ev.Topic, accountID: ev.AccountID, symbol: ev.Symbol}
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for client := range h.clients {
+		if !client.sub.matches(msg) {
+			continue
+		}
+		if msg.data == nil {
+			var ok bool
+			if msg.data, ok = h.encode(ev); !ok {
+				break
 			}
-			h.mu.RUnlock()
+		}
+		if client.queue.push(msg) {
+			h.dropped.Add(1)
+		}
+	}
+	for sub := range h.subscribers {
+		if sub.sub.matches(msg) && sub.push(ev) {
+			h.dropped.Add(1)
 		}
 	}
 }
 
+// flushLatest delivers the coalesced events of throttled topics.
+func (h *Hub) flushLatest() {
+	h.latestMu.Lock()
+	pending := h.latest
+	if len(pending) > 0 {
+		h.latest = make(map[string]engine.Event, len(pending))
+	}
+	h.latestMu.Unlock()
+	for _, ev := range pending {
+		h.deliver(ev)
+	}
+}
+
+// setSubscription replaces a client's subscription.
+func (h *Hub) setSubscription(c *WSClient, sub subscription) {
+	h.mu.Lock()
+	c.sub = sub
+	h.mu.Unlock()
+}
+
 // HandleUpgrade upgrades an HTTP connection to a WebSocket connection.
-// Uses a simple frame-based WebSocket implementation.
-func (h *Hub) HandleUpgrade(w http.ResponseWriter, r *http.Request) {
+// Uses a simple frame-based WebSocket implementation (see websocket.go).
+// The query selects the topics and the account/symbol filters (see
+// parseSubscription); requests the client sends are served by rpc.
+func (h *Hub) HandleUpgrade(w http.ResponseWriter, r *http.Request, rpc http.Handler) {
+	if status, msg := wsCheckRequest(r, h.opts); status != http.StatusOK {
+		if status == http.StatusUpgradeRequired {
+			w.Header().Set("Sec-WebSocket-Version", "13")
+		}
+		http.Error(w, msg, status)
+		return
+	}
+	sub, errs := parseSubscription(r.URL.Query())
+	if len(errs) > 0 {
+		writeError(w, http.StatusBadRequest, "VALIDATION_FAILED", "invalid subscription", errs)
+		return
+	}
+	deflate := h.opts.compression && negotiateDeflate(r)
+	p, _ := userFrom(r)
+	token, err := requestToken(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
 	// Use hijacker for raw WebSocket
 	hj, ok := w.(http.Hijacker)
 	if !ok {
@@ -312,17 +590,30 @@ func (h *Hub) HandleUpgrade(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Perform WebSocket handshake
-	if err := wsHandshake(r, bufrw); err != nil {
+	if err := wsHandshake(r, bufrw, deflate); err != nil {
 		conn.Close()
 		return
 	}
+	conn.SetDeadline(time.Time{})
 
 	client := &WSClient{
-		hub:  h,
-		conn: conn,
-		send: make(chan []byte, 256),
+		hub: h,
+		ws: &wsConn{
+			conn:    conn,
+			r:       bufrw.Reader,
+			opts:    h.opts,
+			deflate: deflate,
+		},
+		queue: newWSQueue(h.opts.queueSize),
+		sub:   sub,
+
+		rpc:        rpc,
+		remoteAddr: r.RemoteAddr,
+		sessionID:  p.SessionID,
+		inflight:   make(chan struct{}, rpcMaxInflight),
+		token:      token,
 	}
-	h.register <- client
+	h.register(client)
 
 	go client.writePump()
 	go client.readPump()
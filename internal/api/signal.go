@@ -0,0 +1,394 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go-trade/internal/engine"
+	"go-trade/internal/model"
+
+	"go.uber.org/zap"
+)
+
+// signalReplayWindow bounds how far a signal timestamp may drift from the
+// server clock, and how long nonces are remembered.
+const signalReplayWindow = 5 * time.Minute
+
+// maxSignalBody caps the webhook payload size.
+const maxSignalBody = 64 << 10
+
+// signalPayload is the TradingView-style webhook body.
+type signalPayload struct {
+	ID        string          `json:"id"`
+	Secret    string          `json:"secret"`
+	Timestamp json.RawMessage `json:"timestamp"`
+	Nonce     string          `json:"nonce"`
+	Source    string          `json:"source"`
+	Symbol    string          `json:"symbol"`
+	Ticker    string          `json:"ticker"`
+	Action    string          `json:"action"`
+	Side      string          `json:"side"`
+	Score     float64         `json:"score"`
+	AccountID string          `json:"accountId"`
+}
+
+// signalVerifier authenticates webhook signals and rejects replays.
+type signalVerifier struct {
+	secret string
+	mu     sync.Mutex
+	nonces map[string]time.Time
+}
+
+// newSignalVerifier creates a verifier for the configured shared secret.
+func newSignalVerifier(secret string) *signalVerifier {
+	return &signalVerifier{
+		secret: secret,
+		nonces: make(map[string]time.Time),
+	}
+}
+
+// authenticate checks the request either by HMAC-SHA256 signature of the
+// raw body (X-Signature header, hex, optional "sha256=" prefix) or by the
+// shared secret in the X-Signal-Secret header or the payload.
+func (v *signalVerifier) authenticate(r *http.Request, body []byte, payload signalPayload) error {
+	if v.secret == "" {
+		return errors.New("signal secret not configured")
+	}
+	if sig := r.Header.Get("X-Signature"); sig != "" {
+		sig = strings.TrimPrefix(sig, "sha256=")
+		got, err := hex.DecodeString(sig)
+		if err != nil {
+			return errors.New("malformed signature")
+		}
+		mac := hmac.New(sha256.New, []byte(v.secret))
+		mac.Write(body)
+		if !hmac.Equal(got, mac.Sum(nil)) {
+			return errors.New("invalid signature")
+		}
+		return nil
+	}
+	secret := r.Header.Get("X-Signal-Secret")
+	if secret == "" {
+		secret = payload.Secret
+	}
+	if secret == "" || subtle.ConstantTimeCompare([]byte(secret), []byte(v.secret)) != 1 {
+		return errors.New("invalid secret")
+	}
+	return nil
+}
+
+// checkReplay rejects stale timestamps and previously seen nonces. It
+// does not record the nonce; claimNonce does, once the payload is valid.
+func (v *signalVerifier) checkReplay(ts time.Time, nonce string, now time.Time) error {
+	if ts.IsZero() {
+		return errors.New("timestamp required")
+	}
+	if d := now.Sub(ts); d > signalReplayWindow || d < -signalReplayWindow {
+		return fmt.Errorf("timestamp outside %s window", signalReplayWindow)
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if _, ok := v.nonces[nonce]; ok {
+		return errors.New("replayed signal")
+	}
+	return nil
+}
+
+// claimNonce records nonce as used, failing if a concurrent request with
+// the same nonce claimed it first.
+func (v *signalVerifier) claimNonce(nonce string, now time.Time) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for n, seen := range v.nonces {
+		if now.Sub(seen) > 2*signalReplayWindow {
+			delete(v.nonces, n)
+		}
+	}
+	if _, ok := v.nonces[nonce]; ok {
+		return errors.New("replayed signal")
+	}
+	v.nonces[nonce] = now
+	return nil
+}
+
+// releaseNonce forgets a claimed nonce, so a signal the engine could not
+// queue may be resent.
+func (v *signalVerifier) releaseNonce(nonce string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	delete(v.nonces, nonce)
+}
+
+// handleSignal accepts a webhook signal, verifies it and queues it.
+func (s *Server) handleSignal(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, model.APIResponse{
+			Error:     "POST required",
+			Timestamp: time.Now(),
+		})
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxSignalBody+1))
+	if err != nil || len(body) > maxSignalBody {
+		writeJSON(w, http.StatusRequestEntityTooLarge, model.APIResponse{
+			Error:     "payload too large",
+			Timestamp: time.Now(),
+		})
+		return
+	}
+
+	var payload signalPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		writeJSON(w, http.StatusBadRequest, model.APIResponse{
+			Error:     "invalid JSON: " + err.Error(),
+			Timestamp: time.Now(),
+		})
+		return
+	}
+
+	if err := s.signals.authenticate(r, body, payload); err != nil {
+		s.logger.Warn("signal_auth_failed", zap.String("remote", r.RemoteAddr), zap.Error(err))
+		writeJSON(w, http.StatusUnauthorized, model.APIResponse{
+			Error:     err.Error(),
+			Timestamp: time.Now(),
+		})
+		return
+	}
+
+	now := time.Now()
+	ts, err := parseSignalTime(payload.Timestamp)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, model.APIResponse{
+			Error:     err.Error(),
+			Timestamp: now,
+		})
+		return
+	}
+	nonce := payload.Nonce
+	if nonce == "" {
+		nonce = payload.ID
+	}
+	if nonce == "" {
+		sum := sha256.Sum256(body)
+		nonce = hex.EncodeToString(sum[:])
+	}
+	if err := s.signals.checkReplay(ts, nonce, now); err != nil {
+		s.logger.Warn("signal_replay_rejected", zap.String("nonce", nonce), zap.Error(err))
+		writeJSON(w, http.StatusConflict, model.APIResponse{
+			Error:     err.Error(),
+			Timestamp: now,
+		})
+		return
+	}
+
+	sig, err := payload.toSignal(body, ts)
+	if err != nil {
+		writeJSON(w, http.StatusUnprocessableEntity, model.APIResponse{
+			Error:     err.Error(),
+			Timestamp: now,
+		})
+		return
+	}
+
+	if err := s.signals.claimNonce(nonce, now); err != nil {
+		s.logger.Warn("signal_replay_rejected", zap.String("nonce", nonce), zap.Error(err))
+		writeJSON(w, http.StatusConflict, model.APIResponse{
+			Error:     err.Error(),
+			Timestamp: now,
+		})
+		return
+	}
+
+	if err := s.engine.PushSignal(sig); err != nil {
+		status := http.StatusServiceUnavailable
+		if errors.Is(err, engine.ErrDuplicateSignal) {
+			status = http.StatusConflict
+		} else {
+			s.signals.releaseNonce(nonce)
+		}
+		s.logger.Warn("signal_not_queued", zap.String("id", sig.ID), zap.Error(err))
+		writeJSON(w, status, model.APIResponse{
+			Error:     err.Error(),
+			Timestamp: now,
+		})
+		return
+	}
+
+	s.logger.Info("api_signal",
+		zap.String("id", sig.ID),
+		zap.String("source", sig.Source),
+		zap.String("symbol", sig.Symbol),
+		zap.String("action", string(sig.Action)),
+		zap.String("side", string(sig.Side)),
+	)
+
+	writeJSON(w, http.StatusAccepted, model.APIResponse{
+		Data:      map[string]string{"id": sig.ID, "status": "queued"},
+		Timestamp: now,
+	})
+}
+
+// handleSignalLookup returns a previously received signal by ID.
+func (s *Server) handleSignalLookup(w http.ResponseWriter, r *http.Request) {
+	sig, ok := s.engine.SignalByID(r.PathValue("id"))
+	if !ok {
+		writeJSON(w, http.StatusNotFound, model.APIResponse{
+			Error:     "signal not found",
+			Timestamp: time.Now(),
+		})
+		return
+	}
+	writeJSON(w, http.StatusOK, model.APIResponse{
+		Data:      sig,
+		Timestamp: time.Now(),
+	})
+}
+
+// handleSignalSources returns per-source signal performance.
+func (s *Server) handleSignalSources(w http.ResponseWriter, r *http.Request) {
+	data, err := s.engine.SignalSourcesJSON()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, model.APIResponse{
+			Error:     err.Error(),
+			Timestamp: time.Now(),
+		})
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+// handleSignalSourceToggle enables or disables a signal source.
+func (s *Server) handleSignalSourceToggle(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	var enabled bool
+	switch r.PathValue("action") {
+	case "enable":
+		enabled = true
+	case "disable":
+		enabled = false
+	default:
+		writeJSON(w, http.StatusNotFound, model.APIResponse{
+			Error:     "action must be enable or disable",
+			Timestamp: time.Now(),
+		})
+		return
+	}
+	s.engine.SetSignalSourceEnabled(name, enabled)
+	s.recordOperator(r, "SIGNAL_SOURCE_"+strings.ToUpper(r.PathValue("action")), "", map[string]string{"source": name})
+	writeJSON(w, http.StatusOK, model.APIResponse{
+		Data:      map[string]any{"source": name, "enabled": enabled},
+		Timestamp: time.Now(),
+	})
+}
+
+// toSignal maps a webhook payload onto model.Signal.
+func (p signalPayload) toSignal(body []byte, ts time.Time) (model.Signal, error) {
+	symbol := strings.ToUpper(strings.TrimSpace(p.Symbol))
+	if symbol == "" {
+		symbol = strings.ToUpper(strings.TrimSpace(p.Ticker))
+	}
+	if symbol == "" {
+		return model.Signal{}, errors.New("symbol or ticker required")
+	}
+
+	sig := model.Signal{
+		ID:        p.ID,
+		Source:    p.Source,
+		Symbol:    symbol,
+		Score:     p.Score,
+		Side:      model.Side(strings.ToUpper(p.Side)),
+		Time:      ts,
+		AccountID: p.AccountID,
+	}
+	if sig.Source == "" {
+		sig.Source = "webhook"
+	}
+
+	switch strings.ToLower(strings.TrimSpace(p.Action)) {
+	case "buy", "long":
+		sig.Action = model.CommandOpen
+		sig.Side = model.SideBuy
+	case "sell", "short":
+		sig.Action = model.CommandOpen
+		sig.Side = model.SideSell
+	case "open", "entry":
+		sig.Action = model.CommandOpen
+	case "close", "exit", "flat":
+		sig.Action = model.CommandClose
+	case "":
+		if sig.Side == "" && p.Score == 0 {
+			return model.Signal{}, errors.New("action, side or score required")
+		}
+	default:
+		return model.Signal{}, fmt.Errorf("unknown action %q", p.Action)
+	}
+	if sig.Side != "" && sig.Side != model.SideBuy && sig.Side != model.SideSell {
+		return model.Signal{}, fmt.Errorf("unknown side %q", p.Side)
+	}
+	if sig.Action == model.CommandOpen && sig.Side == "" {
+		return model.Signal{}, errors.New("side required for open")
+	}
+
+	var raw map[string]any
+	if err := json.Unmarshal(body, &raw); err == nil {
+		delete(raw, "secret")
+		sig.Raw = raw
+	}
+
+	if sig.ID == "" {
+		id, err := newSignalID()
+		if err != nil {
+			return model.Signal{}, err
+		}
+		sig.ID = id
+	}
+	return sig, nil
+}
+
+// parseSignalTime accepts unix seconds, unix milliseconds or RFC3339.
+func parseSignalTime(raw json.RawMessage) (time.Time, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return time.Time{}, errors.New("timestamp required")
+	}
+	var str string
+	if err := json.Unmarshal(raw, &str); err != nil {
+		str = string(raw)
+	}
+	str = strings.TrimSpace(str)
+	if n, err := strconv.ParseInt(str, 10, 64); err == nil {
+		if n > 1e12 {
+			return time.UnixMilli(n), nil
+		}
+		return time.Unix(n, 0), nil
+	}
+	ts, err := time.Parse(time.RFC3339, str)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid timestamp %q", str)
+	}
+	return ts, nil
+}
+
+// newSignalID returns a random signal identifier.
+func newSignalID() (string, error) {
+	buf := make([]byte, 12)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("generating signal id: %w", err)
+	}
+	return "sig_" + hex.EncodeToString(buf), nil
+}
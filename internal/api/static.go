@@ -0,0 +1,228 @@
+package api
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+
+	"go-trade/web"
+
+	"go.uber.org/zap"
+)
+
+// gzipMinBytes is the smallest file compressed on the fly.
+const gzipMinBytes = 1024
+
+// maxGzipCache bounds the on-the-fly gzip cache; it is reset when full.
+const maxGzipCache = 512
+
+// compressible lists the extensions worth compressing.
+var compressible = map[string]bool{
+	".html": true, ".js": true, ".mjs": true, ".css": true, ".json": true,
+	".svg": true, ".txt": true, ".xml": true, ".map": true, ".webmanifest": true,
+}
+
+// staticHandler serves the dashboard's static Next.js export. Routes
+// without a file fall back to index.html so client-side routing works;
+// missing assets get 404.html. Hashed build assets under _next/static/
+// are cached for a year, everything else is revalidated by ETag.
+// Precompressed name.br and name.gz files are preferred; otherwise text
+// assets are gzipped on the fly and cached.
+type staticHandler struct {
+	fsys fs.FS
+
+	mu  sync.Mutex
+	gzs map[string][]byte // ETag → gzipped body
+}
+
+// dashboardFS returns the embedded dashboard build when the binary was
+// built with the embeddash tag, else the directory at staticPath.
+func dashboardFS(staticPath string, logger *zap.Logger) fs.FS {
+	fsys, source := web.Dist, "embedded"
+	if fsys == nil {
+		fsys, source = os.DirFS(staticPath), staticPath
+	}
+	if _, err := fs.Stat(fsys, "index.html"); err != nil {
+		logger.Warn("dashboard_build_missing", zap.String("source", source),
+			zap.String("hint", "run `npm run build` in web/"))
+	} else {
+		logger.Info("dashboard_serving", zap.String("source", source))
+	}
+	return fsys
+}
+
+func newStaticHandler(fsys fs.FS) *staticHandler {
+	return &staticHandler{fsys: fsys, gzs: make(map[string][]byte)}
+}
+
+func (h *staticHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Unmatched API paths must not turn into the dashboard page.
+	if strings.HasPrefix(r.URL.Path, "/api/") || r.URL.Path == "/ws" {
+		writeError(w, http.StatusNotFound, "NOT_FOUND", "no such route", nil)
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name, status := h.resolve(r.URL.Path)
+	if name == "" {
+		http.NotFound(w, r)
+		return
+	}
+	data, err := fs.ReadFile(h.fsys, name)
+	if err != nil {
+		http.Error(w, "read failed", http.StatusInternalServerError)
+		return
+	}
+
+	sum := sha256.Sum256(data)
+	etag := `W/"` + hex.EncodeToString(sum[:12]) + `"`
+	hdr := w.Header()
+	hdr.Set("Content-Type", contentType(name, data))
+	hdr.Set("X-Content-Type-Options", "nosniff")
+	hdr.Set("ETag", etag)
+	if strings.HasPrefix(name, "_next/static/") {
+		hdr.Set("Cache-Control", "public, max-age=31536000, immutable")
+	} else {
+		hdr.Set("Cache-Control", "no-cache")
+	}
+	if status == http.StatusOK && etagMatch(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	if compressible[path.Ext(name)] {
+		hdr.Add("Vary", "Accept-Encoding")
+		if body, enc := h.encoded(r, name, etag, data); enc != "" {
+			hdr.Set("Content-Encoding", enc)
+			data = body
+		}
+	}
+	hdr.Set("Content-Length", strconv.Itoa(len(data)))
+	w.WriteHeader(status)
+	if r.Method != http.MethodHead {
+		w.Write(data)
+	}
+}
+
+// resolve maps a URL path to a file and the status to serve it with:
+// the file itself, name.html, name/index.html, index.html for routes
+// (paths without an extension) and 404.html for anything else.
+func (h *staticHandler) resolve(urlPath string) (string, int) {
+	p := strings.TrimPrefix(path.Clean("/"+urlPath), "/")
+	if p == "" {
+		p = "index.html"
+	}
+	for _, name := range []string{p, p + ".html", path.Join(p, "index.html")} {
+		if h.isFile(name) {
+			return name, http.StatusOK
+		}
+	}
+	if path.Ext(p) == "" && h.isFile("index.html") {
+		return "index.html", http.StatusOK
+	}
+	if h.isFile("404.html") {
+		return "404.html", http.StatusNotFound
+	}
+	return "", http.StatusNotFound
+}
+
+func (h *staticHandler) isFile(name string) bool {
+	info, err := fs.Stat(h.fsys, name)
+	return err == nil && info.Mode().IsRegular()
+}
+
+// encoded returns the body in the best encoding the client accepts: a
+// precompressed .br or .gz file, or gzip made on the fly. enc is empty
+// when the identity body should be sent.
+func (h *staticHandler) encoded(r *http.Request, name, etag string, data []byte) (body []byte, enc string) {
+	accept := r.Header.Get("Accept-Encoding")
+	for _, c := range []struct{ enc, ext string }{{"br", ".br"}, {"gzip", ".gz"}} {
+		if !acceptsEncoding(accept, c.enc) {
+			continue
+		}
+		if b, err := fs.ReadFile(h.fsys, name+c.ext); err == nil {
+			return b, c.enc
+		}
+	}
+	if len(data) < gzipMinBytes || !acceptsEncoding(accept, "gzip") {
+		return nil, ""
+	}
+
+	h.mu.Lock()
+	gz, ok := h.gzs[etag]
+	h.mu.Unlock()
+	if !ok {
+		var buf bytes.Buffer
+		zw, _ := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+		zw.Write(data)
+		zw.Close()
+		gz = buf.Bytes()
+		h.mu.Lock()
+		if len(h.gzs) >= maxGzipCache {
+			h.gzs = make(map[string][]byte)
+		}
+		h.gzs[etag] = gz
+		h.mu.Unlock()
+	}
+	return gz, "gzip"
+}
+
+// contentType picks the Content-Type by extension, sniffing otherwise.
+func contentType(name string, data []byte) string {
+	if ct := mime.TypeByExtension(path.Ext(name)); ct != "" {
+		return ct
+	}
+	return http.DetectContentType(data)
+}
+
+// acceptsEncoding reports whether an Accept-Encoding value allows enc,
+// honouring q=0 and the "*" wildcard.
+func acceptsEncoding(header, enc string) bool {
+	wildcard := false
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		refused := false
+		for _, p := range strings.Split(params, ";") {
+			if k, v, ok := strings.Cut(strings.TrimSpace(p), "="); ok && strings.EqualFold(k, "q") {
+				q, err := strconv.ParseFloat(v, 64)
+				refused = err == nil && q == 0
+			}
+		}
+		switch {
+		case strings.EqualFold(name, enc):
+			return !refused
+		case name == "*":
+			wildcard = !refused
+		}
+	}
+	return wildcard
+}
+
+// etagMatch reports whether an If-None-Match value names etag. Weak
+// comparison is used, as for GET.
+func etagMatch(header, etag string) bool {
+	if header == "" {
+		return false
+	}
+	want := strings.TrimPrefix(etag, "W/")
+	for _, part := range strings.Split(header, ",") {
+		part = strings.TrimSpace(part)
+		if part == "*" || strings.TrimPrefix(part, "W/") == want {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,215 @@
+package api
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	"go-trade/internal/engine"
+	"go-trade/internal/model"
+)
+
+// wsTopics lists the topics a WebSocket client may subscribe to.
+var wsTopics = map[string]bool{
+	model.TopicStatus:   true,
+	model.TopicTick:     true,
+	model.TopicPosition: true,
+	model.TopicAccount:  true,
+	model.TopicGuard:    true,
+	model.TopicCommand:  true,
+	model.TopicSignal:   true,
+	model.TopicAlert:    true,
+}
+
+// throttledTopics are high-rate topics the hub coalesces to the newest
+// event per account/symbol once per throttle interval.
+var throttledTopics = map[string]bool{
+	model.TopicTick:    true,
+	model.TopicAccount: true,
+}
+
+// hubMessage is an encoded WSMessage with the keys clients filter on.
+type hubMessage struct {
+	topic     string
+	accountID string
+	symbol    string
+	data      []byte
+}
+
+// subscription selects the messages a client receives. Nil account and
+// symbol sets match everything, and messages without an account or symbol
+// pass those filters.
+type subscription struct {
+	topics   map[string]bool
+	accounts map[string]bool
+	symbols  map[string]bool
+}
+
+// parseSubscription reads the topics, account and symbol query parameters,
+// each a comma-separated list or repeated. Without topics the client gets
+// the status snapshot only; "all" selects every topic.
+func parseSubscription(q url.Values) (subscription, []model.FieldError) {
+	var errs []model.FieldError
+	sub := subscription{topics: make(map[string]bool)}
+	for _, t := range splitParams(q["topics"]) {
+		t = strings.ToLower(t)
+		switch {
+		case t == "all":
+			for name := range wsTopics {
+				sub.topics[name] = true
+			}
+		case wsTopics[t]:
+			sub.topics[t] = true
+		default:
+			errs = append(errs, model.FieldError{Field: "topics", Message: "unknown topic " + t + ", want one of " + topicList()})
+		}
+	}
+	if len(sub.topics) == 0 {
+		sub.topics[model.TopicStatus] = true
+	}
+	for _, a := range splitParams(q["account"]) {
+		if sub.accounts == nil {
+			sub.accounts = make(map[string]bool)
+		}
+		sub.accounts[a] = true
+	}
+	for _, s := range splitParams(q["symbol"]) {
+		s = strings.ToUpper(s)
+		if !symbolPattern.MatchString(s) {
+			errs = append(errs, model.FieldError{Field: "symbol", Message: "must be a broker symbol like EURUSD"})
+			continue
+		}
+		if sub.symbols == nil {
+			sub.symbols = make(map[string]bool)
+		}
+		sub.symbols[s] = true
+	}
+	return sub, errs
+}
+
+// matches reports whether m is selected by the subscription.
+func (s subscription) matches(m hubMessage) bool {
+	if !s.topics[m.topic] {
+		return false
+	}
+	if m.accountID != "" && s.accounts != nil && !s.accounts[m.accountID] {
+		return false
+	}
+	if m.symbol != "" && s.symbols != nil && !s.symbols[m.symbol] {
+		return false
+	}
+	return true
+}
+
+// subscriptionView is the JSON form of a subscription.
+type subscriptionView struct {
+	Topics   []string `json:"topics"`
+	Accounts []string `json:"accounts,omitempty"`
+	Symbols  []string `json:"symbols,omitempty"`
+}
+
+// view lists the subscription's sets in sorted order.
+func (s subscription) view() subscriptionView {
+	return subscriptionView{
+		Topics:   sortedKeys(s.topics),
+		Accounts: sortedKeys(s.accounts),
+		Symbols:  sortedKeys(s.symbols),
+	}
+}
+
+// sortedKeys returns the keys of a set in order.
+func sortedKeys(set map[string]bool) []string {
+	if len(set) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// splitParams flattens repeated and comma-separated query values.
+func splitParams(values []string) []string {
+	var out []string
+	for _, v := range values {
+		for _, part := range strings.Split(v, ",") {
+			if part = strings.TrimSpace(part); part != "" {
+				out = append(out, part)
+			}
+		}
+	}
+	return out
+}
+
+// topicList names the known topics for error messages.
+func topicList() string {
+	return strings.Join(sortedKeys(wsTopics), ", ")
+}
+
+// Subscriber receives engine events in-process, for transports other than
+// WebSocket. Its buffer drops the oldest event when full; drops count
+// towards Hub.Dropped.
+type Subscriber struct {
+	hub       *Hub
+	sub       subscription
+	ch        chan engine.Event
+	sessionID string
+	revoked   atomic.Bool
+}
+
+// Subscribe registers a subscriber of login session sessionID for the
+// given topics, accounts and symbols, validated like the /ws query. size
+// bounds its buffer. The subscriber is closed when the session ends.
+func (h *Hub) Subscribe(sessionID string, topics, accounts, symbols []string, size int) (*Subscriber, []model.FieldError) {
+	sub, errs := parseSubscription(url.Values{"topics": topics, "account": accounts, "symbol": symbols})
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	s := &Subscriber{hub: h, sub: sub, ch: make(chan engine.Event, max(size, 1)), sessionID: sessionID}
+	h.mu.Lock()
+	h.subscribers[s] = true
+	h.mu.Unlock()
+	return s, nil
+}
+
+// Events returns the event channel. It is closed by Close.
+func (s *Subscriber) Events() <-chan engine.Event {
+	return s.ch
+}
+
+// Revoked reports whether the subscriber was closed because its login
+// session ended.
+func (s *Subscriber) Revoked() bool {
+	return s.revoked.Load()
+}
+
+// Close unregisters the subscriber and closes its channel.
+func (s *Subscriber) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	if s.hub.subscribers[s] {
+		delete(s.hub.subscribers, s)
+		close(s.ch)
+	}
+}
+
+// push buffers an event, dropping the oldest when full. Reports whether
+// an event was dropped. Caller holds hub.mu for reading.
+func (s *Subscriber) push(ev engine.Event) bool {
+	dropped := false
+	for {
+		select {
+		case s.ch <- ev:
+			return dropped
+		default:
+		}
+		select {
+		case <-s.ch:
+			dropped = true
+		default:
+		}
+	}
+}
@@ -0,0 +1,226 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"go-trade/internal/auth"
+	"go-trade/internal/model"
+
+	"go.uber.org/zap"
+)
+
+// createUserRequest is the body of POST /api/users.
+type createUserRequest struct {
+	Username string         `json:"username"`
+	Password string         `json:"password"`
+	Role     model.UserRole `json:"role"`
+	Locale   string         `json:"locale"`
+}
+
+// resetPasswordRequest is the body of POST /api/users/{id}/reset-password.
+type resetPasswordRequest struct {
+	TemporaryPassword string `json:"temporaryPassword"`
+}
+
+// changePasswordRequest is the body of POST /api/auth/password.
+type changePasswordRequest struct {
+	CurrentPassword string `json:"currentPassword"`
+	NewPassword     string `json:"newPassword"`
+}
+
+// handleUserList returns all dashboard users.
+func (s *Server) handleUserList(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, model.APIResponse{
+		Data:      s.users.List(),
+		Timestamp: time.Now(),
+	})
+}
+
+// handleUserCreate adds a dashboard user.
+func (s *Server) handleUserCreate(w http.ResponseWriter, r *http.Request) {
+	var req createUserRequest
+	if !decodeBody(w, r, &req) {
+		return
+	}
+	user, err := s.users.Create(req.Username, req.Password, req.Role, req.Locale)
+	if err != nil {
+		writeUserError(w, err)
+		return
+	}
+	s.logUserAction(r, "create", user.ID, zap.String("username", user.Username), zap.String("role", string(user.Role)))
+	writeJSON(w, http.StatusCreated, model.APIResponse{
+		Data:      user.Info(),
+		Timestamp: time.Now(),
+	})
+}
+
+// handleUserUpdate changes a user's role and/or locale.
+func (s *Server) handleUserUpdate(w http.ResponseWriter, r *http.Request) {
+	var upd auth.UserUpdate
+	if !decodeBody(w, r, &upd) {
+		return
+	}
+	user, err := s.users.Update(r.PathValue("id"), upd)
+	if err != nil {
+		writeUserError(w, err)
+		return
+	}
+	s.logUserAction(r, "update", user.ID, zap.String("role", string(user.Role)), zap.String("locale", user.Locale))
+	writeJSON(w, http.StatusOK, model.APIResponse{
+		Data:      user.Info(),
+		Timestamp: time.Now(),
+	})
+}
+
+// handleUserDelete removes a user.
+func (s *Server) handleUserDelete(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if err := s.users.Delete(id); err != nil {
+		writeUserError(w, err)
+		return
+	}
+	s.hub.CloseEndedSessions()
+	s.logUserAction(r, "delete", id)
+	writeJSON(w, http.StatusOK, model.APIResponse{
+		Data:      map[string]string{"id": id, "status": "deleted"},
+		Timestamp: time.Now(),
+	})
+}
+
+// handleUserToggle enables or disables a user.
+func (s *Server) handleUserToggle(w http.ResponseWriter, r *http.Request) {
+	var disabled bool
+	switch r.PathValue("action") {
+	case "enable":
+		disabled = false
+	case "disable":
+		disabled = true
+	default:
+		writeJSON(w, http.StatusNotFound, model.APIResponse{
+			Error:     "action must be enable or disable",
+			Timestamp: time.Now(),
+		})
+		return
+	}
+	user, err := s.users.SetDisabled(r.PathValue("id"), disabled)
+	if err != nil {
+		writeUserError(w, err)
+		return
+	}
+	if disabled {
+		s.hub.CloseEndedSessions()
+	}
+	s.logUserAction(r, r.PathValue("action"), user.ID)
+	writeJSON(w, http.StatusOK, model.APIResponse{
+		Data:      user.Info(),
+		Timestamp: time.Now(),
+	})
+}
+
+// handleUserResetPassword forces a user to change its password, optionally
+// setting a temporary one.
+func (s *Server) handleUserResetPassword(w http.ResponseWriter, r *http.Request) {
+	var req resetPasswordRequest
+	if r.ContentLength != 0 && !decodeBody(w, r, &req) {
+		return
+	}
+	user, err := s.users.ForceReset(r.PathValue("id"), req.TemporaryPassword)
+	if err != nil {
+		writeUserError(w, err)
+		return
+	}
+	s.hub.CloseEndedSessions()
+	s.logUserAction(r, "reset_password", user.ID)
+	writeJSON(w, http.StatusOK, model.APIResponse{
+		Data:      user.Info(),
+		Timestamp: time.Now(),
+	})
+}
+
+// handleSessionList returns active login sessions.
+func (s *Server) handleSessionList(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, model.APIResponse{
+		Data:      s.users.Sessions(time.Now()),
+		Timestamp: time.Now(),
+	})
+}
+
+// handleSessionRevoke ends a login session.
+func (s *Server) handleSessionRevoke(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if err := s.users.EndSession(id); err != nil {
+		writeUserError(w, err)
+		return
+	}
+	s.hub.CloseEndedSessions()
+	s.logUserAction(r, "revoke_session", "", zap.String("session", id))
+	writeJSON(w, http.StatusOK, model.APIResponse{
+		Data:      map[string]string{"id": id, "status": "revoked"},
+		Timestamp: time.Now(),
+	})
+}
+
+// handleChangePassword lets the caller change its own password. It is the
+// only write allowed while a forced reset is pending.
+func (s *Server) handleChangePassword(w http.ResponseWriter, r *http.Request) {
+	var req changePasswordRequest
+	if !decodeBody(w, r, &req) {
+		return
+	}
+	p, _ := userFrom(r)
+	if err := s.users.ChangePassword(p.ID, req.CurrentPassword, req.NewPassword); err != nil {
+		writeUserError(w, err)
+		return
+	}
+	s.logger.Info("api_password_changed", zap.String("user", p.Username))
+	writeJSON(w, http.StatusOK, model.APIResponse{
+		Data:      map[string]string{"status": "password_changed"},
+		Timestamp: time.Now(),
+	})
+}
+
+// logUserAction logs an admin user-management action with its actor.
+func (s *Server) logUserAction(r *http.Request, action, target string, fields ...zap.Field) {
+	p, _ := userFrom(r)
+	s.logger.Info("api_user_admin", append([]zap.Field{
+		zap.String("actor", p.Username),
+		zap.String("action", action),
+		zap.String("target", target),
+	}, fields...)...)
+	s.recordOperator(r, "USER_"+strings.ToUpper(strings.ReplaceAll(action, "-", "_")), "", map[string]string{"target": target})
+}
+
+// decodeBody decodes a JSON request body, writing a 400 on failure.
+func decodeBody(w http.ResponseWriter, r *http.Request, v any) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		writeJSON(w, http.StatusBadRequest, model.APIResponse{
+			Error:     "invalid JSON: " + err.Error(),
+			Timestamp: time.Now(),
+		})
+		return false
+	}
+	return true
+}
+
+// writeUserError maps user store errors onto HTTP statuses.
+func writeUserError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, auth.ErrUserNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, auth.ErrUserExists), errors.Is(err, auth.ErrLastAdmin):
+		status = http.StatusConflict
+	case errors.Is(err, auth.ErrWeakPassword), errors.Is(err, auth.ErrInvalidRole), errors.Is(err, auth.ErrNoUsername):
+		status = http.StatusBadRequest
+	case errors.Is(err, auth.ErrBadCredentials):
+		status = http.StatusForbidden
+	}
+	writeJSON(w, status, model.APIResponse{
+		Error:     err.Error(),
+		Timestamp: time.Now(),
+	})
+}
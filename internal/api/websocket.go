@@ -2,85 +2,443 @@ package api
 
 import (
 	"bufio"
+	"bytes"
+	"compress/flate"
 	"crypto/sha1"
 	"encoding/base64"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
 	"net"
 	"net/http"
+	"net/url"
 	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"go-trade/internal/config"
 )
 
 const wsMagicGUID = "258EAFA5-E914-47DA-95CA-5AB5AA29BE65"
 
+// Frame opcodes (RFC 6455 section 5.2).
+const (
+	wsOpContinuation = 0x0
+	wsOpText         = 0x1
+	wsOpBinary       = 0x2
+	wsOpClose        = 0x8
+	wsOpPing         = 0x9
+	wsOpPong         = 0xA
+)
+
+// Close status codes (RFC 6455 section 7.4.1).
+const (
+	wsCloseNormal      = 1000
+	wsCloseGoingAway   = 1001
+	wsCloseProtocol    = 1002
+	wsCloseInvalidData = 1007
+	wsCloseTooBig      = 1009
+)
+
+const (
+	// wsCloseGrace is how long to wait for the peer's close frame after
+	// sending ours before dropping the connection.
+	wsCloseGrace = 2 * time.Second
+	// wsCompressMin is the smallest payload worth compressing.
+	wsCompressMin = 256
+)
+
+// deflateTail completes a permessage-deflate payload for flate.Reader: the
+// sync flush marker the sender strips, then an empty final block.
+var deflateTail = []byte{0x00, 0x00, 0xff, 0xff, 0x01, 0x00, 0x00, 0xff, 0xff}
+
+var flateWriters = sync.Pool{
+	New: func() any {
+		w, _ := flate.NewWriter(nil, flate.BestSpeed)
+		return w
+	},
+}
+
+// errWSClosed reports a completed close handshake.
+var errWSClosed = errors.New("websocket closed")
+
+// wsCloseError is a protocol violation by the peer; the connection is
+// closed with code.
+type wsCloseError struct {
+	code   int
+	reason string
+}
+
+func (e *wsCloseError) Error() string {
+	return fmt.Sprintf("websocket close %d: %s", e.code, e.reason)
+}
+
+// wsOptions are the limits and timeouts applied to every connection.
+type wsOptions struct {
+	origins      map[string]bool
+	maxMessage   int64
+	pingInterval time.Duration
+	pongTimeout  time.Duration
+	writeTimeout time.Duration
+	compression  bool
+	queueSize    int
+}
+
+// newWSOptions converts the configuration.
+func newWSOptions(cfg config.WebSocketConfig) wsOptions {
+	origins := make(map[string]bool, len(cfg.AllowedOrigins))
+	for _, o := range cfg.AllowedOrigins {
+		origins[strings.ToLower(strings.TrimSuffix(o, "/"))] = true
+	}
+	return wsOptions{
+		origins:      origins,
+		maxMessage:   int64(cfg.MaxMessageBytes),
+		pingInterval: time.Duration(cfg.PingIntervalMs) * time.Millisecond,
+		pongTimeout:  time.Duration(cfg.PongTimeoutMs) * time.Millisecond,
+		writeTimeout: time.Duration(cfg.WriteTimeoutMs) * time.Millisecond,
+		compression:  cfg.Compression,
+		queueSize:    cfg.QueueSize,
+	}
+}
+
+// originAllowed accepts clients without an Origin header (non-browser),
+// same-host origins, and the configured allowlist ("*" allows any).
+func (o wsOptions) originAllowed(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" || o.origins["*"] || o.origins[strings.ToLower(origin)] {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
+
 // WSClient represents a single WebSocket client connection.
 type WSClient struct {
-	hub  *Hub
-	conn net.Conn
-	send chan []byte
+	hub   *Hub
+	ws    *wsConn
+	queue *wsQueue
+	sub   subscription // guarded by hub.mu
+
+	// Inbound JSON-RPC requests are replayed against rpc as the user
+	// holding token (see wsrpc.go).
+	rpc        http.Handler
+	remoteAddr string
+	sessionID  string // login session; the client is closed when it ends
+	inflight   chan struct{}
+	mu         sync.Mutex
+	token      string
 }
 
-// writePump sends messages from the hub to the WebSocket client.
+// writePump sends queued messages to the WebSocket client and pings it
+// every ping interval. A closed queue starts the close handshake.
 func (c *WSClient) writePump() {
-	defer func() {
-		c.conn.Close()
-	}()
+	ticker := time.NewTicker(c.ws.opts.pingInterval)
+	defer ticker.Stop()
 
-	for msg := range c.send {
-		if err := wsWriteFrame(c.conn, 1, msg); err != nil {
-			return
+	for {
+		select {
+		case <-c.queue.ready:
+			items, closed := c.queue.take()
+			if closed {
+				c.ws.closeWith(wsCloseGoingAway, "")
+				return
+			}
+			for _, it := range items {
+				if err := c.ws.writeMessage(wsOpText, it.data); err != nil {
+					c.ws.conn.Close()
+					return
+				}
+			}
+		case <-ticker.C:
+			if err := c.ws.writeControl(wsOpPing, nil); err != nil {
+				c.ws.conn.Close()
+				return
+			}
 		}
 	}
 }
 
-// readPump reads messages from the WebSocket client (mainly for close/ping).
+// readPump reads from the client, answering control frames and handing
+// text messages to the JSON-RPC handler. The read deadline is the pong
+// timeout, renewed by every frame, so a client that stops answering pings
+// is dropped.
 func (c *WSClient) readPump() {
 	defer func() {
-		c.hub.unregister <- c
-		c.conn.Close()
+		c.hub.unregister(c)
+		c.ws.conn.Close()
 	}()
 
 	for {
-		_, _, err := wsReadFrame(c.conn)
+		opcode, msg, err := c.ws.readMessage()
 		if err != nil {
+			var ce *wsCloseError
+			if errors.As(err, &ce) {
+				c.ws.closeWith(ce.code, ce.reason)
+			}
 			return
 		}
+		if opcode != wsOpText {
+			c.replyError(rpcNullID, rpcErrInvalidRequest, "requests must be text messages", nil)
+			continue
+		}
+		c.handleRPC(msg)
 	}
 }
 
-// wsHandshake performs the WebSocket upgrade handshake.
-func wsHandshake(r *http.Request, bufrw *bufio.ReadWriter) error {
-	key := r.Header.Get("Sec-WebSocket-Key")
-	if key == "" {
-		return fmt.Errorf("missing Sec-WebSocket-Key")
+// wsConn is a server-side WebSocket connection.
+type wsConn struct {
+	conn    net.Conn
+	r       *bufio.Reader
+	opts    wsOptions
+	deflate bool // permessage-deflate negotiated
+
+	wmu       sync.Mutex
+	closeSent bool
+}
+
+// wsFrame is one decoded client frame.
+type wsFrame struct {
+	fin     bool
+	rsv1    bool
+	opcode  byte
+	payload []byte
+}
+
+// readMessage returns the next data message, reassembling fragments and
+// inflating compressed messages. Control frames are handled in between.
+func (c *wsConn) readMessage() (opcode byte, payload []byte, err error) {
+	var (
+		inMessage  bool
+		compressed bool
+	)
+	for {
+		c.conn.SetReadDeadline(time.Now().Add(c.opts.pongTimeout))
+		f, err := c.readFrame()
+		if err != nil {
+			return 0, nil, err
+		}
+
+		switch f.opcode {
+		case wsOpClose, wsOpPing, wsOpPong:
+			if err := c.handleControl(f); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case wsOpContinuation:
+			if !inMessage {
+				return 0, nil, &wsCloseError{wsCloseProtocol, "continuation frame without a message"}
+			}
+			if f.rsv1 {
+				return 0, nil, &wsCloseError{wsCloseProtocol, "RSV1 set on a continuation frame"}
+			}
+		case wsOpText, wsOpBinary:
+			if inMessage {
+				return 0, nil, &wsCloseError{wsCloseProtocol, "new message before the previous one finished"}
+			}
+			inMessage = true
+			opcode = f.opcode
+			compressed = f.rsv1
+		default:
+			return 0, nil, &wsCloseError{wsCloseProtocol, fmt.Sprintf("unknown opcode %#x", f.opcode)}
+		}
+
+		if int64(len(payload))+int64(len(f.payload)) > c.opts.maxMessage {
+			return 0, nil, &wsCloseError{wsCloseTooBig, "message too big"}
+		}
+		payload = append(payload, f.payload...)
+		if !f.fin {
+			continue
+		}
+
+		if compressed {
+			if payload, err = c.inflate(payload); err != nil {
+				return 0, nil, err
+			}
+		}
+		if opcode == wsOpText && !utf8.Valid(payload) {
+			return 0, nil, &wsCloseError{wsCloseInvalidData, "text message is not valid UTF-8"}
+		}
+		return opcode, payload, nil
 	}
+}
 
-	h := sha1.New()
-	h.Write([]byte(key + wsMagicGUID))
-	accept := base64.StdEncoding.EncodeToString(h.Sum(nil))
+// readFrame reads and unmasks one frame, rejecting anything a client may
+// not send before allocating the payload.
+func (c *wsConn) readFrame() (wsFrame, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(c.r, header[:]); err != nil {
+		return wsFrame{}, err
+	}
+	f := wsFrame{
+		fin:    header[0]&0x80 != 0,
+		rsv1:   header[0]&0x40 != 0,
+		opcode: header[0] & 0x0F,
+	}
+	control := f.opcode >= 0x8
 
-	response := strings.Join([]string{
-		"HTTP/1.1 101 Switching Protocols",
-		"Upgrade: websocket",
-		"Connection: Upgrade",
-		"Sec-WebSocket-Accept: " + accept,
-		"", "",
-	}, "\r\n")
+	switch {
+	case header[0]&0x30 != 0:
+		return f, &wsCloseError{wsCloseProtocol, "reserved bits set"}
+	case f.rsv1 && (!c.deflate || control):
+		return f, &wsCloseError{wsCloseProtocol, "RSV1 set without permessage-deflate"}
+	case header[1]&0x80 == 0:
+		return f, &wsCloseError{wsCloseProtocol, "client frames must be masked"}
+	case control && !f.fin:
+		return f, &wsCloseError{wsCloseProtocol, "fragmented control frame"}
+	}
 
-	_, err := bufrw.WriteString(response)
+	length := uint64(header[1] & 0x7F)
+	switch length {
+	case 126:
+		var buf [2]byte
+		if _, err := io.ReadFull(c.r, buf[:]); err != nil {
+			return f, err
+		}
+		length = uint64(binary.BigEndian.Uint16(buf[:]))
+	case 127:
+		var buf [8]byte
+		if _, err := io.ReadFull(c.r, buf[:]); err != nil {
+			return f, err
+		}
+		length = binary.BigEndian.Uint64(buf[:])
+		if length>>63 != 0 {
+			return f, &wsCloseError{wsCloseProtocol, "invalid payload length"}
+		}
+	}
+	if control && length > 125 {
+		return f, &wsCloseError{wsCloseProtocol, "control frame payload over 125 bytes"}
+	}
+	if length > uint64(c.opts.maxMessage) {
+		return f, &wsCloseError{wsCloseTooBig, "frame too big"}
+	}
+
+	var maskKey [4]byte
+	if _, err := io.ReadFull(c.r, maskKey[:]); err != nil {
+		return f, err
+	}
+	f.payload = make([]byte, length)
+	if _, err := io.ReadFull(c.r, f.payload); err != nil {
+		return f, err
+	}
+	for i := range f.payload {
+		f.payload[i] ^= maskKey[i%4]
+	}
+	return f, nil
+}
+
+// handleControl answers pings and close frames. Pongs need no action: any
+// frame renews the read deadline.
+func (c *wsConn) handleControl(f wsFrame) error {
+	switch f.opcode {
+	case wsOpPing:
+		return c.writeControl(wsOpPong, f.payload)
+	case wsOpClose:
+		code := wsCloseNormal
+		switch {
+		case len(f.payload) == 1:
+			return &wsCloseError{wsCloseProtocol, "truncated close code"}
+		case len(f.payload) >= 2:
+			code = int(binary.BigEndian.Uint16(f.payload))
+			if !validCloseCode(code) {
+				return &wsCloseError{wsCloseProtocol, fmt.Sprintf("invalid close code %d", code)}
+			}
+			if !utf8.Valid(f.payload[2:]) {
+				return &wsCloseError{wsCloseInvalidData, "close reason is not valid UTF-8"}
+			}
+		}
+		c.writeClose(code, "")
+		return errWSClosed
+	}
+	return nil
+}
+
+// validCloseCode reports whether a peer may send code (RFC 6455 section
+// 7.4 and the IANA registry).
+func validCloseCode(code int) bool {
+	switch {
+	case code >= 1000 && code <= 1003, code >= 1007 && code <= 1014:
+		return true
+	case code >= 3000 && code <= 4999:
+		return true
+	}
+	return false
+}
+
+// inflate decompresses a permessage-deflate message, bounded by the
+// message size limit.
+func (c *wsConn) inflate(p []byte) ([]byte, error) {
+	fr := flate.NewReader(io.MultiReader(bytes.NewReader(p), bytes.NewReader(deflateTail)))
+	defer fr.Close()
+	out, err := io.ReadAll(io.LimitReader(fr, c.opts.maxMessage+1))
 	if err != nil {
-		return err
+		return nil, &wsCloseError{wsCloseInvalidData, "invalid compressed message"}
 	}
-	return bufrw.Flush()
+	if int64(len(out)) > c.opts.maxMessage {
+		return nil, &wsCloseError{wsCloseTooBig, "message too big"}
+	}
+	return out, nil
+}
+
+// writeMessage sends a data message, compressed when negotiated and large
+// enough to benefit.
+func (c *wsConn) writeMessage(opcode byte, payload []byte) error {
+	rsv1 := false
+	if c.deflate && len(payload) >= wsCompressMin {
+		compressed, err := deflateMessage(payload)
+		if err != nil {
+			return err
+		}
+		payload, rsv1 = compressed, true
+	}
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if c.closeSent {
+		return errWSClosed
+	}
+	return c.writeFrame(opcode, rsv1, payload)
+}
+
+// writeControl sends a ping, pong or close frame. Nothing is sent after a
+// close frame.
+func (c *wsConn) writeControl(opcode byte, payload []byte) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if c.closeSent {
+		return errWSClosed
+	}
+	if opcode == wsOpClose {
+		c.closeSent = true
+	}
+	return c.writeFrame(opcode, false, payload)
+}
+
+// writeClose sends a close frame with a status code and reason.
+func (c *wsConn) writeClose(code int, reason string) error {
+	payload := make([]byte, 2, 2+len(reason))
+	binary.BigEndian.PutUint16(payload, uint16(code))
+	return c.writeControl(wsOpClose, append(payload, reason...))
 }
 
-// wsWriteFrame writes a WebSocket frame (server → client, no masking).
-func wsWriteFrame(w io.Writer, opcode byte, payload []byte) error {
+// closeWith starts the close handshake and drops the connection if the
+// peer does not finish it within wsCloseGrace.
+func (c *wsConn) closeWith(code int, reason string) {
+	c.writeClose(code, reason)
+	time.AfterFunc(wsCloseGrace, func() { c.conn.Close() })
+}
+
+// writeFrame writes a single unfragmented server frame (no masking).
+// Caller holds c.wmu.
+func (c *wsConn) writeFrame(opcode byte, rsv1 bool, payload []byte) error {
 	frame := make([]byte, 0, 10+len(payload))
 
-	// First byte: FIN + opcode
-	frame = append(frame, 0x80|opcode)
+	// First byte: FIN + RSV1 + opcode
+	first := 0x80 | opcode
+	if rsv1 {
+		first |= 0x40
+	}
+	frame = append(frame, first)
 
 	// Payload length
 	length := len(payload)
@@ -89,69 +447,121 @@ func wsWriteFrame(w io.Writer, opcode byte, payload []byte) error {
 		frame = append(frame, byte(length))
 	case length <= 65535:
 		frame = append(frame, 126)
-		buf := make([]byte, 2)
-		binary.BigEndian.PutUint16(buf, uint16(length))
-		frame = append(frame, buf...)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(length))
 	default:
 		frame = append(frame, 127)
-		buf := make([]byte, 8)
-		binary.BigEndian.PutUint64(buf, uint64(length))
-		frame = append(frame, buf...)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(length))
 	}
 
 	frame = append(frame, payload...)
-	_, err := w.Write(frame)
+	c.conn.SetWriteDeadline(time.Now().Add(c.opts.writeTimeout))
+	_, err := c.conn.Write(frame)
 	return err
 }
 
-// wsReadFrame reads a WebSocket frame (client → server, with masking).
-func wsReadFrame(r io.Reader) (opcode byte, payload []byte, err error) {
-	header := make([]byte, 2)
-	if _, err = io.ReadFull(r, header); err != nil {
-		return
+// deflateMessage compresses a payload for permessage-deflate, without
+// context takeover, stripping the trailing sync flush marker.
+func deflateMessage(p []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	fw := flateWriters.Get().(*flate.Writer)
+	defer flateWriters.Put(fw)
+	fw.Reset(&buf)
+	if _, err := fw.Write(p); err != nil {
+		return nil, err
+	}
+	if err := fw.Flush(); err != nil {
+		return nil, err
 	}
+	return bytes.TrimSuffix(buf.Bytes(), deflateTail[:4]), nil
+}
 
-	opcode = header[0] & 0x0F
-	masked := header[1]&0x80 != 0
-	length := uint64(header[1] & 0x7F)
+// wsCheckRequest validates an upgrade request before the connection is
+// hijacked, returning the HTTP status and message to reject it with.
+func wsCheckRequest(r *http.Request, opts wsOptions) (int, string) {
+	switch {
+	case r.Method != http.MethodGet:
+		return http.StatusMethodNotAllowed, "websocket upgrade requires GET"
+	case !headerHasToken(r.Header, "Connection", "upgrade") || !headerHasToken(r.Header, "Upgrade", "websocket"):
+		return http.StatusBadRequest, "not a websocket upgrade request"
+	case r.Header.Get("Sec-WebSocket-Version") != "13":
+		return http.StatusUpgradeRequired, "unsupported websocket version"
+	case !opts.originAllowed(r):
+		return http.StatusForbidden, "origin not allowed"
+	}
+	key, err := base64.StdEncoding.DecodeString(r.Header.Get("Sec-WebSocket-Key"))
+	if err != nil || len(key) != 16 {
+		return http.StatusBadRequest, "invalid Sec-WebSocket-Key"
+	}
+	return http.StatusOK, ""
+}
 
-	switch length {
-	case 126:
-		buf := make([]byte, 2)
-		if _, err = io.ReadFull(r, buf); err != nil {
-			return
+// headerHasToken reports whether a comma-separated header contains token.
+func headerHasToken(h http.Header, name, token string) bool {
+	for _, v := range h.Values(name) {
+		for _, part := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
 		}
-		length = uint64(binary.BigEndian.Uint16(buf))
-	case 127:
-		buf := make([]byte, 8)
-		if _, err = io.ReadFull(r, buf); err != nil {
-			return
-		}
-		length = binary.BigEndian.Uint64(buf)
 	}
+	return false
+}
 
-	var maskKey [4]byte
-	if masked {
-		if _, err = io.ReadFull(r, maskKey[:]); err != nil {
-			return
+// negotiateDeflate accepts the first permessage-deflate offer the server
+// can honour. Messages are compressed without context takeover in both
+// directions, which the server may require even when not offered.
+func negotiateDeflate(r *http.Request) bool {
+	for _, v := range r.Header.Values("Sec-WebSocket-Extensions") {
+		for _, offer := range strings.Split(v, ",") {
+			params := strings.Split(offer, ";")
+			if strings.TrimSpace(params[0]) != "permessage-deflate" {
+				continue
+			}
+			ok := true
+			for _, p := range params[1:] {
+				name, value, _ := strings.Cut(strings.TrimSpace(p), "=")
+				switch name {
+				case "server_no_context_takeover", "client_no_context_takeover", "client_max_window_bits":
+				case "server_max_window_bits":
+					// The flate package always uses a 32 KiB window.
+					ok = ok && strings.Trim(value, `"`) == "15"
+				default:
+					ok = false
+				}
+			}
+			if ok {
+				return true
+			}
 		}
 	}
+	return false
+}
 
-	payload = make([]byte, length)
-	if _, err = io.ReadFull(r, payload); err != nil {
-		return
+// wsHandshake performs the WebSocket upgrade handshake.
+func wsHandshake(r *http.Request, bufrw *bufio.ReadWriter, deflate bool) error {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if key == "" {
+		return fmt.Errorf("missing Sec-WebSocket-Key")
 	}
 
-	if masked {
-		for i := range payload {
-			payload[i] ^= maskKey[i%4]
-		}
-	}
+	h := sha1.New()
+	h.Write([]byte(key + wsMagicGUID))
+	accept := base64.StdEncoding.EncodeToString(h.Sum(nil))
 
-	// Handle close frame
-	if opcode == 8 {
-		err = fmt.Errorf("close frame received")
+	lines := []string{
+		"HTTP/1.1 101 Switching Protocols",
+		"Upgrade: websocket",
+		"Connection: Upgrade",
+		"Sec-WebSocket-Accept: " + accept,
 	}
+	if deflate {
+		lines = append(lines, "Sec-WebSocket-Extensions: permessage-deflate; server_no_context_takeover; client_no_context_takeover")
+	}
+	response := strings.Join(append(lines, "", ""), "\r\n")
 
-	return
+	_, err := bufrw.WriteString(response)
+	if err != nil {
+		return err
+	}
+	return bufrw.Flush()
 }
@@ -0,0 +1,475 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// wsTestMaskKey masks every client frame of the corpus.
+var wsTestMaskKey = [4]byte{0x37, 0xfa, 0x21, 0x3d}
+
+// wsTestFrame is one client frame of the corpus.
+type wsTestFrame struct {
+	fin      bool
+	rsv      byte // RSV1-3 bits as they appear in the first byte
+	opcode   byte
+	payload  []byte
+	unmasked bool
+}
+
+// encode builds the frame on the wire.
+func (f wsTestFrame) encode() []byte {
+	first := f.rsv | f.opcode
+	if f.fin {
+		first |= 0x80
+	}
+	var mask byte = 0x80
+	if f.unmasked {
+		mask = 0
+	}
+	out := []byte{first}
+	switch n := len(f.payload); {
+	case n <= 125:
+		out = append(out, mask|byte(n))
+	case n <= 65535:
+		out = append(out, mask|126)
+		out = binary.BigEndian.AppendUint16(out, uint16(n))
+	default:
+		out = append(out, mask|127)
+		out = binary.BigEndian.AppendUint64(out, uint64(n))
+	}
+	if f.unmasked {
+		return append(out, f.payload...)
+	}
+	out = append(out, wsTestMaskKey[:]...)
+	for i, b := range f.payload {
+		out = append(out, b^wsTestMaskKey[i%4])
+	}
+	return out
+}
+
+func wsText(p string) wsTestFrame {
+	return wsTestFrame{fin: true, opcode: wsOpText, payload: []byte(p)}
+}
+
+func wsFrag(opcode byte, p string, fin bool) wsTestFrame {
+	return wsTestFrame{fin: fin, opcode: opcode, payload: []byte(p)}
+}
+
+func wsPing(p string) wsTestFrame {
+	return wsTestFrame{fin: true, opcode: wsOpPing, payload: []byte(p)}
+}
+
+func wsCloseFrame(code int, reason string) wsTestFrame {
+	p := binary.BigEndian.AppendUint16(nil, uint16(code))
+	return wsTestFrame{fin: true, opcode: wsOpClose, payload: append(p, reason...)}
+}
+
+func wsDeflate(t *testing.T, p []byte) []byte {
+	t.Helper()
+	out, err := deflateMessage(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+// wsTestMessage is a data message returned by readMessage.
+type wsTestMessage struct {
+	opcode  byte
+	payload string
+}
+
+// wsServerFrame is a frame the server wrote back.
+type wsServerFrame struct {
+	rsv1    bool
+	opcode  byte
+	payload []byte
+}
+
+// readServerFrame decodes one unmasked server frame.
+func readServerFrame(r *bufio.Reader) (wsServerFrame, error) {
+	var h [2]byte
+	if _, err := io.ReadFull(r, h[:]); err != nil {
+		return wsServerFrame{}, err
+	}
+	n := uint64(h[1] & 0x7F)
+	switch n {
+	case 126:
+		var b [2]byte
+		if _, err := io.ReadFull(r, b[:]); err != nil {
+			return wsServerFrame{}, err
+		}
+		n = uint64(binary.BigEndian.Uint16(b[:]))
+	case 127:
+		var b [8]byte
+		if _, err := io.ReadFull(r, b[:]); err != nil {
+			return wsServerFrame{}, err
+		}
+		n = binary.BigEndian.Uint64(b[:])
+	}
+	f := wsServerFrame{rsv1: h[0]&0x40 != 0, opcode: h[0] & 0x0F, payload: make([]byte, n)}
+	_, err := io.ReadFull(r, f.payload)
+	return f, err
+}
+
+// wsTestResult is what the server did with a corpus.
+type wsTestResult struct {
+	messages []wsTestMessage
+	err      error
+	pongs    []string
+	close    int // code of the server's close frame, 0 when none was sent
+}
+
+// runWSCorpus writes raw client bytes over net.Pipe to a server wsConn,
+// reads messages until an error, and collects what the server sent back.
+// With hangUp the client closes its end after writing, as a dropped
+// connection would.
+func runWSCorpus(t *testing.T, opts wsOptions, deflate bool, raw []byte, hangUp bool) wsTestResult {
+	t.Helper()
+	srv, cli := net.Pipe()
+	c := &wsConn{conn: srv, r: bufio.NewReader(srv), opts: opts, deflate: deflate}
+
+	go func() {
+		cli.Write(raw)
+		if hangUp {
+			cli.Close()
+		}
+	}()
+
+	var res wsTestResult
+	sent := make(chan struct{})
+	go func() {
+		defer close(sent)
+		br := bufio.NewReader(cli)
+		for {
+			f, err := readServerFrame(br)
+			if err != nil {
+				return
+			}
+			switch f.opcode {
+			case wsOpPong:
+				res.pongs = append(res.pongs, string(f.payload))
+			case wsOpClose:
+				if len(f.payload) >= 2 {
+					res.close = int(binary.BigEndian.Uint16(f.payload))
+				}
+			}
+		}
+	}()
+
+	for {
+		opcode, msg, err := c.readMessage()
+		if err != nil {
+			res.err = err
+			break
+		}
+		res.messages = append(res.messages, wsTestMessage{opcode, string(msg)})
+	}
+	var ce *wsCloseError
+	if errors.As(res.err, &ce) {
+		c.writeClose(ce.code, ce.reason)
+	}
+	srv.Close()
+	cli.Close()
+	<-sent
+	return res
+}
+
+func testWSOptions(maxMessage int64) wsOptions {
+	return wsOptions{
+		maxMessage:   maxMessage,
+		pingInterval: time.Minute,
+		pongTimeout:  2 * time.Second,
+		writeTimeout: 2 * time.Second,
+	}
+}
+
+func TestWSReadCorpus(t *testing.T) {
+	big16 := strings.Repeat("a", 200)
+	big64 := strings.Repeat("b", 70000)
+	deflated := wsDeflate(t, []byte(strings.Repeat("compressible ", 100)))
+
+	const (
+		clean = -1 // close handshake completed by the client
+		eof   = -2 // connection dropped mid-frame
+	)
+	tests := []struct {
+		name       string
+		frames     []wsTestFrame
+		raw        []byte // appended after frames
+		hangUp     bool
+		deflate    bool
+		maxMessage int64
+		want       []wsTestMessage
+		pongs      []string
+		code       int // expected wsCloseError code, or clean/eof
+		serverSent int // expected server close code
+	}{
+		// Framing
+		{name: "1.1.1 empty text", frames: []wsTestFrame{wsText(""), wsCloseFrame(1000, "")},
+			want: []wsTestMessage{{wsOpText, ""}}, code: clean, serverSent: 1000},
+		{name: "1.1.2 text 125 bytes", frames: []wsTestFrame{wsText(strings.Repeat("x", 125)), wsCloseFrame(1000, "")},
+			want: []wsTestMessage{{wsOpText, strings.Repeat("x", 125)}}, code: clean, serverSent: 1000},
+		{name: "1.1.3 text 16-bit length", frames: []wsTestFrame{wsText(big16), wsCloseFrame(1000, "")},
+			want: []wsTestMessage{{wsOpText, big16}}, code: clean, serverSent: 1000},
+		{name: "1.1.4 text 64-bit length", frames: []wsTestFrame{wsText(big64), wsCloseFrame(1000, "")},
+			want: []wsTestMessage{{wsOpText, big64}}, code: clean, serverSent: 1000},
+		{name: "1.2.1 binary", frames: []wsTestFrame{{fin: true, opcode: wsOpBinary, payload: []byte{0xff, 0x00, 0xfe}}, wsCloseFrame(1000, "")},
+			want: []wsTestMessage{{wsOpBinary, "\xff\x00\xfe"}}, code: clean, serverSent: 1000},
+		{name: "1.3.1 two messages", frames: []wsTestFrame{wsText("one"), wsText("two"), wsCloseFrame(1000, "")},
+			want: []wsTestMessage{{wsOpText, "one"}, {wsOpText, "two"}}, code: clean, serverSent: 1000},
+
+		// Pings and pongs
+		{name: "2.1 ping echoed", frames: []wsTestFrame{wsPing("hello"), wsCloseFrame(1000, "")},
+			pongs: []string{"hello"}, code: clean, serverSent: 1000},
+		{name: "2.2 empty ping", frames: []wsTestFrame{wsPing(""), wsCloseFrame(1000, "")},
+			pongs: []string{""}, code: clean, serverSent: 1000},
+		{name: "2.3 ping 125 bytes", frames: []wsTestFrame{wsPing(strings.Repeat("p", 125)), wsCloseFrame(1000, "")},
+			pongs: []string{strings.Repeat("p", 125)}, code: clean, serverSent: 1000},
+		{name: "2.4 ping over 125 bytes", frames: []wsTestFrame{wsPing(strings.Repeat("p", 126))},
+			code: wsCloseProtocol, serverSent: wsCloseProtocol},
+		{name: "2.5 unsolicited pong ignored", frames: []wsTestFrame{{fin: true, opcode: wsOpPong, payload: []byte("x")}, wsText("ok"), wsCloseFrame(1000, "")},
+			want: []wsTestMessage{{wsOpText, "ok"}}, code: clean, serverSent: 1000},
+
+		// Reserved bits and opcodes
+		{name: "3.1 RSV1 without deflate", frames: []wsTestFrame{{fin: true, rsv: 0x40, opcode: wsOpText, payload: []byte("x")}},
+			code: wsCloseProtocol, serverSent: wsCloseProtocol},
+		{name: "3.2 RSV2", frames: []wsTestFrame{{fin: true, rsv: 0x20, opcode: wsOpText, payload: []byte("x")}},
+			code: wsCloseProtocol, serverSent: wsCloseProtocol},
+		{name: "3.3 RSV3 after a valid message", frames: []wsTestFrame{wsText("ok"), {fin: true, rsv: 0x10, opcode: wsOpText, payload: []byte("x")}},
+			want: []wsTestMessage{{wsOpText, "ok"}}, code: wsCloseProtocol, serverSent: wsCloseProtocol},
+		{name: "3.4 RSV1 on ping with deflate", deflate: true, frames: []wsTestFrame{{fin: true, rsv: 0x40, opcode: wsOpPing}},
+			code: wsCloseProtocol, serverSent: wsCloseProtocol},
+		{name: "4.1 reserved data opcode", frames: []wsTestFrame{{fin: true, opcode: 0x3}},
+			code: wsCloseProtocol, serverSent: wsCloseProtocol},
+		{name: "4.2 reserved control opcode", frames: []wsTestFrame{{fin: true, opcode: 0xB}},
+			code: wsCloseProtocol, serverSent: wsCloseProtocol},
+		{name: "4.3 unmasked frame", frames: []wsTestFrame{{fin: true, opcode: wsOpText, payload: []byte("x"), unmasked: true}},
+			code: wsCloseProtocol, serverSent: wsCloseProtocol},
+
+		// Fragmentation
+		{name: "5.1 fragmented ping", frames: []wsTestFrame{{fin: false, opcode: wsOpPing, payload: []byte("a")}},
+			code: wsCloseProtocol, serverSent: wsCloseProtocol},
+		{name: "5.2 three fragments", frames: []wsTestFrame{wsFrag(wsOpText, "frag", false), wsFrag(wsOpContinuation, "men", false), wsFrag(wsOpContinuation, "ted", true), wsCloseFrame(1000, "")},
+			want: []wsTestMessage{{wsOpText, "fragmented"}}, code: clean, serverSent: 1000},
+		{name: "5.3 empty fragments", frames: []wsTestFrame{wsFrag(wsOpText, "", false), wsFrag(wsOpContinuation, "", false), wsFrag(wsOpContinuation, "x", true), wsCloseFrame(1000, "")},
+			want: []wsTestMessage{{wsOpText, "x"}}, code: clean, serverSent: 1000},
+		{name: "5.4 ping between fragments", frames: []wsTestFrame{wsFrag(wsOpText, "a", false), wsPing("mid"), wsFrag(wsOpContinuation, "b", true), wsCloseFrame(1000, "")},
+			want: []wsTestMessage{{wsOpText, "ab"}}, pongs: []string{"mid"}, code: clean, serverSent: 1000},
+		{name: "5.5 pong between fragments", frames: []wsTestFrame{wsFrag(wsOpBinary, "a", false), {fin: true, opcode: wsOpPong}, wsFrag(wsOpContinuation, "b", true), wsCloseFrame(1000, "")},
+			want: []wsTestMessage{{wsOpBinary, "ab"}}, code: clean, serverSent: 1000},
+		{name: "5.6 close between fragments", frames: []wsTestFrame{wsFrag(wsOpText, "a", false), wsCloseFrame(1000, ""), wsFrag(wsOpContinuation, "b", true)},
+			code: clean, serverSent: 1000},
+		{name: "5.7 continuation without a message", frames: []wsTestFrame{wsFrag(wsOpContinuation, "x", true)},
+			code: wsCloseProtocol, serverSent: wsCloseProtocol},
+		{name: "5.8 text inside a fragmented message", frames: []wsTestFrame{wsFrag(wsOpText, "a", false), wsText("b")},
+			code: wsCloseProtocol, serverSent: wsCloseProtocol},
+		{name: "5.9 continuation after a finished message", frames: []wsTestFrame{wsText("a"), wsFrag(wsOpContinuation, "b", true)},
+			want: []wsTestMessage{{wsOpText, "a"}}, code: wsCloseProtocol, serverSent: wsCloseProtocol},
+
+		// UTF-8
+		{name: "6.1 valid multi-byte text", frames: []wsTestFrame{wsText("κόσμε"), wsCloseFrame(1000, "")},
+			want: []wsTestMessage{{wsOpText, "κόσμε"}}, code: clean, serverSent: 1000},
+		{name: "6.2 code point split across fragments", frames: []wsTestFrame{wsFrag(wsOpText, "\xce", false), wsFrag(wsOpContinuation, "\xba", true), wsCloseFrame(1000, "")},
+			want: []wsTestMessage{{wsOpText, "κ"}}, code: clean, serverSent: 1000},
+		{name: "6.3 invalid text", frames: []wsTestFrame{wsText("\xce\xba\xe1\xbd\xb9\xcf\x83\xce\xbc\xce\xb5\xed\xa0\x80")},
+			code: wsCloseInvalidData, serverSent: wsCloseInvalidData},
+		{name: "6.4 invalid text across fragments", frames: []wsTestFrame{wsFrag(wsOpText, "ok", false), wsFrag(wsOpContinuation, "\xff", true)},
+			code: wsCloseInvalidData, serverSent: wsCloseInvalidData},
+		{name: "6.5 truncated code point", frames: []wsTestFrame{wsText("\xce")},
+			code: wsCloseInvalidData, serverSent: wsCloseInvalidData},
+		{name: "6.6 invalid bytes in binary", frames: []wsTestFrame{{fin: true, opcode: wsOpBinary, payload: []byte{0xff}}, wsCloseFrame(1000, "")},
+			want: []wsTestMessage{{wsOpBinary, "\xff"}}, code: clean, serverSent: 1000},
+
+		// Close frames
+		{name: "7.1 close without code", frames: []wsTestFrame{{fin: true, opcode: wsOpClose}},
+			code: clean, serverSent: 1000},
+		{name: "7.2 close with reason", frames: []wsTestFrame{wsCloseFrame(1001, "bye")},
+			code: clean, serverSent: 1001},
+		{name: "7.3 truncated close code", frames: []wsTestFrame{{fin: true, opcode: wsOpClose, payload: []byte{0x03}}},
+			code: wsCloseProtocol, serverSent: wsCloseProtocol},
+		{name: "7.4 close reason invalid UTF-8", frames: []wsTestFrame{wsCloseFrame(1000, "\xff")},
+			code: wsCloseInvalidData, serverSent: wsCloseInvalidData},
+		{name: "7.5 close 3000", frames: []wsTestFrame{wsCloseFrame(3000, "")}, code: clean, serverSent: 3000},
+		{name: "7.6 close 4999", frames: []wsTestFrame{wsCloseFrame(4999, "")}, code: clean, serverSent: 4999},
+		{name: "7.7 close 1014", frames: []wsTestFrame{wsCloseFrame(1014, "")}, code: clean, serverSent: 1014},
+		{name: "7.8 close 0", frames: []wsTestFrame{wsCloseFrame(0, "")}, code: wsCloseProtocol, serverSent: wsCloseProtocol},
+		{name: "7.9 close 999", frames: []wsTestFrame{wsCloseFrame(999, "")}, code: wsCloseProtocol, serverSent: wsCloseProtocol},
+		{name: "7.10 close 1004", frames: []wsTestFrame{wsCloseFrame(1004, "")}, code: wsCloseProtocol, serverSent: wsCloseProtocol},
+		{name: "7.11 close 1005", frames: []wsTestFrame{wsCloseFrame(1005, "")}, code: wsCloseProtocol, serverSent: wsCloseProtocol},
+		{name: "7.12 close 1006", frames: []wsTestFrame{wsCloseFrame(1006, "")}, code: wsCloseProtocol, serverSent: wsCloseProtocol},
+		{name: "7.13 close 1015", frames: []wsTestFrame{wsCloseFrame(1015, "")}, code: wsCloseProtocol, serverSent: wsCloseProtocol},
+		{name: "7.14 close 2999", frames: []wsTestFrame{wsCloseFrame(2999, "")}, code: wsCloseProtocol, serverSent: wsCloseProtocol},
+		{name: "7.15 close 5000", frames: []wsTestFrame{wsCloseFrame(5000, "")}, code: wsCloseProtocol, serverSent: wsCloseProtocol},
+		{name: "7.16 close 65535", frames: []wsTestFrame{wsCloseFrame(65535, "")}, code: wsCloseProtocol, serverSent: wsCloseProtocol},
+
+		// Size limits
+		{name: "9.1 frame at limit", maxMessage: 64, frames: []wsTestFrame{wsText(strings.Repeat("x", 64)), wsCloseFrame(1000, "")},
+			want: []wsTestMessage{{wsOpText, strings.Repeat("x", 64)}}, code: clean, serverSent: 1000},
+		{name: "9.2 frame over limit", maxMessage: 64, frames: []wsTestFrame{wsText(strings.Repeat("x", 65))},
+			code: wsCloseTooBig, serverSent: wsCloseTooBig},
+		{name: "9.3 fragments over limit", maxMessage: 64, frames: []wsTestFrame{wsFrag(wsOpText, strings.Repeat("x", 40), false), wsFrag(wsOpContinuation, strings.Repeat("x", 40), true)},
+			code: wsCloseTooBig, serverSent: wsCloseTooBig},
+		{name: "9.4 invalid 64-bit length", raw: []byte{0x81, 0xFF, 0x80, 0, 0, 0, 0, 0, 0, 0x01},
+			code: wsCloseProtocol, serverSent: wsCloseProtocol},
+		{name: "9.5 deflated message over limit", deflate: true, maxMessage: 64,
+			frames: []wsTestFrame{{fin: true, rsv: 0x40, opcode: wsOpText, payload: deflated}},
+			code:   wsCloseTooBig, serverSent: wsCloseTooBig},
+
+		// Truncated input
+		{name: "10.1 truncated header", raw: []byte{0x81}, hangUp: true, code: eof},
+		{name: "10.2 truncated extended length", raw: []byte{0x81, 0xFE, 0x00}, hangUp: true, code: eof},
+		{name: "10.3 truncated mask key", raw: []byte{0x81, 0x85, 0x01, 0x02}, hangUp: true, code: eof},
+		{name: "10.4 truncated payload", raw: wsText("hello").encode()[:8], hangUp: true, code: eof},
+
+		// permessage-deflate
+		{name: "12.1 deflated text", deflate: true,
+			frames: []wsTestFrame{{fin: true, rsv: 0x40, opcode: wsOpText, payload: deflated}, wsCloseFrame(1000, "")},
+			want:   []wsTestMessage{{wsOpText, strings.Repeat("compressible ", 100)}}, code: clean, serverSent: 1000},
+		{name: "12.2 deflated fragments", deflate: true,
+			frames: []wsTestFrame{
+				{fin: false, rsv: 0x40, opcode: wsOpText, payload: deflated[:len(deflated)/2]},
+				{fin: true, opcode: wsOpContinuation, payload: deflated[len(deflated)/2:]},
+				wsCloseFrame(1000, ""),
+			},
+			want: []wsTestMessage{{wsOpText, strings.Repeat("compressible ", 100)}}, code: clean, serverSent: 1000},
+		{name: "12.3 uncompressed message with deflate", deflate: true, frames: []wsTestFrame{wsText("plain"), wsCloseFrame(1000, "")},
+			want: []wsTestMessage{{wsOpText, "plain"}}, code: clean, serverSent: 1000},
+		{name: "12.4 RSV1 on continuation", deflate: true,
+			frames: []wsTestFrame{{fin: false, rsv: 0x40, opcode: wsOpText, payload: deflated[:4]}, {fin: true, rsv: 0x40, opcode: wsOpContinuation, payload: deflated[4:]}},
+			code:   wsCloseProtocol, serverSent: wsCloseProtocol},
+		{name: "12.5 corrupt deflate data", deflate: true, frames: []wsTestFrame{{fin: true, rsv: 0x40, opcode: wsOpText, payload: []byte{0xff, 0xff, 0xff}}},
+			code: wsCloseInvalidData, serverSent: wsCloseInvalidData},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var raw []byte
+			for _, f := range tt.frames {
+				raw = append(raw, f.encode()...)
+			}
+			raw = append(raw, tt.raw...)
+			maxMessage := tt.maxMessage
+			if maxMessage == 0 {
+				maxMessage = 1 << 20
+			}
+			res := runWSCorpus(t, testWSOptions(maxMessage), tt.deflate, raw, tt.hangUp)
+
+			if len(res.messages) != len(tt.want) {
+				t.Fatalf("got %d messages, want %d", len(res.messages), len(tt.want))
+			}
+			for i, m := range res.messages {
+				if m != tt.want[i] {
+					t.Errorf("message %d = {%#x %.40q}, want {%#x %.40q}", i, m.opcode, m.payload, tt.want[i].opcode, tt.want[i].payload)
+				}
+			}
+			if strings.Join(res.pongs, "|") != strings.Join(tt.pongs, "|") || len(res.pongs) != len(tt.pongs) {
+				t.Errorf("pongs = %q, want %q", res.pongs, tt.pongs)
+			}
+
+			var ce *wsCloseError
+			switch {
+			case tt.code == clean:
+				if !errors.Is(res.err, errWSClosed) {
+					t.Errorf("err = %v, want a completed close handshake", res.err)
+				}
+			case tt.code == eof:
+				if !errors.Is(res.err, io.EOF) && !errors.Is(res.err, io.ErrUnexpectedEOF) {
+					t.Errorf("err = %v, want EOF", res.err)
+				}
+			case !errors.As(res.err, &ce):
+				t.Errorf("err = %v, want close code %d", res.err, tt.code)
+			case ce.code != tt.code:
+				t.Errorf("close code = %d (%s), want %d", ce.code, ce.reason, tt.code)
+			}
+			if res.close != tt.serverSent {
+				t.Errorf("server close frame code = %d, want %d", res.close, tt.serverSent)
+			}
+		})
+	}
+}
+
+func TestWSWriteMessageDeflateRoundTrip(t *testing.T) {
+	tests := []struct {
+		name     string
+		deflate  bool
+		payload  string
+		wantRSV1 bool
+	}{
+		{"small message stays plain", true, "short", false},
+		{"large message is compressed", true, strings.Repeat(`{"topic":"tick","bid":1.08312}`, 50), true},
+		{"no deflate negotiated", false, strings.Repeat("x", 1000), false},
+		{"64 KiB message", true, strings.Repeat("0123456789abcdef", 4096), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, cli := net.Pipe()
+			defer cli.Close()
+			c := &wsConn{conn: srv, r: bufio.NewReader(srv), opts: testWSOptions(1 << 20), deflate: tt.deflate}
+			go func() {
+				c.writeMessage(wsOpText, []byte(tt.payload))
+				srv.Close()
+			}()
+
+			f, err := readServerFrame(bufio.NewReader(cli))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if f.opcode != wsOpText || f.rsv1 != tt.wantRSV1 {
+				t.Fatalf("frame opcode %#x rsv1 %v, want text rsv1 %v", f.opcode, f.rsv1, tt.wantRSV1)
+			}
+			got := f.payload
+			if f.rsv1 {
+				if len(got) >= len(tt.payload) {
+					t.Errorf("compressed %d bytes to %d", len(tt.payload), len(got))
+				}
+				fr := flate.NewReader(io.MultiReader(bytes.NewReader(got), bytes.NewReader(deflateTail)))
+				if got, err = io.ReadAll(fr); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if string(got) != tt.payload {
+				t.Errorf("payload mismatch: got %d bytes, want %d", len(got), len(tt.payload))
+			}
+
+			// The server's own inflate reads what it wrote.
+			if f.rsv1 {
+				out, err := c.inflate(f.payload)
+				if err != nil || string(out) != tt.payload {
+					t.Errorf("inflate round trip failed: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestWSNothingSentAfterClose(t *testing.T) {
+	srv, cli := net.Pipe()
+	defer cli.Close()
+	c := &wsConn{conn: srv, r: bufio.NewReader(srv), opts: testWSOptions(1 << 20)}
+	go c.writeClose(wsCloseNormal, "done")
+
+	f, err := readServerFrame(bufio.NewReader(cli))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.opcode != wsOpClose || binary.BigEndian.Uint16(f.payload) != wsCloseNormal || string(f.payload[2:]) != "done" {
+		t.Fatalf("close frame = %#x %q", f.opcode, f.payload)
+	}
+	if err := c.writeMessage(wsOpText, []byte("late")); !errors.Is(err, errWSClosed) {
+		t.Errorf("writeMessage after close = %v, want errWSClosed", err)
+	}
+	if err := c.writeControl(wsOpPing, nil); !errors.Is(err, errWSClosed) {
+		t.Errorf("writeControl after close = %v, want errWSClosed", err)
+	}
+	srv.Close()
+}
@@ -0,0 +1,144 @@
+package api
+
+import (
+	"strconv"
+	"sync"
+
+	"go-trade/internal/model"
+)
+
+// lossyTopics may lose their oldest queued messages when a client falls
+// behind: each message supersedes the previous one for its key. Other
+// topics are only dropped once no lossy message is left to evict.
+var lossyTopics = map[string]bool{
+	model.TopicStatus:  true,
+	model.TopicTick:    true,
+	model.TopicAccount: true,
+}
+
+// queuedMessage is an outbound message with its sequence number applied.
+type queuedMessage struct {
+	topic string
+	data  []byte
+}
+
+// wsQueue is a client's bounded outbound queue. Every queued message gets
+// the next sequence number of its topic for this client, so anything
+// dropped shows up to the client as a gap.
+type wsQueue struct {
+	mu     sync.Mutex
+	items  []queuedMessage
+	limit  int
+	seq    map[string]uint64
+	ready  chan struct{}
+	closed bool
+	// holding keeps the writer from taking messages while a resync
+	// snapshot is built.
+	holding bool
+}
+
+func newWSQueue(limit int) *wsQueue {
+	return &wsQueue{
+		limit: limit,
+		seq:   make(map[string]uint64),
+		ready: make(chan struct{}, 1),
+	}
+}
+
+// push queues a message, evicting the oldest lossy message (or, failing
+// that, the oldest message) when the queue is full. Reports whether a
+// message was dropped.
+func (q *wsQueue) push(m hubMessage) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return false
+	}
+	dropped := false
+	if len(q.items) >= q.limit {
+		evict := 0
+		for i, it := range q.items {
+			if lossyTopics[it.topic] {
+				evict = i
+				break
+			}
+		}
+		q.items = append(q.items[:evict], q.items[evict+1:]...)
+		dropped = true
+	}
+	q.seq[m.topic]++
+	q.items = append(q.items, queuedMessage{topic: m.topic, data: withSeq(m.data, q.seq[m.topic])})
+	q.signal()
+	return dropped
+}
+
+// pushFront queues a message that must not be dropped or reordered
+// behind, such as a resync response. Caller holds q.mu.
+func (q *wsQueue) pushFront(data []byte) {
+	q.items = append([]queuedMessage{{data: data}}, q.items...)
+	q.signal()
+}
+
+// take removes and returns everything queued; closed is set once the
+// queue is closed and drained.
+func (q *wsQueue) take() (items []queuedMessage, closed bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.holding && !q.closed {
+		return nil, false
+	}
+	items, q.items = q.items, nil
+	return items, q.closed && len(items) == 0
+}
+
+// resync drops everything queued and sends build's message ahead of any
+// later event. build gets the sequence numbers at the cut and runs without
+// the queue lock, since it reads engine state; events queued meanwhile are
+// held back until its message is queued, so every event that follows it
+// carries a higher number. A nil message just releases them.
+func (q *wsQueue) resync(build func(seq map[string]uint64) []byte) {
+	q.mu.Lock()
+	q.items = nil
+	q.holding = true
+	seq := make(map[string]uint64, len(q.seq))
+	for topic, n := range q.seq {
+		seq[topic] = n
+	}
+	q.mu.Unlock()
+
+	data := build(seq)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.holding = false
+	if data != nil {
+		q.pushFront(data)
+	} else if len(q.items) > 0 {
+		q.signal()
+	}
+}
+
+// close stops accepting messages and wakes the writer.
+func (q *wsQueue) close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closed = true
+	q.signal()
+}
+
+// signal wakes the writer without blocking. Caller holds q.mu.
+func (q *wsQueue) signal() {
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+// withSeq inserts "seq" as the first field of an encoded WSMessage.
+func withSeq(msg []byte, seq uint64) []byte {
+	out := make([]byte, 0, len(msg)+24)
+	out = append(out, `{"seq":`...)
+	out = strconv.AppendUint(out, seq, 10)
+	out = append(out, ',')
+	return append(out, msg[1:]...)
+}
@@ -0,0 +1,418 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"go-trade/internal/model"
+)
+
+// JSON-RPC 2.0 error codes. Errors from the REST route behind a method use
+// rpcErrInvalidParams for 400 and rpcErrServer otherwise, with the HTTP
+// status and API error code in the error data.
+const (
+	rpcErrParse          = -32700
+	rpcErrInvalidRequest = -32600
+	rpcErrMethodNotFound = -32601
+	rpcErrInvalidParams  = -32602
+	rpcErrServer         = -32000
+)
+
+// rpcMaxInflight bounds the requests one client may have running.
+const rpcMaxInflight = 8
+
+// rpcNullID answers requests whose id could not be read.
+var rpcNullID = json.RawMessage("null")
+
+// rpcRequest is a JSON-RPC 2.0 request sent by a client over /ws.
+type rpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params"`
+}
+
+// rpcResponse answers one request. Responses carry "jsonrpc", event
+// messages carry "type", so clients can tell them apart.
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+// rpcError is a JSON-RPC error object.
+type rpcError struct {
+	Code    int           `json:"code"`
+	Message string        `json:"message"`
+	Data    *rpcErrorData `json:"data,omitempty"`
+}
+
+// rpcErrorData mirrors the REST error envelope.
+type rpcErrorData struct {
+	Status  int                `json:"status"`
+	Code    string             `json:"code,omitempty"`
+	Details []model.FieldError `json:"details,omitempty"`
+}
+
+// rpcRoute maps a method onto the REST route implementing it. Path
+// placeholders like {ticket} are filled from params of the same name and
+// removed from the body; the remaining params are the JSON body (query
+// parameters for GET). transform, when set, rewrites params first.
+type rpcRoute struct {
+	method    string
+	path      string
+	transform func(map[string]json.RawMessage)
+}
+
+// rpcRoutes lists the methods served by REST routes. Calls run through
+// the same authentication, role checks, rate limits, validation,
+// idempotency and audit as the REST API.
+var rpcRoutes = map[string]rpcRoute{
+	"status":          {method: http.MethodGet, path: "/api/status"},
+	"positions":       {method: http.MethodGet, path: "/api/positions"},
+	"accounts":        {method: http.MethodGet, path: "/api/accounts"},
+	"grids":           {method: http.MethodGet, path: "/api/grids"},
+	"symbols":         {method: http.MethodGet, path: "/api/symbols"},
+	"ticks":           {method: http.MethodGet, path: "/api/ticks"},
+	"commands":        {method: http.MethodGet, path: "/api/commands"},
+	"control.list":    {method: http.MethodGet, path: "/api/control"},
+	"pause":           {method: http.MethodPost, path: "/api/control/pause"},
+	"resume":          {method: http.MethodPost, path: "/api/control/resume"},
+	"freeze":          {method: http.MethodPost, path: "/api/control/freeze"},
+	"order.create":    {method: http.MethodPost, path: "/api/orders"},
+	"position.close":  {method: http.MethodPost, path: "/api/positions/{ticket}/close"},
+	"override.list":   {method: http.MethodGet, path: "/api/overrides"},
+	"override.create": {method: http.MethodPost, path: "/api/overrides"},
+	"override.delete": {method: http.MethodDelete, path: "/api/overrides/{id}"},
+	"preset.switch":   {method: http.MethodPost, path: "/api/overrides", transform: presetOverride},
+	"command":         {method: http.MethodPost, path: "/api/command"},
+}
+
+// presetOverride turns preset.switch params ({preset, accountId, symbol,
+// reason, duration|expiresAt}) into a PRESET override.
+func presetOverride(params map[string]json.RawMessage) {
+	if v, ok := params["preset"]; ok {
+		params["value"] = v
+		delete(params, "preset")
+	}
+	params["kind"] = json.RawMessage(`"` + string(model.OverridePreset) + `"`)
+}
+
+// handleRPC answers one inbound text message. REST-backed methods run on
+// their own goroutine, at most rpcMaxInflight per client.
+func (c *WSClient) handleRPC(msg []byte) {
+	var req rpcRequest
+	if err := json.Unmarshal(msg, &req); err != nil {
+		c.replyError(rpcNullID, rpcErrParse, "parse error: "+err.Error(), nil)
+		return
+	}
+	if req.JSONRPC != "2.0" || req.Method == "" {
+		id := req.ID
+		if len(id) == 0 {
+			id = rpcNullID
+		}
+		c.replyError(id, rpcErrInvalidRequest, `invalid request: want "jsonrpc":"2.0" and a method`, nil)
+		return
+	}
+
+	switch req.Method {
+	case "subscribe":
+		c.rpcSubscribe(req)
+		return
+	case "auth":
+		c.rpcAuth(req)
+		return
+	case "resync":
+		c.rpcResync(req)
+		return
+	}
+	route, ok := rpcRoutes[req.Method]
+	if !ok {
+		c.replyError(req.ID, rpcErrMethodNotFound, "method not found: "+req.Method, nil)
+		return
+	}
+	select {
+	case c.inflight <- struct{}{}:
+	default:
+		c.replyError(req.ID, rpcErrServer, "too many requests in flight",
+			&rpcErrorData{Status: http.StatusTooManyRequests, Code: "TOO_MANY_INFLIGHT"})
+		return
+	}
+	go func() {
+		defer func() { <-c.inflight }()
+		c.rpcCall(req, route)
+	}()
+}
+
+// rpcCall replays a request against its REST route with the client's
+// token and turns the response envelope into a result or error.
+func (c *WSClient) rpcCall(req rpcRequest, route rpcRoute) {
+	params := make(map[string]json.RawMessage)
+	if len(req.Params) > 0 && string(req.Params) != "null" {
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			c.replyError(req.ID, rpcErrInvalidParams, "params must be an object", nil)
+			return
+		}
+	}
+	if route.transform != nil {
+		route.transform(params)
+	}
+
+	var idemKey string
+	if raw, ok := params["idempotencyKey"]; ok {
+		if json.Unmarshal(raw, &idemKey) != nil {
+			c.replyError(req.ID, rpcErrInvalidParams, "idempotencyKey must be a string", nil)
+			return
+		}
+		delete(params, "idempotencyKey")
+	}
+
+	path, err := fillPath(route.path, params)
+	if err != nil {
+		c.replyError(req.ID, rpcErrInvalidParams, err.Error(), nil)
+		return
+	}
+	var body []byte
+	if route.method == http.MethodGet {
+		q := url.Values{}
+		for k, v := range params {
+			q.Set(k, paramString(v))
+		}
+		if len(q) > 0 {
+			path += "?" + q.Encode()
+		}
+	} else if len(params) > 0 {
+		body, _ = json.Marshal(params)
+	}
+
+	r, err := http.NewRequest(route.method, path, bytes.NewReader(body))
+	if err != nil {
+		c.replyError(req.ID, rpcErrInvalidParams, err.Error(), nil)
+		return
+	}
+	c.mu.Lock()
+	r.Header.Set("Authorization", "Bearer "+c.token)
+	c.mu.Unlock()
+	if body != nil {
+		r.Header.Set("Content-Type", "application/json")
+	}
+	if idemKey != "" {
+		r.Header.Set("Idempotency-Key", idemKey)
+	}
+	r.RemoteAddr = c.remoteAddr
+
+	rec := &rpcRecorder{header: make(http.Header), status: http.StatusOK}
+	c.rpc.ServeHTTP(rec, r)
+	c.replyFromREST(req.ID, rec)
+}
+
+// rpcSubscribe replaces the client's subscription. Params take the same
+// topics, account and symbol lists as the /ws query.
+func (c *WSClient) rpcSubscribe(req rpcRequest) {
+	var p struct {
+		Topics  []string `json:"topics"`
+		Account []string `json:"account"`
+		Symbol  []string `json:"symbol"`
+	}
+	if len(req.Params) > 0 {
+		dec := json.NewDecoder(bytes.NewReader(req.Params))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&p); err != nil {
+			c.replyError(req.ID, rpcErrInvalidParams, "invalid params: "+err.Error(), nil)
+			return
+		}
+	}
+	sub, errs := parseSubscription(url.Values{"topics": p.Topics, "account": p.Account, "symbol": p.Symbol})
+	if len(errs) > 0 {
+		c.replyError(req.ID, rpcErrInvalidParams, "invalid subscription",
+			&rpcErrorData{Status: http.StatusBadRequest, Code: "VALIDATION_FAILED", Details: errs})
+		return
+	}
+	c.hub.setSubscription(c, sub)
+	c.replyResult(req.ID, sub.view())
+}
+
+// rpcResync discards the client's queued events and answers with a full
+// status snapshot plus the per-topic sequence numbers it covers. The
+// response is queued ahead of every later event, so a client applies the
+// snapshot and then continues with seq+1 of each topic.
+func (c *WSClient) rpcResync(req rpcRequest) {
+	c.queue.resync(func(seq map[string]uint64) []byte {
+		if len(req.ID) == 0 {
+			return nil
+		}
+		resp := rpcResponse{JSONRPC: "2.0", ID: req.ID}
+		status, err := c.hub.snapshot()
+		if err == nil {
+			resp.Result, err = json.Marshal(struct {
+				Seq    map[string]uint64 `json:"seq"`
+				Status json.RawMessage   `json:"status"`
+			}{Seq: seq, Status: status})
+		}
+		if err != nil {
+			resp.Result = nil
+			resp.Error = &rpcError{Code: rpcErrServer, Message: err.Error()}
+		}
+		buf, _ := json.Marshal(resp)
+		return buf
+	})
+}
+
+// rpcAuth swaps in a fresh access token, typically after a refresh, once
+// the server accepts it.
+func (c *WSClient) rpcAuth(req rpcRequest) {
+	var p struct {
+		Token string `json:"token"`
+	}
+	if err := json.Unmarshal(req.Params, &p); err != nil || p.Token == "" {
+		c.replyError(req.ID, rpcErrInvalidParams, "params.token required", nil)
+		return
+	}
+	r, _ := http.NewRequest(http.MethodGet, "/api/auth/me", nil)
+	r.Header.Set("Authorization", "Bearer "+p.Token)
+	r.RemoteAddr = c.remoteAddr
+	rec := &rpcRecorder{header: make(http.Header), status: http.StatusOK}
+	c.rpc.ServeHTTP(rec, r)
+	if rec.status == http.StatusOK {
+		c.mu.Lock()
+		c.token = p.Token
+		c.mu.Unlock()
+	}
+	c.replyFromREST(req.ID, rec)
+}
+
+// replyFromREST converts a recorded REST response. Envelopes are unwrapped
+// to their data; routes that write bare JSON are passed through.
+func (c *WSClient) replyFromREST(id json.RawMessage, rec *rpcRecorder) {
+	var env struct {
+		Data    json.RawMessage    `json:"data"`
+		Error   string             `json:"error"`
+		Code    string             `json:"code"`
+		Details []model.FieldError `json:"details"`
+	}
+	isEnvelope := isAPIEnvelope(rec.body.Bytes())
+	if isEnvelope {
+		json.Unmarshal(rec.body.Bytes(), &env)
+	}
+
+	if rec.status >= 200 && rec.status < 300 {
+		result := json.RawMessage(bytes.TrimSpace(rec.body.Bytes()))
+		if isEnvelope {
+			result = env.Data
+		}
+		if len(result) == 0 {
+			result = json.RawMessage("null")
+		}
+		c.replyResult(id, result)
+		return
+	}
+
+	code := rpcErrServer
+	if rec.status == http.StatusBadRequest {
+		code = rpcErrInvalidParams
+	}
+	msg := env.Error
+	if msg == "" {
+		msg = strings.TrimSpace(rec.body.String())
+	}
+	if msg == "" {
+		msg = http.StatusText(rec.status)
+	}
+	c.replyError(id, code, msg, &rpcErrorData{Status: rec.status, Code: env.Code, Details: env.Details})
+}
+
+// replyResult sends a successful response.
+func (c *WSClient) replyResult(id json.RawMessage, result any) {
+	raw, ok := result.(json.RawMessage)
+	if !ok {
+		var err error
+		if raw, err = json.Marshal(result); err != nil {
+			c.replyError(id, rpcErrServer, err.Error(), nil)
+			return
+		}
+	}
+	c.reply(rpcResponse{JSONRPC: "2.0", ID: id, Result: raw})
+}
+
+// replyError sends an error response.
+func (c *WSClient) replyError(id json.RawMessage, code int, msg string, data *rpcErrorData) {
+	c.reply(rpcResponse{JSONRPC: "2.0", ID: id, Error: &rpcError{Code: code, Message: msg, Data: data}})
+}
+
+// reply writes a response directly on the connection, bypassing the hub
+// queue. Notifications (requests without an id) get no response.
+func (c *WSClient) reply(resp rpcResponse) {
+	if len(resp.ID) == 0 {
+		return
+	}
+	buf, err := json.Marshal(resp)
+	if err != nil {
+		return
+	}
+	c.ws.writeMessage(wsOpText, buf)
+}
+
+// fillPath substitutes {name} placeholders with params, removing them.
+func fillPath(pattern string, params map[string]json.RawMessage) (string, error) {
+	path := pattern
+	for {
+		start := strings.IndexByte(path, '{')
+		if start < 0 {
+			return path, nil
+		}
+		end := strings.IndexByte(path[start:], '}') + start
+		name := path[start+1 : end]
+		raw, ok := params[name]
+		if !ok {
+			return "", fmt.Errorf("params.%s required", name)
+		}
+		delete(params, name)
+		path = path[:start] + url.PathEscape(paramString(raw)) + path[end+1:]
+	}
+}
+
+// paramString renders a JSON value as a path or query value: strings
+// unquoted, anything else as written.
+func paramString(raw json.RawMessage) string {
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		return s
+	}
+	return string(raw)
+}
+
+// isAPIEnvelope reports whether body is a model.APIResponse rather than
+// bare JSON written by a route.
+func isAPIEnvelope(body []byte) bool {
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(body, &fields) != nil {
+		return false
+	}
+	if _, ok := fields["timestamp"]; !ok {
+		return false
+	}
+	for k := range fields {
+		switch k {
+		case "data", "error", "code", "details", "timestamp":
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// rpcRecorder captures the response of a replayed REST request.
+type rpcRecorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (r *rpcRecorder) Header() http.Header         { return r.header }
+func (r *rpcRecorder) WriteHeader(status int)      { r.status = status }
+func (r *rpcRecorder) Write(p []byte) (int, error) { return r.body.Write(p) }
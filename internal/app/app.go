@@ -2,18 +2,26 @@ package app
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"math"
 	"math/rand"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"syscall"
 	"time"
 
 	"go-trade/internal/api"
+	"go-trade/internal/audit"
+	"go-trade/internal/auth"
 	"go-trade/internal/bridge"
 	"go-trade/internal/config"
 	"go-trade/internal/engine"
+	"go-trade/internal/grpcserver"
 	"go-trade/internal/logging"
 	"go-trade/internal/model"
 
@@ -32,12 +40,22 @@ func New(cfg *config.Config) *App {
 
 // Run starts the full application: bridge, engine, API, and signal handling.
 func (a *App) Run() error {
+	if err := a.cfg.Validate(); err != nil {
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
+
 	log, err := logging.Build(a.cfg.App.LogLevel)
 	if err != nil {
 		return err
 	}
 	defer log.Sync()
 
+	release, err := LockDataDir(a.cfg.App.DataDir)
+	if err != nil {
+		return err
+	}
+	defer release()
+
 	log.Info("starting hayalet",
 		zap.String("version", "0.2.0"),
 		zap.String("log_level", a.cfg.App.LogLevel),
@@ -58,9 +76,19 @@ func (a *App) Run() error {
 
 	log.Info("bridge_opened", zap.String("mode", string(br.Mode())))
 
+	// Open the audit log and record the configuration in use
+	trail, err := audit.Open(filepath.Join(a.cfg.App.DataDir, "audit", "audit.jsonl"),
+		a.cfg.Audit.MaxSizeMB, a.cfg.Audit.MaxBackups)
+	if err != nil {
+		return err
+	}
+	defer trail.Close()
+	recordConfig(trail, a.cfg, log)
+
 	// Create engine
 	eng := engine.New(a.cfg, br)
 	eng.SetLogger(log)
+	eng.SetAudit(trail)
 
 	// Seed demo data if SHM is not available (pipe fallback)
 	if br.Mode() == bridge.ModePipe {
@@ -73,21 +101,41 @@ func (a *App) Run() error {
 
 	errCh := make(chan error, 4)
 
+	// Open dashboard user store
+	users, err := auth.OpenUserStore(filepath.Join(a.cfg.App.DataDir, "users.json"))
+	if err != nil {
+		return err
+	}
+	if users.Count() == 0 {
+		log.Warn("no_dashboard_users", zap.String("hint", "run `hayaletd bootstrap-admin` to create the first admin"))
+	}
+
+	// Create the API server; its WebSocket hub receives engine events
+	apiSrv := api.NewServer(a.cfg, eng, users, trail, log)
+	eng.SetEventSink(apiSrv.HubRef().Publish)
+
 	// Start engine
 	go func() {
 		errCh <- eng.Run(ctx)
 	}()
 
 	// Start API server
-	apiSrv := api.NewServer(a.cfg.API.ListenAddress, eng, log)
 	go func() {
 		errCh <- apiSrv.Run(ctx)
 	}()
 	log.Info("api_server_starting", zap.String("address", a.cfg.API.ListenAddress))
 
+	// Start gRPC server, served by the same REST routes and hub
+	if a.cfg.GRPC.ListenAddress != "" {
+		grpcSrv := grpcserver.New(a.cfg.GRPC.ListenAddress, apiSrv.Handler(), apiSrv.HubRef(), log)
+		go func() {
+			errCh <- grpcSrv.Run(ctx)
+		}()
+	}
+
 	// If demo mode, start live tick simulator
 	if br.Mode() == bridge.ModePipe {
-		go demoTickLoop(ctx, eng, log)
+		go demoTickLoop(ctx, eng, apiSrv.HubRef(), log)
 	}
 
 	// WebSocket broadcast loop (1 second interval)
@@ -111,6 +159,39 @@ func (a *App) Run() error {
 	return nil
 }
 
+// recordConfig appends a CONFIG entry with a hash of the loaded
+// configuration, marked CHANGED when it differs from the previous run.
+func recordConfig(trail *audit.Log, cfg *config.Config, log *zap.Logger) {
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		log.Error("config_hash_failed", zap.Error(err))
+		return
+	}
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+
+	action := "LOADED"
+	prev, err := trail.Query(audit.Filter{Kind: audit.KindConfig, Limit: 1})
+	if err != nil {
+		log.Warn("audit_query_failed", zap.Error(err))
+	} else if len(prev) > 0 && prev[0].Detail["sha256"] != hash {
+		action = "CHANGED"
+	}
+	err = trail.Append(audit.Entry{
+		Kind:   audit.KindConfig,
+		Actor:  "system",
+		Action: action,
+		Detail: map[string]string{
+			"sha256":        hash,
+			"env":           cfg.App.Env,
+			"defaultPreset": cfg.Engine.DefaultPreset,
+		},
+	})
+	if err != nil {
+		log.Error("audit_write_failed", zap.Error(err))
+	}
+}
+
 // wsBroadcastLoop sends periodic state updates to WebSocket clients.
 func wsBroadcastLoop(ctx context.Context, eng *engine.Engine, hub *api.Hub) {
 	ticker := time.NewTicker(1 * time.Second)
@@ -121,7 +202,7 @@ func wsBroadcastLoop(ctx context.Context, eng *engine.Engine, hub *api.Hub) {
 		case <-ctx.Done():
 			return
 		case <-ticker.C:
-			if hub.ClientCount() == 0 {
+			if hub.Idle() {
 				continue
 			}
 			status := eng.Status()
@@ -171,8 +252,9 @@ func seedDemoData(eng *engine.Engine, log *zap.Logger) {
 	)
 }
 
-// demoTickLoop continuously updates tick prices to simulate live market movement.
-func demoTickLoop(ctx context.Context, eng *engine.Engine, log *zap.Logger) {
+// demoTickLoop continuously updates tick prices to simulate live market movement
+// and publishes them to WebSocket subscribers.
+func demoTickLoop(ctx context.Context, eng *engine.Engine, hub *api.Hub, log *zap.Logger) {
 	log.Info("starting demo tick simulator")
 
 	type symbolState struct {
@@ -219,16 +301,21 @@ func demoTickLoop(ctx context.Context, eng *engine.Engine, log *zap.Logger) {
 				})
 			}
 			store.AddTicks(ticks)
+			for _, t := range ticks {
+				hub.Publish(engine.Event{Topic: model.TopicTick, Symbol: t.Symbol, Data: t, Time: now})
+			}
 
 			if step%10 == 0 {
 				equity := 10000.0 + (rng.Float64()-0.48)*50 - float64(step%100)*0.1
-				store.SetAccount(model.AccountState{
+				acct := model.AccountState{
 					AccountID: "25289974",
 					Balance:   10000.00,
 					Equity:    math.Round(equity*100) / 100,
 					Margin:    312.50 + rng.Float64()*10,
 					Time:      now,
-				})
+				}
+				store.SetAccount(acct)
+				hub.Publish(engine.Event{Topic: model.TopicAccount, AccountID: acct.AccountID, Data: acct, Time: now})
 			}
 		}
 	}
@@ -0,0 +1,40 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// lockFileName is the file in the data directory the daemon holds locked
+// while it runs. The lock goes away with the process, so a crash leaves
+// nothing stale behind.
+const lockFileName = "hayaletd.lock"
+
+// ErrDaemonRunning is returned by LockDataDir while another process holds
+// the data directory.
+var ErrDaemonRunning = errors.New("hayaletd is running on this data directory")
+
+// LockDataDir takes the exclusive lock on dataDir. The daemon holds it for
+// its lifetime; offline commands that rewrite its files take it too, so
+// they refuse to run behind a live daemon. Call release to drop it.
+func LockDataDir(dataDir string) (release func(), err error) {
+	if err := os.MkdirAll(dataDir, 0o755); err != nil {
+		return nil, fmt.Errorf("creating data directory: %w", err)
+	}
+	f, err := os.OpenFile(filepath.Join(dataDir, lockFileName), os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("opening lock file: %w", err)
+	}
+	if err := lockFile(f); err != nil {
+		f.Close()
+		return nil, err
+	}
+	f.Truncate(0)
+	fmt.Fprintf(f, "%d\n", os.Getpid())
+	return func() {
+		unlockFile(f)
+		f.Close()
+	}, nil
+}
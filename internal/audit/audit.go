@@ -0,0 +1,392 @@
+// Package audit implements the append-only, hash-chained audit log of
+// commands, guard transitions, configuration loads and operator actions.
+//
+// Each entry is one JSON line carrying the hash of the previous entry and
+// its own SHA-256 hash over that link and its content, so editing, removing
+// or reordering lines breaks the chain. Files are rotated by size; the chain
+// continues across rotated files.
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go-trade/internal/model"
+
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// Entry kinds.
+const (
+	KindCommand  = "COMMAND"
+	KindGuard    = "GUARD"
+	KindConfig   = "CONFIG"
+	KindOperator = "OPERATOR"
+)
+
+// maxLineSize bounds a single audit line when reading the files back.
+const maxLineSize = 1 << 20
+
+// Entry is one audit record.
+type Entry struct {
+	Seq       int64             `json:"seq"`
+	Time      time.Time         `json:"time"`
+	Kind      string            `json:"kind"`
+	Actor     string            `json:"actor"` // strategy:grid, api:alice, guard, system
+	Action    string            `json:"action"`
+	AccountID string            `json:"accountId,omitempty"`
+	Symbol    string            `json:"symbol,omitempty"`
+	Reason    string            `json:"reason,omitempty"`
+	Command   *model.Command    `json:"command,omitempty"`
+	Detail    map[string]string `json:"detail,omitempty"`
+	PrevHash  string            `json:"prevHash"`
+	Hash      string            `json:"hash"`
+}
+
+// Filter selects entries in Query. Zero fields match everything; Reason
+// matches case-insensitively as a substring.
+type Filter struct {
+	From      time.Time
+	To        time.Time
+	Kind      string
+	Actor     string
+	AccountID string
+	Symbol    string
+	Reason    string
+	Limit     int
+}
+
+// VerifyResult reports the outcome of a chain verification.
+type VerifyResult struct {
+	OK       bool   `json:"ok"`
+	Entries  int64  `json:"entries"`
+	Files    int    `json:"files"`
+	FirstSeq int64  `json:"firstSeq"`
+	LastSeq  int64  `json:"lastSeq"`
+	BrokenAt int64  `json:"brokenAt,omitempty"`
+	File     string `json:"file,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Log is an append-only audit log.
+type Log struct {
+	path string
+	mu   sync.Mutex
+	w    *lumberjack.Logger
+	seq  int64
+	last string
+}
+
+// Open opens or creates the audit log at path, rotating it at maxSizeMB
+// and keeping maxBackups rotated files (0 keeps all). The chain resumes
+// from the last entry on disk.
+func Open(path string, maxSizeMB, maxBackups int) (*Log, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("creating audit directory: %w", err)
+	}
+	l := &Log{
+		path: path,
+		w: &lumberjack.Logger{
+			Filename:   path,
+			MaxSize:    maxSizeMB,
+			MaxBackups: maxBackups,
+		},
+	}
+	files, err := l.files()
+	if err != nil {
+		return nil, err
+	}
+	for i := len(files) - 1; i >= 0; i-- {
+		last, ok, err := lastEntry(files[i])
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			l.seq = last.Seq
+			l.last = last.Hash
+			break
+		}
+	}
+	if err := terminateLine(path); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Append stamps an entry with the next sequence number and chain hash and
+// writes it. Time defaults to now.
+func (l *Log) Append(e Entry) error {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	e.Seq = l.seq + 1
+	e.PrevHash = l.last
+	hash, err := entryHash(e)
+	if err != nil {
+		return err
+	}
+	e.Hash = hash
+	line, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("encoding audit entry: %w", err)
+	}
+	if _, err := l.w.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("writing audit entry: %w", err)
+	}
+	l.seq = e.Seq
+	l.last = e.Hash
+	return nil
+}
+
+// Query returns matching entries, newest first, at most f.Limit of them.
+// It reads a snapshot of the files without holding the append lock, so
+// entries appended meanwhile are not returned. Lines that do not decode
+// are skipped; Verify reports them.
+func (l *Log) Query(f Filter) ([]Entry, error) {
+	files, err := l.snapshot()
+	if err != nil {
+		return nil, err
+	}
+	reason := strings.ToLower(f.Reason)
+	var out []Entry
+	for _, file := range files {
+		err := scan(file, true, func(e Entry) error {
+			if (!f.From.IsZero() && e.Time.Before(f.From)) ||
+				(!f.To.IsZero() && e.Time.After(f.To)) ||
+				(f.Kind != "" && e.Kind != f.Kind) ||
+				(f.Actor != "" && e.Actor != f.Actor) ||
+				(f.AccountID != "" && e.AccountID != f.AccountID) ||
+				(f.Symbol != "" && e.Symbol != f.Symbol) ||
+				(reason != "" && !strings.Contains(strings.ToLower(e.Reason), reason)) {
+				return nil
+			}
+			out = append(out, e)
+			if f.Limit > 0 && len(out) > f.Limit {
+				out = out[1:]
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return out, nil
+}
+
+// Verify walks every file and checks sequence numbers, links and hashes.
+// The oldest remaining entry anchors the chain, since rotated files may
+// have been pruned. Like Query it reads a snapshot without the append lock.
+func (l *Log) Verify() (VerifyResult, error) {
+	files, err := l.snapshot()
+	if err != nil {
+		return VerifyResult{}, err
+	}
+	res := VerifyResult{OK: true, Files: len(files)}
+	errBroken := errors.New("broken")
+	var prev Entry
+	for _, file := range files {
+		name := file.name
+		err := scan(file, false, func(e Entry) error {
+			want, err := entryHash(e)
+			switch {
+			case err != nil:
+				res.Error = err.Error()
+			case e.Hash != want:
+				res.Error = "hash mismatch"
+			case res.Entries > 0 && e.Seq != prev.Seq+1:
+				res.Error = fmt.Sprintf("sequence gap after %d", prev.Seq)
+			case res.Entries > 0 && e.PrevHash != prev.Hash:
+				res.Error = "previous hash mismatch"
+			}
+			if res.Error != "" {
+				res.OK = false
+				res.BrokenAt = e.Seq
+				res.File = filepath.Base(name)
+				return errBroken
+			}
+			if res.Entries == 0 {
+				res.FirstSeq = e.Seq
+			}
+			res.Entries++
+			res.LastSeq = e.Seq
+			prev = e
+			return nil
+		})
+		if errors.Is(err, errBroken) {
+			return res, nil
+		}
+		if err != nil {
+			res.OK = false
+			res.File = filepath.Base(name)
+			res.Error = err.Error()
+			return res, nil
+		}
+	}
+	return res, nil
+}
+
+// Close closes the current file.
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.w.Close()
+}
+
+// files returns the rotated files oldest first, followed by the current
+// file when it exists. Rotated names embed a sortable timestamp.
+func (l *Log) files() ([]string, error) {
+	ext := filepath.Ext(l.path)
+	prefix := strings.TrimSuffix(l.path, ext) + "-"
+	backups, err := filepath.Glob(prefix + "*" + ext)
+	if err != nil {
+		return nil, fmt.Errorf("listing audit files: %w", err)
+	}
+	sort.Strings(backups)
+	if _, err := os.Stat(l.path); err == nil {
+		backups = append(backups, l.path)
+	}
+	return backups, nil
+}
+
+// snapshotFile is a file to read and the size it had when the snapshot
+// was taken.
+type snapshotFile struct {
+	name string
+	size int64
+}
+
+// snapshot lists the files and their sizes under the append lock, so
+// readers see only complete entries and never block Append while reading.
+func (l *Log) snapshot() ([]snapshotFile, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	names, err := l.files()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]snapshotFile, 0, len(names))
+	for _, name := range names {
+		info, err := os.Stat(name)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading audit file: %w", err)
+		}
+		out = append(out, snapshotFile{name: name, size: info.Size()})
+	}
+	return out, nil
+}
+
+// entryHash hashes an entry's content with its Hash field cleared.
+func entryHash(e Entry) (string, error) {
+	e.Hash = ""
+	data, err := json.Marshal(e)
+	if err != nil {
+		return "", fmt.Errorf("encoding audit entry: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// scan decodes every line of a file in order, up to its snapshot size.
+// With skipBad, lines that do not decode are skipped instead of failing.
+// A file rotated away since the snapshot is skipped.
+func scan(file snapshotFile, skipBad bool, fn func(Entry) error) error {
+	name := file.name
+	f, err := os.Open(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("opening audit file: %w", err)
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(io.LimitReader(f, file.size))
+	sc.Buffer(make([]byte, 64<<10), maxLineSize)
+	line := 0
+	for sc.Scan() {
+		line++
+		raw := bytes.TrimSpace(sc.Bytes())
+		if len(raw) == 0 {
+			continue
+		}
+		var e Entry
+		if err := json.Unmarshal(raw, &e); err != nil {
+			if skipBad {
+				continue
+			}
+			return fmt.Errorf("%s line %d: %w", filepath.Base(name), line, err)
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	return sc.Err()
+}
+
+// lastEntry returns the final decodable entry of a file, if any. Lines
+// that do not decode (such as one cut short by a crash) are skipped here
+// and reported by Verify.
+func lastEntry(name string) (Entry, bool, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return Entry{}, false, fmt.Errorf("opening audit file: %w", err)
+	}
+	defer f.Close()
+	var last Entry
+	found := false
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64<<10), maxLineSize)
+	for sc.Scan() {
+		var e Entry
+		if json.Unmarshal(sc.Bytes(), &e) == nil && e.Hash != "" {
+			last, found = e, true
+		}
+	}
+	return last, found, sc.Err()
+}
+
+// terminateLine appends a newline when a crash left the file's last line
+// unterminated, so the next entry starts on its own line.
+func terminateLine(name string) error {
+	f, err := os.OpenFile(name, os.O_RDWR, 0)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("opening audit file: %w", err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil || info.Size() == 0 {
+		return err
+	}
+	last := make([]byte, 1)
+	if _, err := f.ReadAt(last, info.Size()-1); err != nil {
+		return fmt.Errorf("reading audit file: %w", err)
+	}
+	if last[0] == '\n' {
+		return nil
+	}
+	_, err = f.WriteAt([]byte{'\n'}, info.Size())
+	return err
+}
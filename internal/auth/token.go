@@ -0,0 +1,140 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"go-trade/internal/model"
+)
+
+// Token types carried in the "typ" claim.
+const (
+	TokenAccess  = "access"
+	TokenRefresh = "refresh"
+)
+
+// ErrInvalidToken is returned for malformed, forged or expired tokens.
+var ErrInvalidToken = errors.New("invalid or expired token")
+
+// jwtHeader is the fixed HS256 JOSE header.
+var jwtHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+// Claims is the JWT payload issued by the API.
+type Claims struct {
+	Subject   string         `json:"sub"`
+	Username  string         `json:"name"`
+	Role      model.UserRole `json:"role"`
+	Type      string         `json:"typ"`
+	SessionID string         `json:"sid"`
+	Nonce     string         `json:"jti,omitempty"` // refresh rotation nonce
+	IssuedAt  int64          `json:"iat"`
+	ExpiresAt int64          `json:"exp"`
+}
+
+// TokenPair is returned on login and refresh.
+type TokenPair struct {
+	AccessToken      string    `json:"accessToken"`
+	RefreshToken     string    `json:"refreshToken"`
+	AccessExpiresAt  time.Time `json:"accessExpiresAt"`
+	RefreshExpiresAt time.Time `json:"refreshExpiresAt"`
+}
+
+// TokenIssuer signs and verifies HS256 JWTs.
+type TokenIssuer struct {
+	secret     []byte
+	accessTTL  time.Duration
+	refreshTTL time.Duration
+}
+
+// NewTokenIssuer creates an issuer with the given secret and lifetimes.
+func NewTokenIssuer(secret string, accessTTL, refreshTTL time.Duration) *TokenIssuer {
+	return &TokenIssuer{
+		secret:     []byte(secret),
+		accessTTL:  accessTTL,
+		refreshTTL: refreshTTL,
+	}
+}
+
+// Issue creates an access and a refresh token for a user session. nonce
+// binds the refresh token to the session's current rotation.
+func (t *TokenIssuer) Issue(user User, sessionID, nonce string, now time.Time) (TokenPair, error) {
+	access := Claims{
+		Subject:   user.ID,
+		Username:  user.Username,
+		Role:      user.Role,
+		Type:      TokenAccess,
+		SessionID: sessionID,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(t.accessTTL).Unix(),
+	}
+	refresh := access
+	refresh.Type = TokenRefresh
+	refresh.Nonce = nonce
+	refresh.ExpiresAt = now.Add(t.refreshTTL).Unix()
+
+	accessTok, err := t.sign(access)
+	if err != nil {
+		return TokenPair{}, err
+	}
+	refreshTok, err := t.sign(refresh)
+	if err != nil {
+		return TokenPair{}, err
+	}
+	return TokenPair{
+		AccessToken:      accessTok,
+		RefreshToken:     refreshTok,
+		AccessExpiresAt:  time.Unix(access.ExpiresAt, 0),
+		RefreshExpiresAt: time.Unix(refresh.ExpiresAt, 0),
+	}, nil
+}
+
+// RefreshTTL returns the refresh token lifetime.
+func (t *TokenIssuer) RefreshTTL() time.Duration {
+	return t.refreshTTL
+}
+
+// Parse verifies a token's signature, expiry and type and returns its claims.
+func (t *TokenIssuer) Parse(token, wantType string, now time.Time) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || parts[0] != jwtHeader {
+		return Claims{}, ErrInvalidToken
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || !hmac.Equal(sig, t.mac(parts[0]+"."+parts[1])) {
+		return Claims{}, ErrInvalidToken
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return Claims{}, ErrInvalidToken
+	}
+	var c Claims
+	if err := json.Unmarshal(payload, &c); err != nil {
+		return Claims{}, ErrInvalidToken
+	}
+	if c.Type != wantType || now.Unix() >= c.ExpiresAt {
+		return Claims{}, ErrInvalidToken
+	}
+	return c, nil
+}
+
+// sign encodes and signs claims.
+func (t *TokenIssuer) sign(c Claims) (string, error) {
+	payload, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	unsigned := jwtHeader + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(t.mac(unsigned)), nil
+}
+
+// mac returns the HMAC-SHA256 of s under the issuer secret.
+func (t *TokenIssuer) mac(s string) []byte {
+	m := hmac.New(sha256.New, t.secret)
+	m.Write([]byte(s))
+	return m.Sum(nil)
+}
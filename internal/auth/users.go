@@ -0,0 +1,598 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go-trade/internal/model"
+)
+
+// Errors returned by UserStore.
+var (
+	ErrBadCredentials = errors.New("invalid username or password")
+	ErrUserDisabled   = errors.New("user disabled")
+	ErrSessionInvalid = errors.New("session expired or revoked")
+	ErrUserNotFound   = errors.New("user not found")
+	ErrUserExists     = errors.New("username already taken")
+	ErrNoUsername     = errors.New("username required")
+	ErrLastAdmin      = errors.New("cannot remove the last enabled admin")
+	ErrWeakPassword   = fmt.Errorf("password must be at least %d characters", minPasswordLength)
+	ErrInvalidRole    = errors.New("role must be ADMIN, OPERATOR or VIEWER")
+)
+
+// minPasswordLength is the shortest accepted password.
+const minPasswordLength = 8
+
+// refreshReuseGrace is how long the previous refresh nonce of a session
+// is still accepted after a rotation, so two tabs refreshing with the
+// same token at once do not revoke the session.
+const refreshReuseGrace = 10 * time.Second
+
+// User is a dashboard account as persisted in the user store.
+type User struct {
+	model.DashboardUser
+	PasswordHash  string    `json:"passwordHash"`
+	Disabled      bool      `json:"disabled"`
+	MustResetPass bool      `json:"mustResetPassword"`
+	CreatedAt     time.Time `json:"createdAt"`
+	UpdatedAt     time.Time `json:"updatedAt"`
+}
+
+// UserInfo is the API view of a user, without the password hash.
+type UserInfo struct {
+	model.DashboardUser
+	Disabled      bool      `json:"disabled"`
+	MustResetPass bool      `json:"mustResetPassword"`
+	CreatedAt     time.Time `json:"createdAt"`
+	UpdatedAt     time.Time `json:"updatedAt"`
+}
+
+// Info returns the API view of the user.
+func (u User) Info() UserInfo {
+	return UserInfo{
+		DashboardUser: u.DashboardUser,
+		Disabled:      u.Disabled,
+		MustResetPass: u.MustResetPass,
+		CreatedAt:     u.CreatedAt,
+		UpdatedAt:     u.UpdatedAt,
+	}
+}
+
+// UserUpdate holds the mutable fields of a user; nil fields are unchanged.
+type UserUpdate struct {
+	Role   *model.UserRole `json:"role"`
+	Locale *string         `json:"locale"`
+}
+
+// Session is a login session backing a refresh token.
+type Session struct {
+	ID         string    `json:"id"`
+	UserID     string    `json:"userId"`
+	Username   string    `json:"username"`
+	Nonce      string    `json:"nonce"`
+	PrevNonce  string    `json:"prevNonce,omitempty"`
+	RotatedAt  time.Time `json:"rotatedAt"`
+	RemoteAddr string    `json:"remoteAddr"`
+	CreatedAt  time.Time `json:"createdAt"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+	LastSeenAt time.Time `json:"lastSeenAt"`
+}
+
+// SessionInfo is the API view of a session, without the refresh nonce.
+type SessionInfo struct {
+	ID         string    `json:"id"`
+	UserID     string    `json:"userId"`
+	Username   string    `json:"username"`
+	RemoteAddr string    `json:"remoteAddr"`
+	CreatedAt  time.Time `json:"createdAt"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+	LastSeenAt time.Time `json:"lastSeenAt"`
+}
+
+// storeFile is the on-disk layout of the user store.
+type storeFile struct {
+	Users    []User    `json:"users"`
+	Sessions []Session `json:"sessions"`
+}
+
+// dummyHash is checked against when a username is unknown so failed
+// logins take the same time whether or not the user exists.
+var dummyHash = sync.OnceValue(func() string {
+	h, _ := HashPassword("hayalet-dummy-password")
+	return h
+})
+
+// UserStore is a JSON-file backed store of dashboard users and sessions.
+type UserStore struct {
+	mu       sync.Mutex
+	path     string
+	users    map[string]*User // by ID
+	sessions map[string]*Session
+}
+
+// OpenUserStore loads the store from path, creating an empty one when the
+// file does not exist yet.
+func OpenUserStore(path string) (*UserStore, error) {
+	s := &UserStore{
+		path:     path,
+		users:    make(map[string]*User),
+		sessions: make(map[string]*Session),
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading user store: %w", err)
+	}
+	var f storeFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("parsing user store %s: %w", path, err)
+	}
+	for i := range f.Users {
+		u := f.Users[i]
+		s.users[u.ID] = &u
+	}
+	now := time.Now()
+	for i := range f.Sessions {
+		sess := f.Sessions[i]
+		if now.Before(sess.ExpiresAt) {
+			s.sessions[sess.ID] = &sess
+		}
+	}
+	return s, nil
+}
+
+// Count returns the number of users.
+func (s *UserStore) Count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.users)
+}
+
+// Get returns a user by ID.
+func (s *UserStore) Get(id string) (User, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[id]
+	if !ok {
+		return User{}, false
+	}
+	return *u, true
+}
+
+// List returns all users sorted by username.
+func (s *UserStore) List() []UserInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]UserInfo, 0, len(s.users))
+	for _, u := range s.users {
+		out = append(out, u.Info())
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Username < out[j].Username })
+	return out
+}
+
+// HasAdmin reports whether an enabled admin exists.
+func (s *UserStore) HasAdmin() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.enabledAdmins("") > 0
+}
+
+// Create adds a user with the given password.
+func (s *UserStore) Create(username, password string, role model.UserRole, locale string) (User, error) {
+	username = strings.TrimSpace(username)
+	if username == "" {
+		return User{}, ErrNoUsername
+	}
+	if !validRole(role) {
+		return User{}, ErrInvalidRole
+	}
+	if len(password) < minPasswordLength {
+		return User{}, ErrWeakPassword
+	}
+	if locale == "" {
+		locale = "tr"
+	}
+	hash, err := HashPassword(password)
+	if err != nil {
+		return User{}, err
+	}
+	id, err := randomID("usr_")
+	if err != nil {
+		return User{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.byUsername(username) != nil {
+		return User{}, ErrUserExists
+	}
+	now := time.Now()
+	u := &User{
+		DashboardUser: model.DashboardUser{
+			ID:       id,
+			Username: username,
+			Role:     role,
+			Locale:   locale,
+		},
+		PasswordHash: hash,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	s.users[id] = u
+	if err := s.save(); err != nil {
+		delete(s.users, id)
+		return User{}, err
+	}
+	return *u, nil
+}
+
+// Update changes a user's role and/or locale.
+func (s *UserStore) Update(id string, upd UserUpdate) (User, error) {
+	if upd.Role != nil && !validRole(*upd.Role) {
+		return User{}, ErrInvalidRole
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[id]
+	if !ok {
+		return User{}, ErrUserNotFound
+	}
+	if upd.Role != nil && *upd.Role != model.RoleAdmin && u.Role == model.RoleAdmin &&
+		!u.Disabled && s.enabledAdmins(id) == 0 {
+		return User{}, ErrLastAdmin
+	}
+	prev := *u
+	if upd.Role != nil {
+		u.Role = *upd.Role
+	}
+	if upd.Locale != nil {
+		u.Locale = *upd.Locale
+	}
+	u.UpdatedAt = time.Now()
+	if err := s.save(); err != nil {
+		*u = prev
+		return User{}, err
+	}
+	return *u, nil
+}
+
+// SetDisabled enables or disables a user. Disabling revokes its sessions.
+func (s *UserStore) SetDisabled(id string, disabled bool) (User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[id]
+	if !ok {
+		return User{}, ErrUserNotFound
+	}
+	if disabled && u.Role == model.RoleAdmin && !u.Disabled && s.enabledAdmins(id) == 0 {
+		return User{}, ErrLastAdmin
+	}
+	u.Disabled = disabled
+	u.UpdatedAt = time.Now()
+	if disabled {
+		s.endUserSessions(id)
+	}
+	return *u, s.save()
+}
+
+// Delete removes a user and its sessions.
+func (s *UserStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[id]
+	if !ok {
+		return ErrUserNotFound
+	}
+	if u.Role == model.RoleAdmin && !u.Disabled && s.enabledAdmins(id) == 0 {
+		return ErrLastAdmin
+	}
+	delete(s.users, id)
+	s.endUserSessions(id)
+	return s.save()
+}
+
+// ForceReset sets a temporary password, flags the user to change it on
+// next use and revokes its sessions. An empty password keeps the current
+// one but still requires a change.
+func (s *UserStore) ForceReset(id, tempPassword string) (User, error) {
+	var hash string
+	if tempPassword != "" {
+		if len(tempPassword) < minPasswordLength {
+			return User{}, ErrWeakPassword
+		}
+		var err error
+		if hash, err = HashPassword(tempPassword); err != nil {
+			return User{}, err
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[id]
+	if !ok {
+		return User{}, ErrUserNotFound
+	}
+	if hash != "" {
+		u.PasswordHash = hash
+	}
+	u.MustResetPass = true
+	u.UpdatedAt = time.Now()
+	s.endUserSessions(id)
+	return *u, s.save()
+}
+
+// ChangePassword replaces a user's password after checking the current
+// one, and clears a pending forced reset.
+func (s *UserStore) ChangePassword(id, current, next string) error {
+	if len(next) < minPasswordLength {
+		return ErrWeakPassword
+	}
+	s.mu.Lock()
+	u, ok := s.users[id]
+	var hash string
+	if ok {
+		hash = u.PasswordHash
+	}
+	s.mu.Unlock()
+	if !ok {
+		return ErrUserNotFound
+	}
+	if !CheckPassword(hash, current) {
+		return ErrBadCredentials
+	}
+	newHash, err := HashPassword(next)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok = s.users[id]
+	if !ok {
+		return ErrUserNotFound
+	}
+	u.PasswordHash = newHash
+	u.MustResetPass = false
+	u.UpdatedAt = time.Now()
+	return s.save()
+}
+
+// Sessions returns active sessions, newest first.
+func (s *UserStore) Sessions(now time.Time) []SessionInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]SessionInfo, 0, len(s.sessions))
+	for _, sess := range s.sessions {
+		if now.After(sess.ExpiresAt) {
+			continue
+		}
+		out = append(out, SessionInfo{
+			ID:         sess.ID,
+			UserID:     sess.UserID,
+			Username:   sess.Username,
+			RemoteAddr: sess.RemoteAddr,
+			CreatedAt:  sess.CreatedAt,
+			ExpiresAt:  sess.ExpiresAt,
+			LastSeenAt: sess.LastSeenAt,
+		})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.After(out[j].CreatedAt) })
+	return out
+}
+
+// Authenticate checks a username/password pair.
+func (s *UserStore) Authenticate(username, password string) (User, error) {
+	s.mu.Lock()
+	u := s.byUsername(username)
+	var user User
+	if u != nil {
+		user = *u
+	}
+	s.mu.Unlock()
+
+	if u == nil {
+		CheckPassword(dummyHash(), password)
+		return User{}, ErrBadCredentials
+	}
+	if !CheckPassword(user.PasswordHash, password) {
+		return User{}, ErrBadCredentials
+	}
+	if user.Disabled {
+		return User{}, ErrUserDisabled
+	}
+	return user, nil
+}
+
+// StartSession opens a new session for a user and persists it.
+func (s *UserStore) StartSession(user User, remoteAddr string, ttl time.Duration, now time.Time) (Session, error) {
+	id, err := randomID("ses_")
+	if err != nil {
+		return Session{}, err
+	}
+	nonce, err := randomID("")
+	if err != nil {
+		return Session{}, err
+	}
+	sess := &Session{
+		ID:         id,
+		UserID:     user.ID,
+		Username:   user.Username,
+		Nonce:      nonce,
+		RemoteAddr: remoteAddr,
+		CreatedAt:  now,
+		ExpiresAt:  now.Add(ttl),
+		LastSeenAt: now,
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pruneSessions(now)
+	s.sessions[id] = sess
+	return *sess, s.save()
+}
+
+// RotateSession validates a refresh token's nonce and replaces it, so each
+// refresh token can be used once. A reused nonce revokes the session,
+// except for the previous nonce within refreshReuseGrace of the rotation:
+// that concurrent refresh gets the current nonce back.
+func (s *UserStore) RotateSession(id, nonce string, ttl time.Duration, now time.Time) (Session, error) {
+	next, err := randomID("")
+	if err != nil {
+		return Session{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sess, ok := s.sessions[id]
+	if !ok || now.After(sess.ExpiresAt) {
+		return Session{}, ErrSessionInvalid
+	}
+	if u, ok := s.users[sess.UserID]; !ok || u.Disabled {
+		delete(s.sessions, id)
+		s.save()
+		return Session{}, ErrSessionInvalid
+	}
+	if sess.Nonce != nonce {
+		if sess.PrevNonce != "" && nonce == sess.PrevNonce && now.Sub(sess.RotatedAt) < refreshReuseGrace {
+			sess.LastSeenAt = now
+			return *sess, nil
+		}
+		delete(s.sessions, id)
+		s.save()
+		return Session{}, ErrSessionInvalid
+	}
+	sess.PrevNonce = nonce
+	sess.RotatedAt = now
+	sess.Nonce = next
+	sess.ExpiresAt = now.Add(ttl)
+	sess.LastSeenAt = now
+	return *sess, s.save()
+}
+
+// ValidateSession checks that a session is live and its user enabled, and
+// returns the current user so role changes apply immediately.
+func (s *UserStore) ValidateSession(id string, now time.Time) (User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sess, ok := s.sessions[id]
+	if !ok || now.After(sess.ExpiresAt) {
+		return User{}, ErrSessionInvalid
+	}
+	u, ok := s.users[sess.UserID]
+	if !ok || u.Disabled {
+		return User{}, ErrSessionInvalid
+	}
+	sess.LastSeenAt = now
+	return *u, nil
+}
+
+// EndSession revokes a session.
+func (s *UserStore) EndSession(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.sessions[id]; !ok {
+		return nil
+	}
+	delete(s.sessions, id)
+	return s.save()
+}
+
+// endUserSessions revokes every session of a user. Caller must hold s.mu.
+func (s *UserStore) endUserSessions(userID string) {
+	for id, sess := range s.sessions {
+		if sess.UserID == userID {
+			delete(s.sessions, id)
+		}
+	}
+}
+
+// enabledAdmins counts enabled admins other than except. Caller must hold s.mu.
+func (s *UserStore) enabledAdmins(except string) int {
+	n := 0
+	for id, u := range s.users {
+		if id != except && u.Role == model.RoleAdmin && !u.Disabled {
+			n++
+		}
+	}
+	return n
+}
+
+// validRole reports whether role is one of the known roles.
+func validRole(role model.UserRole) bool {
+	switch role {
+	case model.RoleAdmin, model.RoleOperator, model.RoleViewer:
+		return true
+	}
+	return false
+}
+
+// byUsername finds a user case-insensitively. Caller must hold s.mu.
+func (s *UserStore) byUsername(username string) *User {
+	for _, u := range s.users {
+		if strings.EqualFold(u.Username, username) {
+			return u
+		}
+	}
+	return nil
+}
+
+// pruneSessions drops expired sessions. Caller must hold s.mu.
+func (s *UserStore) pruneSessions(now time.Time) {
+	for id, sess := range s.sessions {
+		if now.After(sess.ExpiresAt) {
+			delete(s.sessions, id)
+		}
+	}
+}
+
+// save writes the store atomically. Caller must hold s.mu.
+func (s *UserStore) save() error {
+	f := storeFile{
+		Users:    make([]User, 0, len(s.users)),
+		Sessions: make([]Session, 0, len(s.sessions)),
+	}
+	for _, u := range s.users {
+		f.Users = append(f.Users, *u)
+	}
+	for _, sess := range s.sessions {
+		f.Sessions = append(f.Sessions, *sess)
+	}
+	sort.Slice(f.Users, func(i, j int) bool { return f.Users[i].Username < f.Users[j].Username })
+	sort.Slice(f.Sessions, func(i, j int) bool { return f.Sessions[i].CreatedAt.Before(f.Sessions[j].CreatedAt) })
+
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding user store: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return fmt.Errorf("creating data directory: %w", err)
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("writing user store: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("replacing user store: %w", err)
+	}
+	return nil
+}
+
+// randomID returns prefix followed by 16 random bytes in hex.
+func randomID(prefix string) (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("generating id: %w", err)
+	}
+	return prefix + hex.EncodeToString(buf), nil
+}
@@ -92,6 +92,19 @@ func (b *Bridge) SendCommand(cmd model.Command) bool {
 	}
 }
 
+// CommandQueue reports commands waiting for the EA and the queue capacity.
+// Both are zero when the SHM header cannot be read.
+func (b *Bridge) CommandQueue() (pending, capacity int) {
+	if b.shm != nil {
+		p, c, err := b.shm.CommandBacklog()
+		if err != nil {
+			return 0, 0
+		}
+		return int(p), int(c)
+	}
+	return len(b.cmdQ), cap(b.cmdQ)
+}
+
 // Heartbeat sends a heartbeat timestamp through the bridge.
 func (b *Bridge) Heartbeat(ts time.Time) {
 	if b.shm != nil {
@@ -260,6 +260,16 @@ func (s *SharedMemory) WriteCommand(cmd model.Command) bool {
 	return true
 }
 
+// CommandBacklog returns how many commands the EA has not read yet and the
+// command ring capacity.
+func (s *SharedMemory) CommandBacklog() (pending, capacity uint32, err error) {
+	hdr, err := s.readHeader()
+	if err != nil {
+		return 0, 0, err
+	}
+	return hdr.CommandWrite - hdr.CommandRead, hdr.CommandCapacity, nil
+}
+
 // Heartbeat writes the current timestamp to the SHM heartbeat field.
 func (s *SharedMemory) Heartbeat(ts time.Time) {
 	val := uint64(ts.UnixNano())
@@ -334,6 +344,8 @@ func commandTypeToInt(t model.CommandType) int32 {
 		return 7
 	case model.CommandFreeze:
 		return 8
+	case model.CommandPartialClose:
+		return 9
 	default:
 		return 0
 	}
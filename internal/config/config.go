@@ -2,6 +2,7 @@
 package config
 
 import (
+	"errors"
 	"fmt"
 	"os"
 
@@ -20,12 +21,14 @@ type Config struct {
 	API       APIConfig       `yaml:"api" validate:"required"`
 	GRPC      GRPCConfig      `yaml:"grpc"`
 	Dashboard DashboardConfig `yaml:"dashboard"`
+	Audit     AuditConfig     `yaml:"audit"`
 }
 
 // AppConfig holds general application settings.
 type AppConfig struct {
 	Env      string `yaml:"env" validate:"required,oneof=dev staging prod"`
 	LogLevel string `yaml:"logLevel" validate:"required,oneof=debug info warn error"`
+	DataDir  string `yaml:"dataDir"`
 }
 
 // BridgeConfig configures the shared memory bridge.
@@ -35,16 +38,32 @@ type BridgeConfig struct {
 	PositionCapacity int    `yaml:"positionCapacity" validate:"required,gt=0"`
 	CommandCapacity  int    `yaml:"commandCapacity" validate:"required,gt=0"`
 	AccountCapacity  int    `yaml:"accountCapacity" validate:"required,gt=0"`
+	// EAMagicStart and EAMagicEnd mirror the EA's InpMagicStart and
+	// InpMagicEnd inputs: positions outside them never reach the engine.
+	EAMagicStart int `yaml:"eaMagicStart"`
+	EAMagicEnd   int `yaml:"eaMagicEnd"`
 }
 
 // EngineConfig holds trading engine settings.
 type EngineConfig struct {
 	DefaultPreset  string          `yaml:"defaultPreset" validate:"required"`
 	TickIntervalMs int             `yaml:"tickIntervalMs"`
+	LotStep        float64         `yaml:"lotStep"`
+	MinLot         float64         `yaml:"minLot"`
+	MaxOrderLot    float64         `yaml:"maxOrderLot"` // cap for manual API orders
+	ManualMagic    int             `yaml:"manualMagic"` // magic of manual API orders
 	MarketDetector MarketDetConfig `yaml:"marketDetector"`
+	Readiness      ReadinessConfig `yaml:"readiness"`
 	Presets        []PresetConfig  `yaml:"presets" validate:"required,min=1,dive"`
 }
 
+// ReadinessConfig holds the thresholds behind /readyz.
+type ReadinessConfig struct {
+	HeartbeatStaleMs  int     `yaml:"heartbeatStaleMs"`  // max age of the last data read from the EA
+	StepStaleMs       int     `yaml:"stepStaleMs"`       // max time since the engine loop last stepped
+	CommandRingMaxPct float64 `yaml:"commandRingMaxPct"` // command ring fill counted as saturated
+}
+
 // MarketDetConfig holds market condition detector parameters.
 type MarketDetConfig struct {
 	ATRPeriod int     `yaml:"atrPeriod" validate:"gt=0"`
@@ -82,54 +101,132 @@ type DrawdownLevel struct {
 }
 
 // HedgeConfig holds hedging parameters.
+// PartialClosePip is the adverse excursion (in pips) at which a basket gets
+// a partial hedge of PartialRatio; LockThresholdPip triggers a full lock.
 type HedgeConfig struct {
-	Enable          bool    `yaml:"enable"`
+	Enable           bool    `yaml:"enable"`
 	LockThresholdPip float64 `yaml:"lockThresholdPip"`
-	PartialClosePip float64 `yaml:"partialClosePip"`
-	SmartClosePnl   float64 `yaml:"smartClosePnl"`
+	PartialClosePip  float64 `yaml:"partialClosePip"`
+	PartialRatio     float64 `yaml:"partialRatio"`
+	DelaySeconds     int     `yaml:"delaySeconds"`
+	DelayPips        float64 `yaml:"delayPips"`
+	UnlockPip        float64 `yaml:"unlockPip"`
+	MagicBase        int     `yaml:"magicBase"`
+	SmartClosePnl    float64 `yaml:"smartClosePnl"`
 }
 
 // StealthConfig holds stealth HFT engine parameters.
 type StealthConfig struct {
-	Enable           bool    `yaml:"enable"`
-	MaxPositions     int     `yaml:"maxPositions"`
-	MaxHoldMinutes   int     `yaml:"maxHoldMinutes"`
-	MaxLossPerTrade  float64 `yaml:"maxLossPerTrade"`
-	MaxLossPerDay    float64 `yaml:"maxLossPerDay"`
-	PauseAfterLosses int     `yaml:"pauseAfterLosses"`
-	PauseMinutes     int     `yaml:"pauseMinutes"`
-	MagicRangeStart  int     `yaml:"magicRangeStart"`
-	MagicRangeEnd    int     `yaml:"magicRangeEnd"`
-	PopulationSize   int     `yaml:"populationSize"`
-	MutationRateBase float64 `yaml:"mutationRateBase"`
+	Enable            bool    `yaml:"enable"`
+	MaxPositions      int     `yaml:"maxPositions"`
+	Lot               float64 `yaml:"lot"`
+	MaxHoldMinutes    int     `yaml:"maxHoldMinutes"`
+	MaxLossPerTrade   float64 `yaml:"maxLossPerTrade"`
+	MaxLossPerDay     float64 `yaml:"maxLossPerDay"`
+	PauseAfterLosses  int     `yaml:"pauseAfterLosses"`
+	PauseMinutes      int     `yaml:"pauseMinutes"`
+	MagicRangeStart   int     `yaml:"magicRangeStart"`
+	MagicRangeEnd     int     `yaml:"magicRangeEnd"`
+	PopulationSize    int     `yaml:"populationSize"`
+	MutationRateBase  float64 `yaml:"mutationRateBase"`
 	MutationRateBoost float64 `yaml:"mutationRateBoost"`
+	GenerationMinutes int     `yaml:"generationMinutes"`
+	BoostAfterLosses  int     `yaml:"boostAfterLosses"`
 }
 
 // SignalConfig holds webhook/signal settings.
 type SignalConfig struct {
-	Secret string `yaml:"secret"`
+	Secret              string               `yaml:"secret"`
+	Enable              bool                 `yaml:"enable"`
+	MagicRangeStart     int                  `yaml:"magicRangeStart"`
+	MagicRangeEnd       int                  `yaml:"magicRangeEnd"`
+	DefaultLot          float64              `yaml:"defaultLot"`
+	MinScore            float64              `yaml:"minScore"`
+	ExpirySeconds       int                  `yaml:"expirySeconds"`
+	OverrideDirection   bool                 `yaml:"overrideDirection"`
+	DirectionTTLMinutes int                  `yaml:"directionTtlMinutes"`
+	ConflictPolicy      string               `yaml:"conflictPolicy" validate:"omitempty,oneof=priority latest weighted veto"`
+	ConflictWindowSec   int                  `yaml:"conflictWindowSeconds"`
+	AutoDisable         SignalAutoDisable    `yaml:"autoDisable"`
+	Sources             []SignalSourceConfig `yaml:"sources"`
+}
+
+// SignalAutoDisable holds thresholds for switching off badly performing sources.
+// Rules are only applied once a source has at least MinTrades closed trades.
+type SignalAutoDisable struct {
+	Enable      bool    `yaml:"enable"`
+	MinTrades   int     `yaml:"minTrades"`
+	MinHitRate  float64 `yaml:"minHitRate"`  // 0-1
+	MaxDrawdown float64 `yaml:"maxDrawdown"` // $ from peak cumulative P&L
+}
+
+// SignalSourceConfig holds per-source signal execution settings.
+type SignalSourceConfig struct {
+	Name     string  `yaml:"name" validate:"required"`
+	Lot      float64 `yaml:"lot"`
+	MinScore float64 `yaml:"minScore"`
+	Priority int     `yaml:"priority"`
+	Weight   float64 `yaml:"weight"`
+	Disabled bool    `yaml:"disabled"`
 }
 
 // APIConfig holds REST API server settings.
 type APIConfig struct {
-	ListenAddress     string `yaml:"listenAddress" validate:"required"`
-	JwtSecret         string `yaml:"jwtSecret" validate:"required"`
-	RateLimitPerMinute int   `yaml:"rateLimitPerMinute"`
-	RateLimitBurst    int    `yaml:"rateLimitBurst"`
+	ListenAddress      string `yaml:"listenAddress" validate:"required"`
+	JwtSecret          string `yaml:"jwtSecret" validate:"required"`
+	AccessTokenMinutes int    `yaml:"accessTokenMinutes"`
+	RefreshTokenHours  int    `yaml:"refreshTokenHours"`
+	RateLimitPerMinute int    `yaml:"rateLimitPerMinute"`
+	RateLimitBurst     int    `yaml:"rateLimitBurst"`
+	// Stricter limits for /api/command and the signal webhook.
+	StrictRateLimitPerMinute int `yaml:"strictRateLimitPerMinute"`
+	StrictRateLimitBurst     int `yaml:"strictRateLimitBurst"`
+	// Bearer token required on /metrics; empty serves localhost only.
+	MetricsToken string          `yaml:"metricsToken"`
+	WebSocket    WebSocketConfig `yaml:"websocket"`
 }
 
-// GRPCConfig holds gRPC server settings.
+// WebSocketConfig holds /ws event stream settings.
+type WebSocketConfig struct {
+	// Ticks and account updates are coalesced per symbol/account and sent
+	// at most once per interval.
+	ThrottleMs int `yaml:"throttleMs"`
+	// Browser origins allowed to connect besides the API's own host; "*"
+	// allows any. Clients that send no Origin header are always allowed.
+	AllowedOrigins  []string `yaml:"allowedOrigins"`
+	MaxMessageBytes int      `yaml:"maxMessageBytes"` // inbound frame and message limit
+	PingIntervalMs  int      `yaml:"pingIntervalMs"`
+	PongTimeoutMs   int      `yaml:"pongTimeoutMs"` // read deadline, renewed by every frame
+	WriteTimeoutMs  int      `yaml:"writeTimeoutMs"`
+	Compression     bool     `yaml:"compression"` // permessage-deflate
+	// Outbound messages buffered per client. When full, the oldest
+	// status/tick/account message is dropped first.
+	QueueSize int `yaml:"queueSize"`
+}
+
+// GRPCConfig holds gRPC server settings. An empty ListenAddress
+// disables the gRPC server.
 type GRPCConfig struct {
-	ListenAddress string `yaml:"listenAddress"`
+	ListenAddress string `yaml:"listenAddress"` // cleartext HTTP/2 (h2c)
 }
 
-// DashboardConfig holds web dashboard settings.
+// DashboardConfig holds web dashboard settings. When enabled, the API
+// server serves the dashboard's static export on every path the API does
+// not use; a binary built with the embeddash tag serves its embedded copy
+// instead of StaticPath.
 type DashboardConfig struct {
 	Enabled       bool   `yaml:"enabled"`
-	StaticPath    string `yaml:"staticPath"`
+	StaticPath    string `yaml:"staticPath"` // Next.js export directory
 	DefaultLocale string `yaml:"defaultLocale"`
 }
 
+// AuditConfig holds audit log rotation settings. The log is written to
+// <dataDir>/audit/audit.jsonl.
+type AuditConfig struct {
+	MaxSizeMB  int `yaml:"maxSizeMB"`
+	MaxBackups int `yaml:"maxBackups"` // 0 keeps every rotated file
+}
+
 // Load reads and parses a YAML configuration file.
 func Load(path string) (*Config, error) {
 	data, err := os.ReadFile(path)
@@ -151,18 +248,129 @@ func Load(path string) (*Config, error) {
 
 // setDefaults applies sensible defaults for optional fields.
 func (c *Config) setDefaults() error {
+	if c.App.DataDir == "" {
+		c.App.DataDir = "data"
+	}
+	if c.Audit.MaxSizeMB == 0 {
+		c.Audit.MaxSizeMB = 50
+	}
+	if c.Bridge.EAMagicStart == 0 {
+		c.Bridge.EAMagicStart = 1000
+	}
+	if c.Bridge.EAMagicEnd == 0 {
+		c.Bridge.EAMagicEnd = 7999
+	}
 	if c.Engine.TickIntervalMs == 0 {
 		c.Engine.TickIntervalMs = 50
 	}
+	if c.Engine.LotStep == 0 {
+		c.Engine.LotStep = 0.01
+	}
+	if c.Engine.MinLot == 0 {
+		c.Engine.MinLot = c.Engine.LotStep
+	}
+	if c.Engine.MaxOrderLot == 0 {
+		c.Engine.MaxOrderLot = 10
+	}
+	if c.Engine.ManualMagic == 0 {
+		c.Engine.ManualMagic = 7500
+	}
+	if c.Engine.Readiness.HeartbeatStaleMs == 0 {
+		c.Engine.Readiness.HeartbeatStaleMs = 10000
+	}
+	if c.Engine.Readiness.StepStaleMs == 0 {
+		c.Engine.Readiness.StepStaleMs = 1000
+	}
+	if c.Engine.Readiness.CommandRingMaxPct == 0 {
+		c.Engine.Readiness.CommandRingMaxPct = 90
+	}
 	if c.Engine.MarketDetector.ATRPeriod == 0 {
 		c.Engine.MarketDetector.ATRPeriod = 14
 	}
 	if c.Engine.MarketDetector.ADXPeriod == 0 {
 		c.Engine.MarketDetector.ADXPeriod = 14
 	}
+	if c.API.AccessTokenMinutes == 0 {
+		c.API.AccessTokenMinutes = 15
+	}
+	if c.API.RefreshTokenHours == 0 {
+		c.API.RefreshTokenHours = 168
+	}
+	if c.API.RateLimitPerMinute == 0 {
+		c.API.RateLimitPerMinute = 120
+	}
+	if c.API.RateLimitBurst == 0 {
+		c.API.RateLimitBurst = 30
+	}
+	if c.API.StrictRateLimitPerMinute == 0 {
+		c.API.StrictRateLimitPerMinute = 30
+	}
+	if c.API.StrictRateLimitBurst == 0 {
+		c.API.StrictRateLimitBurst = 5
+	}
+	if c.API.WebSocket.ThrottleMs == 0 {
+		c.API.WebSocket.ThrottleMs = 250
+	}
+	if c.API.WebSocket.MaxMessageBytes == 0 {
+		c.API.WebSocket.MaxMessageBytes = 64 << 10
+	}
+	if c.API.WebSocket.PingIntervalMs == 0 {
+		c.API.WebSocket.PingIntervalMs = 30000
+	}
+	if c.API.WebSocket.PongTimeoutMs == 0 {
+		c.API.WebSocket.PongTimeoutMs = 60000
+	}
+	if c.API.WebSocket.WriteTimeoutMs == 0 {
+		c.API.WebSocket.WriteTimeoutMs = 10000
+	}
+	if c.API.WebSocket.QueueSize == 0 {
+		c.API.WebSocket.QueueSize = 256
+	}
+	if c.Dashboard.StaticPath == "" {
+		c.Dashboard.StaticPath = "web/out"
+	}
 	if c.Dashboard.DefaultLocale == "" {
 		c.Dashboard.DefaultLocale = "tr"
 	}
+	if c.Hedge.PartialRatio == 0 {
+		c.Hedge.PartialRatio = 0.5
+	}
+	if c.Hedge.MagicBase == 0 {
+		c.Hedge.MagicBase = 7000
+	}
+	if c.Stealth.Lot == 0 {
+		c.Stealth.Lot = 0.01
+	}
+	if c.Stealth.GenerationMinutes == 0 {
+		c.Stealth.GenerationMinutes = 30
+	}
+	if c.Stealth.BoostAfterLosses == 0 {
+		c.Stealth.BoostAfterLosses = 3
+	}
+	if c.Signal.MagicRangeStart == 0 {
+		c.Signal.MagicRangeStart = 6000
+	}
+	if c.Signal.MagicRangeEnd == 0 {
+		c.Signal.MagicRangeEnd = 6999
+	}
+	if c.Signal.DefaultLot == 0 {
+		c.Signal.DefaultLot = 0.01
+	}
+	if c.Signal.ExpirySeconds == 0 {
+		c.Signal.ExpirySeconds = 60
+	}
+	if c.Signal.DirectionTTLMinutes == 0 {
+		c.Signal.DirectionTTLMinutes = 15
+	}
+	if c.Signal.ConflictPolicy == "" {
+		c.Signal.ConflictPolicy = "latest"
+	}
+	if c.Signal.ConflictWindowSec == 0 {
+		c.Signal.ConflictWindowSec = 300
+	}
+	if c.Signal.AutoDisable.MinTrades == 0 {
+		c.Signal.AutoDisable.MinTrades = 20
+	}
 	if c.Stealth.MagicRangeStart == 0 {
 		c.Stealth.MagicRangeStart = 5000
 	}
@@ -171,3 +379,127 @@ func (c *Config) setDefaults() error {
 	}
 	return nil
 }
+
+// Validate checks the configuration for values the engine cannot run
+// with. All problems are returned together.
+func (c *Config) Validate() error {
+	var errs []error
+	fail := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	switch c.App.Env {
+	case "dev", "staging", "prod":
+	default:
+		fail("app.env must be dev, staging or prod, got %q", c.App.Env)
+	}
+	switch c.App.LogLevel {
+	case "debug", "info", "warn", "error":
+	default:
+		fail("app.logLevel must be debug, info, warn or error, got %q", c.App.LogLevel)
+	}
+
+	if c.Bridge.SharedMemoryName == "" {
+		fail("bridge.sharedMemoryName is required")
+	}
+	if c.Bridge.TickCapacity <= 0 || c.Bridge.PositionCapacity <= 0 ||
+		c.Bridge.CommandCapacity <= 0 || c.Bridge.AccountCapacity <= 0 {
+		fail("bridge capacities must be positive")
+	}
+
+	if len(c.Engine.Presets) == 0 {
+		fail("engine.presets needs at least one preset")
+	}
+	names := make(map[string]bool)
+	for i, p := range c.Engine.Presets {
+		switch {
+		case p.Name == "":
+			fail("engine.presets[%d].name is required", i)
+		case names[p.Name]:
+			fail("engine.presets[%d].name %q is duplicated", i, p.Name)
+		}
+		names[p.Name] = true
+		if p.GridSpacing <= 0 || p.MaxLevels <= 0 || p.BaseLot <= 0 || p.LotMultiplier <= 0 {
+			fail("engine.presets[%d] (%s): gridSpacing, maxLevels, baseLot and lotMultiplier must be positive", i, p.Name)
+		}
+		if p.TPPips < 0 || p.CascadeLevels < 0 {
+			fail("engine.presets[%d] (%s): tpPips and cascadeLevels must not be negative", i, p.Name)
+		}
+	}
+	if !names[c.Engine.DefaultPreset] {
+		fail("engine.defaultPreset %q does not name a preset", c.Engine.DefaultPreset)
+	}
+	if c.Engine.MinLot > c.Engine.MaxOrderLot {
+		fail("engine.minLot %g exceeds engine.maxOrderLot %g", c.Engine.MinLot, c.Engine.MaxOrderLot)
+	}
+
+	if len(c.Risk.DrawdownLevels) == 0 {
+		fail("risk.drawdownLevels needs at least one level")
+	}
+	for i := 1; i < len(c.Risk.DrawdownLevels); i++ {
+		prev, cur := c.Risk.DrawdownLevels[i-1], c.Risk.DrawdownLevels[i]
+		if cur.ThresholdPercent <= prev.ThresholdPercent {
+			fail("risk.drawdownLevels must have increasing thresholds (%s after %s)", cur.Name, prev.Name)
+		}
+	}
+
+	if c.API.ListenAddress == "" {
+		fail("api.listenAddress is required")
+	}
+	if c.API.JwtSecret == "" {
+		fail("api.jwtSecret is required")
+	}
+	ws := c.API.WebSocket
+	if ws.ThrottleMs < 0 {
+		fail("api.websocket.throttleMs must not be negative")
+	}
+	if ws.PingIntervalMs <= 0 || ws.WriteTimeoutMs <= 0 {
+		fail("api.websocket.pingIntervalMs and writeTimeoutMs must be positive")
+	}
+	if ws.PongTimeoutMs <= ws.PingIntervalMs {
+		fail("api.websocket.pongTimeoutMs (%d) must exceed pingIntervalMs (%d)", ws.PongTimeoutMs, ws.PingIntervalMs)
+	}
+	if ws.MaxMessageBytes < 126 {
+		fail("api.websocket.maxMessageBytes must be at least 126")
+	}
+	if ws.QueueSize < 1 {
+		fail("api.websocket.queueSize must be positive")
+	}
+
+	if c.Signal.MagicRangeStart > c.Signal.MagicRangeEnd {
+		fail("signal magic range %d-%d is empty", c.Signal.MagicRangeStart, c.Signal.MagicRangeEnd)
+	}
+	if c.Stealth.MagicRangeStart > c.Stealth.MagicRangeEnd {
+		fail("stealth magic range %d-%d is empty", c.Stealth.MagicRangeStart, c.Stealth.MagicRangeEnd)
+	}
+	// Grid and cascade use the fixed 1000-4999 range; hedge legs take
+	// magicBase..magicBase+99; manual API orders use manualMagic.
+	magicRanges := []struct {
+		name       string
+		start, end int
+	}{
+		{"grid", 1000, 4999},
+		{"stealth", c.Stealth.MagicRangeStart, c.Stealth.MagicRangeEnd},
+		{"signal", c.Signal.MagicRangeStart, c.Signal.MagicRangeEnd},
+		{"hedge", c.Hedge.MagicBase, c.Hedge.MagicBase + 99},
+		{"manual", c.Engine.ManualMagic, c.Engine.ManualMagic},
+	}
+	for i, a := range magicRanges {
+		for _, b := range magicRanges[i+1:] {
+			if a.start <= b.end && b.start <= a.end {
+				fail("%s magic range %d-%d overlaps %s magic range %d-%d", a.name, a.start, a.end, b.name, b.start, b.end)
+			}
+		}
+		if a.start < c.Bridge.EAMagicStart || a.end > c.Bridge.EAMagicEnd {
+			fail("%s magic range %d-%d is outside the EA's reported range %d-%d (bridge.eaMagicStart/eaMagicEnd)",
+				a.name, a.start, a.end, c.Bridge.EAMagicStart, c.Bridge.EAMagicEnd)
+		}
+	}
+	switch c.Signal.ConflictPolicy {
+	case "priority", "latest", "weighted", "veto":
+	default:
+		fail("signal.conflictPolicy must be priority, latest, weighted or veto, got %q", c.Signal.ConflictPolicy)
+	}
+
+	return errors.Join(errs...)
+}
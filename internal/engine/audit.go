@@ -0,0 +1,116 @@
+package engine
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"go-trade/internal/audit"
+	"go-trade/internal/model"
+
+	"go.uber.org/zap"
+)
+
+// Command sources that are not a strategy or an API user.
+const (
+	SourceGuard  = "guard"
+	SourceEngine = "engine"
+)
+
+// strategySource names a strategy as a command source.
+func strategySource(strategy string) string {
+	return "strategy:" + strategy
+}
+
+// SetAudit attaches the audit log. Without one nothing is recorded. Must
+// be called before Run.
+func (e *Engine) SetAudit(l *audit.Log) {
+	e.audit = l
+}
+
+// recordAudit appends an entry, logging write failures.
+func (e *Engine) recordAudit(entry audit.Entry) {
+	if e.audit == nil {
+		return
+	}
+	if err := e.audit.Append(entry); err != nil {
+		e.logger.Error("audit_write_failed", zap.String("kind", entry.Kind), zap.Error(err))
+	}
+}
+
+// auditCommand records a command with its outcome (a model.CommandStatus)
+// and publishes it on the command topic.
+func (e *Engine) auditCommand(cmd model.Command, status model.CommandStatus, detail map[string]string) {
+	e.publish(model.TopicCommand, cmd.AccountID, cmd.Symbol, model.CommandEvent{Status: status, Command: cmd})
+	if status == model.CommandFailed {
+		e.publishAlert(model.AlertWarning, "COMMAND_FAILED",
+			fmt.Sprintf("bridge did not accept %s %s", cmd.Type, cmd.Symbol), cmd.AccountID, cmd.Symbol)
+	}
+	actor := cmd.Source
+	if actor == "" {
+		actor = SourceEngine
+	}
+	e.recordAudit(audit.Entry{
+		Time:      cmd.Time,
+		Kind:      audit.KindCommand,
+		Actor:     actor,
+		Action:    string(status),
+		AccountID: cmd.AccountID,
+		Symbol:    cmd.Symbol,
+		Reason:    cmd.Reason,
+		Command:   &cmd,
+		Detail:    detail,
+	})
+}
+
+// auditGuard records and publishes a change of an account's guard level.
+func (e *Engine) auditGuard(acct model.AccountState, level model.GuardLevel) {
+	prev, ok := e.guardLevels[acct.AccountID]
+	if !ok {
+		prev = model.GuardGreen
+	}
+	if prev == level {
+		return
+	}
+	e.mu.Lock()
+	e.guardLevels[acct.AccountID] = level
+	e.mu.Unlock()
+	e.publish(model.TopicGuard, acct.AccountID, "", model.GuardEvent{
+		AccountID:   acct.AccountID,
+		From:        prev,
+		To:          level,
+		DrawdownPct: acct.DrawdownPct,
+		Equity:      acct.Equity,
+	})
+	e.recordAudit(audit.Entry{
+		Kind:      audit.KindGuard,
+		Actor:     SourceGuard,
+		Action:    "LEVEL_CHANGED",
+		AccountID: acct.AccountID,
+		Reason:    string(level),
+		Detail: map[string]string{
+			"from":        string(prev),
+			"to":          string(level),
+			"drawdownPct": strconv.FormatFloat(acct.DrawdownPct, 'f', 2, 64),
+			"equity":      strconv.FormatFloat(acct.Equity, 'f', 2, 64),
+		},
+	})
+}
+
+// auditOverride records an override change.
+func (e *Engine) auditOverride(action, actor string, o model.Override) {
+	e.recordAudit(audit.Entry{
+		Kind:      audit.KindOperator,
+		Actor:     actor,
+		Action:    "OVERRIDE_" + action,
+		AccountID: o.AccountID,
+		Symbol:    o.Symbol,
+		Reason:    o.Reason,
+		Detail: map[string]string{
+			"id":        o.ID,
+			"kind":      string(o.Kind),
+			"value":     o.Value,
+			"expiresAt": o.ExpiresAt.Format(time.RFC3339),
+		},
+	})
+}
@@ -0,0 +1,263 @@
+package engine
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"go-trade/internal/model"
+)
+
+// candleHistoryBars is how many closed M1 bars are kept per symbol: one
+// week, so an H1 chart has 168 bars.
+const candleHistoryBars = 7 * 24 * 60
+
+// candleCompactEvery is the number of bars appended after which the
+// history file is rewritten with only the bars still kept.
+const candleCompactEvery = 10000
+
+// candleRecord is a single line of the candle history file.
+type candleRecord struct {
+	Symbol string `json:"symbol"`
+	Candle
+}
+
+// CandleHistory aggregates ticks into M1 bars as they arrive and keeps
+// the last candleHistoryBars closed bars of every symbol. Closed bars are
+// appended to a JSONL file, so the history survives restarts; longer
+// timeframes are built from the M1 bars. The first bar after a start is
+// partial, since ticks before it were not seen.
+type CandleHistory struct {
+	mu      sync.Mutex
+	path    string // empty: memory-only
+	file    *os.File
+	bars    map[string][]Candle // closed bars, oldest first
+	open    map[string]*Candle  // bar being built
+	written int                 // bars appended since the last compaction
+}
+
+// newCandleHistory returns a memory-only history.
+func newCandleHistory() *CandleHistory {
+	return &CandleHistory{
+		bars: make(map[string][]Candle),
+		open: make(map[string]*Candle),
+	}
+}
+
+// OpenCandleHistory opens (or creates) the history file and loads the
+// bars it holds. The file is compacted on open.
+func OpenCandleHistory(path string) (*CandleHistory, error) {
+	h := newCandleHistory()
+	h.path = path
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("creating data directory: %w", err)
+	}
+	if err := h.load(); err != nil {
+		return nil, err
+	}
+	if err := h.compact(); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// Add folds ticks, oldest first, into the open bar of their symbol and
+// closes the bar once a tick of a later minute arrives. Ticks older than
+// the open bar are ignored. Returns the first error writing closed bars;
+// the bars are kept in memory either way.
+func (h *CandleHistory) Add(ticks []model.Tick) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var firstErr error
+	for _, t := range ticks {
+		if t.Bid <= 0 {
+			continue
+		}
+		start := t.Time.UTC().Truncate(time.Minute)
+		cur := h.open[t.Symbol]
+		switch {
+		case cur != nil && cur.Time.Equal(start):
+			cur.High = max(cur.High, t.Bid)
+			cur.Low = min(cur.Low, t.Bid)
+			cur.Close = t.Bid
+			cur.Ticks++
+			continue
+		case cur != nil && start.Before(cur.Time):
+			continue
+		case cur != nil:
+			if err := h.closeBar(t.Symbol, *cur); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+		h.open[t.Symbol] = &Candle{
+			Time: start, Open: t.Bid, High: t.Bid, Low: t.Bid, Close: t.Bid, Ticks: 1,
+			Partial: cur == nil,
+		}
+	}
+	return firstErr
+}
+
+// Candles returns the bars of a symbol for timeframe tf, oldest first,
+// including the bar still open. Bars longer than M1 are built from the
+// M1 bars and are partial when one of those is, or when the bar opened
+// before the kept history begins.
+func (h *CandleHistory) Candles(symbol string, tf time.Duration) []Candle {
+	h.mu.Lock()
+	m1 := make([]Candle, len(h.bars[symbol]), len(h.bars[symbol])+1)
+	copy(m1, h.bars[symbol])
+	if cur := h.open[symbol]; cur != nil {
+		m1 = append(m1, *cur)
+	}
+	h.mu.Unlock()
+
+	if tf <= time.Minute || len(m1) == 0 {
+		return m1
+	}
+	coveredFrom := m1[0].Time
+	var out []Candle
+	for _, b := range m1 {
+		start := b.Time.Truncate(tf)
+		if n := len(out); n > 0 && out[n-1].Time.Equal(start) {
+			c := &out[n-1]
+			c.High = max(c.High, b.High)
+			c.Low = min(c.Low, b.Low)
+			c.Close = b.Close
+			c.Ticks += b.Ticks
+			c.Partial = c.Partial || b.Partial
+			continue
+		}
+		out = append(out, Candle{
+			Time: start, Open: b.Open, High: b.High, Low: b.Low, Close: b.Close, Ticks: b.Ticks,
+			Partial: b.Partial || start.Before(coveredFrom),
+		})
+	}
+	return out
+}
+
+// Close closes the history file. The open bars are not written: they
+// are partial after a restart anyway.
+func (h *CandleHistory) Close() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.file == nil {
+		return nil
+	}
+	err := h.file.Close()
+	h.file = nil
+	return err
+}
+
+// closeBar keeps a finished bar and appends it to the file. Caller must
+// hold h.mu.
+func (h *CandleHistory) closeBar(symbol string, c Candle) error {
+	bars := append(h.bars[symbol], c)
+	if len(bars) > candleHistoryBars {
+		bars = bars[len(bars)-candleHistoryBars:]
+	}
+	h.bars[symbol] = bars
+	if h.path == "" {
+		return nil
+	}
+	if h.file == nil {
+		return fmt.Errorf("candle history %s is closed", h.path)
+	}
+	line, err := json.Marshal(candleRecord{Symbol: symbol, Candle: c})
+	if err != nil {
+		return fmt.Errorf("encoding candle record: %w", err)
+	}
+	if _, err := h.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("writing candle history: %w", err)
+	}
+	h.written++
+	if h.written >= candleCompactEvery {
+		return h.compactLocked()
+	}
+	return nil
+}
+
+// load reads the history file into memory. Corrupt lines (for example a
+// torn final write) and bars out of order are skipped.
+func (h *CandleHistory) load() error {
+	f, err := os.Open(h.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("opening candle history: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var rec candleRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil || rec.Symbol == "" {
+			continue
+		}
+		bars := h.bars[rec.Symbol]
+		if n := len(bars); n > 0 && !rec.Time.After(bars[n-1].Time) {
+			continue
+		}
+		bars = append(bars, rec.Candle)
+		if len(bars) > candleHistoryBars {
+			bars = bars[len(bars)-candleHistoryBars:]
+		}
+		h.bars[rec.Symbol] = bars
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("reading candle history: %w", err)
+	}
+	return nil
+}
+
+// compact rewrites the history file with only the kept bars.
+func (h *CandleHistory) compact() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.compactLocked()
+}
+
+// compactLocked rewrites the history file atomically. Caller must hold
+// h.mu.
+func (h *CandleHistory) compactLocked() error {
+	if h.file != nil {
+		h.file.Close()
+		h.file = nil
+	}
+
+	tmp := h.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("compacting candle history: %w", err)
+	}
+	w := bufio.NewWriter(f)
+	for symbol, bars := range h.bars {
+		for _, c := range bars {
+			line, _ := json.Marshal(candleRecord{Symbol: symbol, Candle: c})
+			w.Write(append(line, '\n'))
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return fmt.Errorf("writing candle history: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("syncing candle history: %w", err)
+	}
+	f.Close()
+	if err := os.Rename(tmp, h.path); err != nil {
+		return fmt.Errorf("replacing candle history: %w", err)
+	}
+
+	h.file, err = os.OpenFile(h.path, os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("reopening candle history: %w", err)
+	}
+	h.written = 0
+	return nil
+}
@@ -0,0 +1,27 @@
+package engine
+
+import "time"
+
+// Timeframes are the supported candle lengths, named as in MT5. H4 and D1
+// are left out: MT5 aligns them to broker server time rather than UTC.
+var Timeframes = map[string]time.Duration{
+	"M1":  time.Minute,
+	"M5":  5 * time.Minute,
+	"M15": 15 * time.Minute,
+	"M30": 30 * time.Minute,
+	"H1":  time.Hour,
+}
+
+// Candle is an OHLC bar of bid prices, as MT5 charts draw them. Time is
+// the bar's open time in UTC. Partial marks a bar that opened before the
+// ticks it was built from begin (engine start, or the start of the kept
+// history), so its open, high and low may be off.
+type Candle struct {
+	Time    time.Time `json:"time"`
+	Open    float64   `json:"open"`
+	High    float64   `json:"high"`
+	Low     float64   `json:"low"`
+	Close   float64   `json:"close"`
+	Ticks   int       `json:"ticks"`
+	Partial bool      `json:"partial,omitempty"`
+}
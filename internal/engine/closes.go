@@ -0,0 +1,70 @@
+package engine
+
+import (
+	"time"
+
+	"go-trade/internal/model"
+
+	"go.uber.org/zap"
+)
+
+// positionGoneAfter is how long a position may be missing from the EA's
+// position feed, while its account keeps reporting, before it is treated
+// as closed. The EA reports every open position on each 50ms timer.
+const positionGoneAfter = time.Second
+
+// feedKey identifies a position in the bridge feed.
+type feedKey struct {
+	accountID string
+	ticket    int64
+}
+
+// feedPosition is the last report of an open position.
+type feedPosition struct {
+	pos    model.Position
+	seenAt time.Time
+}
+
+// trackClosures follows the positions reported by the EA and handles the
+// ones that left the feed, however they were closed: by the engine, by a
+// broker TP/SL or stop-out, or by hand. Only accounts that reported this
+// step are checked, so a stalled bridge closes nothing. Runs on the
+// engine goroutine.
+func (e *Engine) trackClosures(positions []model.Position, accounts []model.AccountState, now time.Time) {
+	for _, pos := range positions {
+		if pos.Pending {
+			continue
+		}
+		key := feedKey{pos.AccountID, pos.ID}
+		prev, ok := e.feed[key]
+		switch {
+		case !ok:
+			e.signalProc.RecordOpen(pos)
+		case pos.Volume < prev.pos.Volume:
+			e.signalProc.RecordReduce(prev.pos, pos.Volume)
+		}
+		e.feed[key] = feedPosition{pos: pos, seenAt: now}
+	}
+
+	reporting := make(map[string]bool, len(accounts))
+	for _, acct := range accounts {
+		reporting[acct.AccountID] = true
+	}
+	for key, fp := range e.feed {
+		if !reporting[key.accountID] || now.Sub(fp.seenAt) < positionGoneAfter {
+			continue
+		}
+		delete(e.feed, key)
+		if _, ok := e.store.FindPosition(key.accountID, key.ticket); ok {
+			e.store.RemovePosition(key.accountID, fp.pos.Symbol, key.ticket)
+			e.publishPosition("CLOSED", fp.pos)
+		}
+		e.signalProc.RecordClose(fp.pos)
+		e.stealth.RecordClose(fp.pos, now)
+		e.logger.Debug("position_gone",
+			zap.String("account", key.accountID),
+			zap.Int64("ticket", key.ticket),
+			zap.Int("magic", fp.pos.Magic),
+		)
+	}
+}
@@ -0,0 +1,271 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"go-trade/internal/model"
+
+	"go.uber.org/zap"
+)
+
+// fillTimeout is how long an OPEN is tracked waiting for its position to
+// appear in the bridge position feed.
+const fillTimeout = 30 * time.Second
+
+// commandAcceptTimeout is how long ExecuteCommand waits for the engine
+// goroutine to take a command, independent of the caller's fill wait.
+const commandAcceptTimeout = 2 * time.Second
+
+// ErrEngineBusy is returned by ExecuteCommand when the engine goroutine did
+// not take the command in time. The command was not executed.
+var ErrEngineBusy = errors.New("engine did not accept the command in time")
+
+// Command result codes shared with API clients.
+const (
+	CodeNotFound          = "NOT_FOUND"
+	CodeEngineFrozen      = "ENGINE_FROZEN"
+	CodeNoQuote           = "NO_QUOTE"
+	CodeUnknownAccount    = "UNKNOWN_ACCOUNT"
+	CodeUnsupported       = "UNSUPPORTED_COMMAND"
+	CodeInvalidScope      = "INVALID_SCOPE"
+	CodeBridgeUnavailable = "BRIDGE_UNAVAILABLE"
+	CodeInvalidVolume     = "INVALID_VOLUME"
+)
+
+// commandError is a command validation failure with its result code.
+type commandError struct {
+	code string
+	msg  string
+}
+
+func (e *commandError) Error() string { return e.msg }
+
+// commandErrorf builds a commandError with a formatted message.
+func commandErrorf(code, format string, args ...any) error {
+	return &commandError{code: code, msg: fmt.Sprintf(format, args...)}
+}
+
+// commandRequest is a command submitted for synchronous execution on the
+// engine goroutine.
+type commandRequest struct {
+	cmd   model.Command
+	reply chan commandReply
+}
+
+// commandReply carries the immediate result and, for sent OPENs, a channel
+// that receives the filled position.
+type commandReply struct {
+	result model.CommandResult
+	fill   chan model.Position
+}
+
+// fillWaiter matches a sent OPEN against incoming positions. known holds
+// the tickets that already existed on the symbol when it was sent.
+type fillWaiter struct {
+	cmd    model.Command
+	sentAt time.Time
+	known  map[int64]bool
+	ch     chan model.Position
+}
+
+// ExecuteCommand runs a command on the engine goroutine and returns its
+// result. It returns ErrEngineBusy, or ctx's error, only when the engine
+// never took the command; once taken, the result is always returned. For
+// an OPEN written to the bridge it then waits, until ctx is done, for the
+// matching position to be reported and returns FILLED with its ticket;
+// otherwise the result stays SENT.
+func (e *Engine) ExecuteCommand(ctx context.Context, cmd model.Command) (model.CommandResult, error) {
+	req := commandRequest{cmd: cmd, reply: make(chan commandReply, 1)}
+	accept := time.NewTimer(commandAcceptTimeout)
+	defer accept.Stop()
+	select {
+	case e.cmdReqs <- req:
+	case <-accept.C:
+		return model.CommandResult{}, ErrEngineBusy
+	case <-ctx.Done():
+		return model.CommandResult{}, ctx.Err()
+	}
+
+	// The engine goroutine replies to every request it takes.
+	rep := <-req.reply
+	if rep.fill == nil {
+		return rep.result, nil
+	}
+
+	select {
+	case pos := <-rep.fill:
+		rep.result.Status = model.CommandFilled
+		rep.result.Ticket = pos.ID
+		rep.result.FilledAt = time.Now()
+	case <-ctx.Done():
+	}
+	return rep.result, nil
+}
+
+// executeCommand validates a command against engine state and applies or
+// dispatches it. Runs on the engine goroutine.
+func (e *Engine) executeCommand(cmd model.Command, now time.Time) commandReply {
+	cmd.Time = now
+	res := model.CommandResult{
+		ID:      fmt.Sprintf("cmd_%d", now.UnixNano()),
+		Command: cmd,
+	}
+	reject := func(code, msg string) commandReply {
+		res.Status = model.CommandRejected
+		res.Code = code
+		res.Error = msg
+		e.logger.Warn("api_command_rejected",
+			zap.String("type", string(cmd.Type)),
+			zap.String("code", code),
+			zap.String("error", msg),
+		)
+		e.mu.Lock()
+		e.metrics.CommandRejected++
+		e.rejects[code]++
+		e.mu.Unlock()
+		e.auditCommand(cmd, model.CommandRejected, map[string]string{"code": code, "error": msg})
+		return commandReply{result: res}
+	}
+
+	switch cmd.Type {
+	case model.CommandPause, model.CommandResume, model.CommandFreeze:
+		if err := ValidateScope(commandScope(cmd)); err != nil {
+			return reject(CodeInvalidScope, err.Error())
+		}
+		e.handleCommand(cmd)
+		res.Status = model.CommandApplied
+		return commandReply{result: res}
+
+	case model.CommandHedgeAll, model.CommandCloseAll:
+		e.handleCommand(cmd)
+		res.Status = model.CommandApplied
+		return commandReply{result: res}
+
+	case model.CommandOpen:
+		scope := Scope{AccountID: cmd.AccountID, Symbol: cmd.Symbol}
+		if e.control.Mode(scope) == model.TradingFrozen {
+			return reject(CodeEngineFrozen, "trading is frozen for "+scope.String())
+		}
+		if !e.knownAccount(cmd.AccountID) {
+			return reject(CodeUnknownAccount, "unknown account "+cmd.AccountID)
+		}
+		if _, ok := e.store.LastTick(cmd.Symbol); !ok {
+			return reject(CodeNoQuote, "no quotes for "+cmd.Symbol)
+		}
+
+	case model.CommandClose, model.CommandPartialClose, model.CommandModify:
+		pos, ok := e.store.FindPosition(cmd.AccountID, cmd.Ticket)
+		if !ok {
+			return reject(CodeNotFound, fmt.Sprintf("position %d not found", cmd.Ticket))
+		}
+		cmd.AccountID = pos.AccountID
+		cmd.Symbol = pos.Symbol
+		if cmd.Side == "" {
+			cmd.Side = pos.Side
+		}
+		if cmd.Type == model.CommandPartialClose {
+			resolved, err := e.preparePartialClose(cmd)
+			if err != nil {
+				code := CodeInvalidVolume
+				var cerr *commandError
+				if errors.As(err, &cerr) {
+					code = cerr.code
+				}
+				return reject(code, err.Error())
+			}
+			cmd = resolved
+		}
+
+	default:
+		return reject(CodeUnsupported, "unsupported command type "+string(cmd.Type))
+	}
+
+	res.Command = cmd
+	if !e.dispatch(cmd) {
+		res.Status = model.CommandFailed
+		res.Code = CodeBridgeUnavailable
+		res.Error = "bridge did not accept the command"
+		e.auditCommand(cmd, model.CommandFailed, nil)
+		return commandReply{result: res}
+	}
+	e.recordCommand(cmd)
+	e.auditCommand(cmd, model.CommandSent, nil)
+	res.Status = model.CommandSent
+	res.SentAt = now
+
+	rep := commandReply{result: res}
+	if cmd.Type == model.CommandOpen {
+		known := make(map[int64]bool)
+		for _, pos := range e.store.GetPositions(cmd.AccountID, cmd.Symbol) {
+			known[pos.ID] = true
+		}
+		rep.fill = make(chan model.Position, 1)
+		e.mu.Lock()
+		e.fillWaiters = append(e.fillWaiters, fillWaiter{cmd: cmd, sentAt: now, known: known, ch: rep.fill})
+		e.mu.Unlock()
+	}
+	return rep
+}
+
+// knownAccount reports whether the bridge has reported the account. With
+// no accounts reported yet every ID is accepted.
+func (e *Engine) knownAccount(id string) bool {
+	accounts := e.store.GetAccounts()
+	if len(accounts) == 0 {
+		return true
+	}
+	for _, acc := range accounts {
+		if acc.AccountID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// matchFills hands newly reported positions to OPENs waiting for them and
+// drops waiters that timed out.
+func (e *Engine) matchFills(positions []model.Position, now time.Time) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if len(e.fillWaiters) == 0 {
+		return
+	}
+	claimed := make(map[int64]bool)
+	kept := e.fillWaiters[:0]
+	for _, w := range e.fillWaiters {
+		matched := false
+		for _, pos := range positions {
+			if claimed[pos.ID] || w.known[pos.ID] || pos.Pending ||
+				pos.AccountID != w.cmd.AccountID || pos.Symbol != w.cmd.Symbol ||
+				pos.Side != w.cmd.Side || pos.Magic != w.cmd.Magic ||
+				math.Abs(pos.Volume-w.cmd.Volume) > 1e-9 {
+				continue
+			}
+			w.ch <- pos
+			claimed[pos.ID] = true
+			matched = true
+			break
+		}
+		if !matched && now.Sub(w.sentAt) < fillTimeout {
+			kept = append(kept, w)
+		}
+	}
+	e.fillWaiters = kept
+}
+
+// recordCommand updates command metrics and the recent command list.
+func (e *Engine) recordCommand(cmd model.Command) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.metrics.CommandCount++
+	e.metrics.LastCommandAt = time.Now()
+	e.countCommand(cmd)
+	e.recentCmds = append(e.recentCmds, cmd)
+	if len(e.recentCmds) > 50 {
+		e.recentCmds = e.recentCmds[len(e.recentCmds)-50:]
+	}
+}
@@ -0,0 +1,187 @@
+package engine
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"go-trade/internal/model"
+)
+
+// Strategy names usable in a trading scope.
+const (
+	StrategyGrid       = "grid"
+	StrategyCascade    = "cascade"
+	StrategyHedge      = "hedge"
+	StrategyStealth    = "stealth"
+	StrategySignal     = "signal"
+	StrategySmartClose = "smartclose"
+)
+
+// knownStrategies lists every strategy a scope may name.
+var knownStrategies = map[string]bool{
+	StrategyGrid:       true,
+	StrategyCascade:    true,
+	StrategyHedge:      true,
+	StrategyStealth:    true,
+	StrategySignal:     true,
+	StrategySmartClose: true,
+}
+
+// Scope selects what a pause/freeze applies to. Empty fields match
+// everything, so the zero Scope is global, {AccountID} one account,
+// {AccountID, Symbol} one symbol on it, and so on. Symbol or Strategy may
+// also be set without an account to apply across all accounts.
+type Scope struct {
+	AccountID string `json:"accountId,omitempty"`
+	Symbol    string `json:"symbol,omitempty"`
+	Strategy  string `json:"strategy,omitempty"`
+}
+
+// String renders the scope for logs.
+func (s Scope) String() string {
+	str := func(v string) string {
+		if v == "" {
+			return "*"
+		}
+		return v
+	}
+	return fmt.Sprintf("%s/%s/%s", str(s.AccountID), str(s.Symbol), str(s.Strategy))
+}
+
+// covers reports whether an entry at scope s applies to target.
+func (s Scope) covers(target Scope) bool {
+	return (s.AccountID == "" || s.AccountID == target.AccountID) &&
+		(s.Symbol == "" || s.Symbol == target.Symbol) &&
+		(s.Strategy == "" || s.Strategy == target.Strategy)
+}
+
+// ScopeState is a pause or freeze recorded at one scope.
+type ScopeState struct {
+	Scope
+	Mode   model.TradingMode `json:"mode"`
+	Reason string            `json:"reason"`
+	Since  time.Time         `json:"since"`
+}
+
+// ValidateScope checks that a scope names a known strategy.
+func ValidateScope(s Scope) error {
+	if s.Strategy != "" && !knownStrategies[s.Strategy] {
+		return fmt.Errorf("unknown strategy %q", s.Strategy)
+	}
+	return nil
+}
+
+// TradingControl holds hierarchical pause/freeze state. The effective mode
+// of a scope is the strictest entry covering it.
+type TradingControl struct {
+	mu      sync.RWMutex
+	entries map[Scope]ScopeState
+}
+
+// NewTradingControl creates a control with everything running.
+func NewTradingControl() *TradingControl {
+	return &TradingControl{entries: make(map[Scope]ScopeState)}
+}
+
+// Set pauses or freezes a scope. A freeze is never downgraded to a pause.
+func (c *TradingControl) Set(s Scope, mode model.TradingMode, reason string, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if prev, ok := c.entries[s]; ok && prev.Mode == model.TradingFrozen && mode == model.TradingPaused {
+		return
+	}
+	c.entries[s] = ScopeState{Scope: s, Mode: mode, Reason: reason, Since: now}
+}
+
+// Resume clears the entry at a scope and every entry beneath it, so
+// resuming an account also resumes its symbols and strategies. It returns
+// the number of entries cleared.
+func (c *TradingControl) Resume(s Scope) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := 0
+	for key := range c.entries {
+		if s.covers(key) {
+			delete(c.entries, key)
+			n++
+		}
+	}
+	return n
+}
+
+// Mode returns the effective mode for a scope.
+func (c *TradingControl) Mode(target Scope) model.TradingMode {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	mode := model.TradingRunning
+	for key, st := range c.entries {
+		if !key.covers(target) {
+			continue
+		}
+		if st.Mode == model.TradingFrozen {
+			return model.TradingFrozen
+		}
+		mode = st.Mode
+	}
+	return mode
+}
+
+// Allowed reports whether a strategy may act on a symbol of an account.
+func (c *TradingControl) Allowed(accountID, symbol, strategy string) bool {
+	return c.Mode(Scope{AccountID: accountID, Symbol: symbol, Strategy: strategy}) == model.TradingRunning
+}
+
+// States returns every recorded pause/freeze, broadest scope first.
+func (c *TradingControl) States() []ScopeState {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	out := make([]ScopeState, 0, len(c.entries))
+	for _, st := range c.entries {
+		out = append(out, st)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		a, b := out[i].Scope, out[j].Scope
+		if a.AccountID != b.AccountID {
+			return a.AccountID < b.AccountID
+		}
+		if a.Symbol != b.Symbol {
+			return a.Symbol < b.Symbol
+		}
+		return a.Strategy < b.Strategy
+	})
+	return out
+}
+
+// commandScope returns the scope a PAUSE, RESUME or FREEZE command targets.
+func commandScope(cmd model.Command) Scope {
+	return Scope{AccountID: cmd.AccountID, Symbol: cmd.Symbol, Strategy: cmd.Strategy}
+}
+
+// TradingStates returns every active pause or freeze.
+func (e *Engine) TradingStates() []ScopeState {
+	return e.control.States()
+}
+
+// quotesFor drops the symbols a strategy may not trade on an account.
+func (e *Engine) quotesFor(accountID, strategy string, quotes map[string]SymbolSnapshot) map[string]SymbolSnapshot {
+	out := make(map[string]SymbolSnapshot, len(quotes))
+	for sym, q := range quotes {
+		if e.control.Allowed(accountID, sym, strategy) {
+			out[sym] = q
+		}
+	}
+	return out
+}
+
+// positionsFor drops positions on symbols a strategy may not manage.
+func (e *Engine) positionsFor(accountID, strategy string, positions []model.Position) []model.Position {
+	var out []model.Position
+	for _, pos := range positions {
+		if e.control.Allowed(accountID, pos.Symbol, strategy) {
+			out = append(out, pos)
+		}
+	}
+	return out
+}
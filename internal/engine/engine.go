@@ -3,11 +3,16 @@ package engine
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
 	"sync"
 	"time"
 
+	"go-trade/internal/audit"
 	"go-trade/internal/bridge"
 	"go-trade/internal/config"
+	"go-trade/internal/metrics"
 	"go-trade/internal/model"
 
 	"go.uber.org/zap"
@@ -17,26 +22,49 @@ import (
 // It reads ticks/positions/accounts from the bridge, updates the store,
 // runs grid/cascade/guard/smartclose logic, and dispatches commands.
 type Engine struct {
-	store    *Store
-	bridge   *bridge.Bridge
-	signals  chan model.Signal
-	commands chan model.Command
-	mu       sync.Mutex
-	lastSig  map[string]model.Signal
-	started  time.Time
-	metrics  Metrics
-	recentCmds []model.Command
-	paused   bool
-	frozen   bool
-	cfg      ConfigSnapshot
-	fullCfg  *config.Config
-	logger   *zap.Logger
+	store       *Store
+	bridge      *bridge.Bridge
+	signals     chan model.Signal
+	commands    chan model.Command
+	cmdReqs     chan commandRequest
+	mu          sync.Mutex
+	lastSig     map[string]model.Signal
+	sigByID     map[string]model.Signal
+	sigOrder    []string
+	overflow    []model.Signal
+	journal     *SignalJournal
+	journalErr  error
+	candles     *CandleHistory
+	candlesErr  error
+	overrides   *OverrideRegistry
+	overrideErr error
+	configErr   error
+	audit       *audit.Log
+	events      EventSink
+	guardLevels map[string]model.GuardLevel
+	cmdCounts   map[commandKey]int64
+	rejects     map[string]int64
+	stepHist    *metrics.Histogram
+	started     time.Time
+	metrics     Metrics
+	recentCmds  []model.Command
+	fillWaiters []fillWaiter
+	feed        map[feedKey]feedPosition // engine goroutine only
+	partials    map[feedKey]partialClose // engine goroutine only
+	control     *TradingControl
+	cfg         ConfigSnapshot
+	fullCfg     *config.Config
+	logger      *zap.Logger
 
 	// Phase 2 modules
 	guard        *Guard
 	gridMgr      *GridManager
 	cascadeMgr   *CascadeManager
 	smartClose   *SmartClose
+	hedge        *HedgeEngine
+	stealth      *StealthEngine
+	evolver      *Evolver
+	signalProc   *SignalProcessor
 	detector     *MarketDetector
 	consolFilter *ConsolidationFilter
 	scoring      *Scoring
@@ -58,19 +86,33 @@ type Status struct {
 	Config        ConfigSnapshot    `json:"config"`
 	LatestTickAt  time.Time         `json:"latestTickAt"`
 	LatestSymbol  string            `json:"latestSymbol"`
+	TradingStates []ScopeState      `json:"tradingStates"`
+	Overrides     []model.Override  `json:"overrides"`
 	GridStates    []model.GridState `json:"gridStates"`
 	GuardLevel    model.GuardLevel  `json:"guardLevel"`
+	HedgeStates   []HedgeState      `json:"hedgeStates"`
+	StealthStates []StealthState    `json:"stealthStates"`
+	Evolution     *EvolutionState   `json:"evolution,omitempty"`
 }
 
 // Metrics tracks engine processing counters.
 type Metrics struct {
-	TickCount     int64     `json:"tickCount"`
-	PositionCount int64     `json:"positionCount"`
-	CommandCount  int64     `json:"commandCount"`
-	SignalCount   int64     `json:"signalCount"`
-	LastTickAt    time.Time `json:"lastTickAt"`
-	LastCommandAt time.Time `json:"lastCommandAt"`
-	LastSignalAt  time.Time `json:"lastSignalAt"`
+	TickCount        int64     `json:"tickCount"`
+	PositionCount    int64     `json:"positionCount"`
+	CommandCount     int64     `json:"commandCount"`
+	CommandRejected  int64     `json:"commandRejected"`
+	CommandFailed    int64     `json:"commandFailed"`
+	SignalCount      int64     `json:"signalCount"`
+	SignalOverflow   int64     `json:"signalOverflow"`
+	SignalDropped    int64     `json:"signalDropped"`
+	SignalDuplicate  int64     `json:"signalDuplicate"`
+	SignalReplayed   int64     `json:"signalReplayed"`
+	LastTickAt       time.Time `json:"lastTickAt"`
+	LastCommandAt    time.Time `json:"lastCommandAt"`
+	LastSignalAt     time.Time `json:"lastSignalAt"`
+	LastStepAt       time.Time `json:"lastStepAt"`
+	LastBridgeDataAt time.Time `json:"lastBridgeDataAt"`
+	BridgeLagMs      float64   `json:"bridgeLagMs"` // receive time minus timestamp of the newest tick
 }
 
 // ConfigSnapshot is a serializable view of the active configuration.
@@ -92,7 +134,10 @@ func New(cfg *config.Config, br *bridge.Bridge) *Engine {
 		bridge:   br,
 		signals:  make(chan model.Signal, 1024),
 		commands: make(chan model.Command, 1024),
+		cmdReqs:  make(chan commandRequest),
 		lastSig:  make(map[string]model.Signal),
+		control:  NewTradingControl(),
+		sigByID:  make(map[string]model.Signal),
 		started:  time.Now(),
 		logger:   logger,
 		fullCfg:  cfg,
@@ -116,6 +161,14 @@ func New(cfg *config.Config, br *bridge.Bridge) *Engine {
 		50.0, // max loss $ emergency close
 		logger,
 	)
+	e.smartClose.SetLotLimits(cfg.Engine.LotStep, cfg.Engine.MinLot)
+	e.hedge = NewHedgeEngine(cfg.Hedge, logger)
+	e.stealth = NewStealthEngine(cfg.Stealth, logger)
+	e.stealth.SetLotLimits(cfg.Engine.LotStep, cfg.Engine.MinLot)
+	e.evolver = NewEvolver(cfg.Stealth, cfg.App.DataDir, logger)
+	e.stealth.SetParams(e.evolver.Promoted())
+	e.signalProc = NewSignalProcessor(cfg.Signal, logger)
+	e.signalProc.SetLotLimits(cfg.Engine.LotStep, cfg.Engine.MinLot)
 	e.detector = NewMarketDetector(
 		cfg.Engine.MarketDetector.ATRPeriod,
 		cfg.Engine.MarketDetector.ADXPeriod,
@@ -125,6 +178,33 @@ func New(cfg *config.Config, br *bridge.Bridge) *Engine {
 	e.consolFilter = NewConsolidationFilter(e.detector)
 	e.scoring = NewScoring()
 
+	// M1 bars survive restarts; without the file they are memory-only
+	e.candles, e.candlesErr = OpenCandleHistory(filepath.Join(cfg.App.DataDir, "candles_m1.jsonl"))
+	if e.candles == nil {
+		e.candles = newCandleHistory()
+	}
+
+	// Replay signals that were received but never processed before the
+	// last shutdown. Without a journal the queue is memory-only.
+	e.journal, e.journalErr = OpenSignalJournal(filepath.Join(cfg.App.DataDir, "signals.jsonl"))
+	if e.journal != nil {
+		for _, sig := range e.journal.Pending() {
+			sig.Status = model.SignalQueued
+			e.rememberSignal(sig)
+			e.overflow = append(e.overflow, sig)
+			e.metrics.SignalReplayed++
+		}
+	}
+
+	e.configErr = cfg.Validate()
+	e.guardLevels = make(map[string]model.GuardLevel)
+	e.cmdCounts = make(map[commandKey]int64)
+	e.feed = make(map[feedKey]feedPosition)
+	e.partials = make(map[feedKey]partialClose)
+	e.rejects = make(map[string]int64)
+	e.stepHist = metrics.NewHistogram(stepBuckets...)
+	e.overrides, e.overrideErr = OpenOverrideRegistry(filepath.Join(cfg.App.DataDir, "overrides.json"))
+
 	return e
 }
 
@@ -136,6 +216,10 @@ func (e *Engine) SetLogger(logger *zap.Logger) {
 		e.gridMgr.logger = logger
 		e.cascadeMgr.logger = logger
 		e.smartClose.logger = logger
+		e.hedge.logger = logger
+		e.stealth.logger = logger
+		e.evolver.logger = logger
+		e.signalProc.logger = logger
 	}
 }
 
@@ -144,16 +228,153 @@ func (e *Engine) Store() *Store {
 	return e.store
 }
 
-// PushSignal queues a trading signal for processing.
-func (e *Engine) PushSignal(sig model.Signal) {
+// PushSignal queues a trading signal for processing. The signal is
+// journaled before it is queued so it survives a restart. When the channel
+// is full it spills into a bounded overflow buffer that the run loop
+// drains; only when that is full too is the signal dropped, before it is
+// journaled or remembered, so a retry with the same ID is accepted.
+func (e *Engine) PushSignal(sig model.Signal) error {
+	if sig.Status == "" {
+		sig.Status = model.SignalQueued
+	}
+	if sig.ID == "" {
+		sig.ID = fmt.Sprintf("sig_%d", time.Now().UnixNano())
+	}
+
+	e.mu.Lock()
+	_, dup := e.sigByID[sig.ID]
+	full := len(e.signals) == cap(e.signals) && len(e.overflow) >= signalOverflowCap
+	switch {
+	case dup:
+		e.metrics.SignalDuplicate++
+	case full:
+		e.metrics.SignalDropped++
+	}
+	e.mu.Unlock()
+	if dup {
+		return ErrDuplicateSignal
+	}
+	if full {
+		e.logger.Warn("signal_dropped", zap.String("id", sig.ID), zap.String("symbol", sig.Symbol))
+		return ErrSignalQueueFull
+	}
+
+	if e.journal != nil {
+		if err := e.journal.Append(sig); err != nil {
+			if errors.Is(err, ErrDuplicateSignal) {
+				e.mu.Lock()
+				e.metrics.SignalDuplicate++
+				e.mu.Unlock()
+				return err
+			}
+			e.logger.Warn("signal_journal_write_failed", zap.String("id", sig.ID), zap.Error(err))
+		}
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.rememberSignal(sig)
+	e.metrics.LastSignalAt = time.Now()
 	select {
 	case e.signals <- sig:
 	default:
+		// Capacity was checked above; concurrent pushes may overshoot
+		// signalOverflowCap by a few rather than drop a journaled signal
+		e.overflow = append(e.overflow, sig)
+		e.metrics.SignalOverflow++
 	}
-	e.mu.Lock()
 	e.metrics.SignalCount++
-	e.metrics.LastSignalAt = time.Now()
+	return nil
+}
+
+// rememberSignal records a signal for lookup by ID, keeping the most
+// recent 1024. Caller must hold e.mu.
+func (e *Engine) rememberSignal(sig model.Signal) {
+	if _, ok := e.sigByID[sig.ID]; !ok {
+		e.sigOrder = append(e.sigOrder, sig.ID)
+	}
+	e.sigByID[sig.ID] = sig
+	if len(e.sigOrder) > 1024 {
+		delete(e.sigByID, e.sigOrder[0])
+		e.sigOrder = e.sigOrder[1:]
+	}
+}
+
+// markSignalDone marks a signal processed in the journal so it is not
+// replayed after a restart.
+func (e *Engine) markSignalDone(id string) {
+	if e.journal == nil {
+		return
+	}
+	if err := e.journal.MarkDone(id); err != nil {
+		e.logger.Warn("signal_journal_write_failed", zap.String("id", id), zap.Error(err))
+	}
+}
+
+// processSignal hands a dequeued signal to the signal processor.
+func (e *Engine) processSignal(sig model.Signal) {
+	e.mu.Lock()
+	e.lastSig[sig.AccountID+"|"+sig.Symbol] = sig
+	e.mu.Unlock()
+	for _, res := range e.signalProc.Submit(sig, time.Now()) {
+		e.updateSignal(res)
+	}
+}
+
+// drainOverflow processes signals that did not fit in the channel, plus
+// any replayed from the journal at startup.
+func (e *Engine) drainOverflow() {
+	e.mu.Lock()
+	pending := e.overflow
+	e.overflow = nil
+	e.mu.Unlock()
+	for _, sig := range pending {
+		e.processSignal(sig)
+	}
+}
+
+// updateSignal records the processing outcome of a signal.
+func (e *Engine) updateSignal(res SignalResult) {
+	if res.ID == "" {
+		return
+	}
+	e.mu.Lock()
+	sig, ok := e.sigByID[res.ID]
+	if !ok {
+		e.mu.Unlock()
+		return
+	}
+	sig.Status = res.Status
+	sig.Note = res.Note
+	e.sigByID[res.ID] = sig
+	if res.Status != model.SignalQueued {
+		e.markSignalDone(res.ID)
+	}
+	key := sig.AccountID + "|" + sig.Symbol
+	if last, ok := e.lastSig[key]; ok && last.ID == sig.ID {
+		e.lastSig[key] = sig
+	}
 	e.mu.Unlock()
+	e.publish(model.TopicSignal, sig.AccountID, sig.Symbol, sig)
+}
+
+// SignalSourcesJSON returns per-source signal statistics as JSON bytes.
+func (e *Engine) SignalSourcesJSON() ([]byte, error) {
+	return json.Marshal(e.signalProc.SourceStats())
+}
+
+// SetSignalSourceEnabled enables or disables a signal source at runtime.
+func (e *Engine) SetSignalSourceEnabled(name string, enabled bool) {
+	e.signalProc.SetSourceEnabled(name, enabled)
+	e.logger.Info("signal_source_toggled", zap.String("source", name), zap.Bool("enabled", enabled))
+}
+
+// SignalByID returns a recently received signal by its ID.
+func (e *Engine) SignalByID(id string) (model.Signal, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	sig, ok := e.sigByID[id]
+	return sig, ok
 }
 
 // PushCommand queues a command for execution.
@@ -174,6 +395,41 @@ func (e *Engine) GridStatesJSON() ([]byte, error) {
 	return json.Marshal(e.gridMgr.AllStates())
 }
 
+// Positions returns every open position and pending order.
+func (e *Engine) Positions() []model.Position {
+	return e.store.GetAllPositions()
+}
+
+// Accounts returns the latest state of every account.
+func (e *Engine) Accounts() []model.AccountState {
+	return e.store.GetAccounts()
+}
+
+// Symbols returns the latest quote and open position count per symbol.
+func (e *Engine) Symbols() []SymbolSnapshot {
+	return e.store.Symbols()
+}
+
+// Ticks returns the buffered recent ticks of a symbol, oldest first.
+func (e *Engine) Ticks(symbol string) []model.Tick {
+	return e.store.GetTicks(symbol)
+}
+
+// Candles returns the bars of a symbol for timeframe tf, oldest first,
+// from the persisted M1 history.
+func (e *Engine) Candles(symbol string, tf time.Duration) []Candle {
+	return e.candles.Candles(symbol, tf)
+}
+
+// RecentCommands returns the last dispatched commands, oldest first.
+func (e *Engine) RecentCommands() []model.Command {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	cmds := make([]model.Command, len(e.recentCmds))
+	copy(cmds, e.recentCmds)
+	return cmds
+}
+
 // Status returns the current engine status.
 func (e *Engine) Status() Status {
 	snapshot := e.store.Snapshot()
@@ -187,13 +443,8 @@ func (e *Engine) Status() Status {
 		}
 	}
 
+	mode := string(e.control.Mode(Scope{}))
 	e.mu.Lock()
-	mode := "RUNNING"
-	if e.frozen {
-		mode = "FROZEN"
-	} else if e.paused {
-		mode = "PAUSED"
-	}
 	metrics := e.metrics
 	signals := make([]model.Signal, 0, len(e.lastSig))
 	for _, sig := range e.lastSig {
@@ -211,6 +462,12 @@ func (e *Engine) Status() Status {
 		}
 	}
 
+	var evolution *EvolutionState
+	if e.fullCfg.Stealth.Enable {
+		state := e.evolver.State()
+		evolution = &state
+	}
+
 	return Status{
 		Time:          time.Now(),
 		StartedAt:     e.started,
@@ -226,8 +483,13 @@ func (e *Engine) Status() Status {
 		Config:        e.cfg,
 		LatestTickAt:  latestTickAt,
 		LatestSymbol:  latestSymbol,
+		TradingStates: e.control.States(),
+		Overrides:     e.overrides.Active(time.Now()),
 		GridStates:    e.gridMgr.AllStates(),
 		GuardLevel:    guardLevel,
+		HedgeStates:   e.hedge.States(),
+		StealthStates: e.stealth.States(),
+		Evolution:     evolution,
 	}
 }
 
@@ -240,60 +502,98 @@ func (e *Engine) Run(ctx context.Context) error {
 		zap.String("bridge_mode", string(e.bridge.Mode())),
 		zap.String("bridge_name", e.cfg.BridgeName),
 	)
+	if e.configErr != nil {
+		e.logger.Error("config_invalid", zap.Error(e.configErr))
+	}
+	if e.overrideErr != nil {
+		e.logger.Warn("override_registry_unavailable", zap.Error(e.overrideErr))
+	}
+	if e.candlesErr != nil {
+		e.logger.Warn("candle_history_unavailable", zap.Error(e.candlesErr))
+	}
+	if e.journalErr != nil {
+		e.logger.Warn("signal_journal_unavailable", zap.Error(e.journalErr))
+	} else if e.metrics.SignalReplayed > 0 {
+		e.logger.Info("signals_replayed", zap.Int64("count", e.metrics.SignalReplayed))
+	}
 
 	for {
 		select {
 		case <-ctx.Done():
+			if e.fullCfg.Stealth.Enable {
+				if err := e.evolver.Save(); err != nil {
+					e.logger.Warn("stealth_population_save_failed", zap.Error(err))
+				}
+			}
+			if e.journal != nil {
+				e.journal.Close()
+			}
+			e.candles.Close()
 			return ctx.Err()
 		case sig := <-e.signals:
-			e.mu.Lock()
-			e.lastSig[sig.AccountID+"|"+sig.Symbol] = sig
-			e.mu.Unlock()
+			e.processSignal(sig)
 		case cmd := <-e.commands:
 			e.handleCommand(cmd)
+		case req := <-e.cmdReqs:
+			req.reply <- e.executeCommand(req.cmd, time.Now())
 		case <-ticker.C:
+			start := time.Now()
+			e.drainOverflow()
 			e.step()
+			e.observeStep(start)
 		}
 	}
 }
 
 // handleCommand processes override commands (pause, resume, etc.)
 func (e *Engine) handleCommand(cmd model.Command) {
+	if cmd.Time.IsZero() {
+		cmd.Time = time.Now()
+	}
+	status := model.CommandApplied
 	switch cmd.Type {
 	case model.CommandPause:
-		e.mu.Lock()
-		e.paused = true
-		e.mu.Unlock()
-		e.logger.Info("engine_paused")
+		scope := commandScope(cmd)
+		e.control.Set(scope, model.TradingPaused, cmd.Reason, time.Now())
+		e.logger.Info("trading_paused", zap.Stringer("scope", scope), zap.String("reason", cmd.Reason))
+		e.publishAlert(model.AlertWarning, "TRADING_PAUSED", "trading paused for "+scope.String(), scope.AccountID, scope.Symbol)
 	case model.CommandResume:
-		e.mu.Lock()
-		e.paused = false
-		e.frozen = false
-		e.mu.Unlock()
-		e.logger.Info("engine_resumed")
+		scope := commandScope(cmd)
+		cleared := e.control.Resume(scope)
+		if scope.Symbol == "" && scope.Strategy == "" {
+			e.hedge.SetForced(cmd.AccountID, false)
+		}
+		e.logger.Info("trading_resumed", zap.Stringer("scope", scope), zap.Int("cleared", cleared))
+		e.publishAlert(model.AlertInfo, "TRADING_RESUMED", "trading resumed for "+scope.String(), scope.AccountID, scope.Symbol)
 	case model.CommandHedgeAll:
-		cmds := e.buildHedgeAllCommands(cmd.AccountID)
-		e.sendAll(cmds)
+		// Lock is applied by the hedge engine on the next step
+		e.hedge.SetForced(cmd.AccountID, true)
+		e.logger.Warn("hedge_all_requested", zap.String("account", cmd.AccountID))
 	case model.CommandCloseAll:
 		cmds := e.buildCloseAllCommands(cmd.AccountID, "CLOSE_ALL", time.Now())
-		e.sendAll(cmds)
+		e.sendAll(cmd.Source, cmds)
 	case model.CommandFreeze:
-		e.mu.Lock()
-		e.frozen = true
-		e.mu.Unlock()
-		e.logger.Warn("engine_frozen")
+		scope := commandScope(cmd)
+		e.control.Set(scope, model.TradingFrozen, cmd.Reason, time.Now())
+		e.logger.Warn("trading_frozen", zap.Stringer("scope", scope), zap.String("reason", cmd.Reason))
+		e.publishAlert(model.AlertCritical, "TRADING_FROZEN", "trading frozen for "+scope.String(), scope.AccountID, scope.Symbol)
+	case model.CommandPartialClose:
+		resolved, err := e.preparePartialClose(cmd)
+		if err != nil {
+			e.logger.Warn("partial_close_rejected", zap.Int64("ticket", cmd.Ticket), zap.Error(err))
+			return
+		}
+		status = sentStatus(e.dispatch(resolved))
+		cmd = resolved
+	case model.CommandOpen, model.CommandClose, model.CommandModify:
+		status = sentStatus(e.dispatch(cmd))
 	default:
-		e.bridge.SendCommand(cmd)
+		e.logger.Warn("unknown_command_dropped", zap.String("type", string(cmd.Type)))
+		return
 	}
 
-	e.mu.Lock()
-	e.metrics.CommandCount++
-	e.metrics.LastCommandAt = time.Now()
-	e.recentCmds = append(e.recentCmds, cmd)
-	if len(e.recentCmds) > 50 {
-		e.recentCmds = e.recentCmds[len(e.recentCmds)-50:]
-	}
-	e.mu.Unlock()
+	e.recordCommand(cmd)
+	e.auditCommand(cmd, status, nil)
 }
 
 // step is the main 50ms processing tick.
@@ -304,33 +604,66 @@ func (e *Engine) step() {
 	ticks := e.bridge.ReadTicks(1024)
 	if len(ticks) > 0 {
 		e.store.AddTicks(ticks)
+		if err := e.candles.Add(ticks); err != nil {
+			e.logger.Warn("candle_history_write_failed", zap.Error(err))
+		}
 		e.mu.Lock()
 		e.metrics.TickCount += int64(len(ticks))
 		e.metrics.LastTickAt = ticks[len(ticks)-1].Time
+		e.metrics.BridgeLagMs = float64(now.Sub(ticks[len(ticks)-1].Time)) / float64(time.Millisecond)
 		e.mu.Unlock()
+		for _, t := range ticks {
+			e.publish(model.TopicTick, "", t.Symbol, t)
+		}
 	}
 
 	positions := e.bridge.ReadPositions(1024)
 	if len(positions) > 0 {
+		actions := make([]string, len(positions))
+		for i, pos := range positions {
+			actions[i] = "UPDATED"
+			if _, ok := e.store.FindPosition(pos.AccountID, pos.ID); !ok {
+				actions[i] = "OPENED"
+			}
+		}
 		e.store.UpdatePositions(positions)
 		e.mu.Lock()
 		e.metrics.PositionCount += int64(len(positions))
 		e.mu.Unlock()
+		for i, pos := range positions {
+			e.publishPosition(actions[i], pos)
+		}
 	}
+	e.matchFills(positions, now)
 
 	accounts := e.bridge.ReadAccounts(1024)
 	if len(accounts) > 0 {
 		e.store.UpdateAccounts(accounts)
+		for _, acct := range accounts {
+			e.publish(model.TopicAccount, acct.AccountID, "", acct)
+		}
+	}
+	e.trackClosures(positions, accounts, now)
+	e.settlePartials(positions, now)
+
+	if len(ticks) > 0 || len(positions) > 0 || len(accounts) > 0 {
+		e.mu.Lock()
+		e.metrics.LastBridgeDataAt = now
+		e.mu.Unlock()
 	}
 
 	e.bridge.Heartbeat(now)
 
-	// ── Skip trading logic if paused or frozen ──
-	e.mu.Lock()
-	paused := e.paused
-	frozen := e.frozen
-	e.mu.Unlock()
-	if paused || frozen {
+	// ── Stealth shadow evaluation (runs even while paused) ──
+	if e.fullCfg.Stealth.Enable {
+		e.evolveStealth(ticks, now)
+	}
+
+	e.expireOverrides(now)
+
+	// ── Skip trading logic if frozen globally; a global pause still runs
+	// the stealth exits ──
+	if e.control.Mode(Scope{}) == model.TradingFrozen {
 		return
 	}
 
@@ -338,6 +671,19 @@ func (e *Engine) step() {
 	e.processTradingLogic()
 }
 
+// stealthExits sends the stealth exits of an account. Positions on frozen
+// scopes are left alone; paused ones are still closed.
+func (e *Engine) stealthExits(accountID string, positions []model.Position, quotes map[string]SymbolSnapshot) {
+	var open []model.Position
+	for _, pos := range positions {
+		scope := Scope{AccountID: accountID, Symbol: pos.Symbol, Strategy: StrategyStealth}
+		if e.control.Mode(scope) != model.TradingFrozen {
+			open = append(open, pos)
+		}
+	}
+	e.sendAll(strategySource(StrategyStealth), e.stealth.Exits(accountID, open, quotes, time.Now()))
+}
+
 // processTradingLogic runs grid, cascade, guard, and smart close.
 func (e *Engine) processTradingLogic() {
 	snapshot := e.store.Snapshot()
@@ -350,39 +696,82 @@ func (e *Engine) processTradingLogic() {
 		return
 	}
 
+	quotes := make(map[string]SymbolSnapshot, len(snapshot.Symbols))
+	for _, sym := range snapshot.Symbols {
+		quotes[sym.Symbol] = sym
+	}
+
 	for _, acct := range snapshot.Accounts {
 		// Update drawdown
 		acct = UpdateDrawdown(acct)
 		e.store.SetAccount(acct)
 
-		// Evaluate guard level
+		// Paused accounts only run the stealth exits; frozen ones are
+		// left alone
+		if !e.control.Allowed(acct.AccountID, "", "") {
+			e.stealthExits(acct.AccountID, filterAccountPositions(snapshot.Positions, acct.AccountID), quotes)
+			continue
+		}
+
+		// Evaluate guard level, raised by a manual override if any
 		guard := e.guard.Evaluate(acct)
+		if o, ok := e.overrides.Match(model.OverrideGuardLevel, acct.AccountID, "", time.Now()); ok {
+			guard = e.guard.Raise(guard, model.GuardLevel(o.Value))
+		}
+		e.auditGuard(acct, guard.Level)
 
 		// Handle forced actions
 		if guard.ForceClose {
 			cmds := e.buildCloseAllCommands(acct.AccountID, "GUARD_BLACK", time.Now())
-			e.sendAll(cmds)
-			e.mu.Lock()
-			e.frozen = true
-			e.mu.Unlock()
+			e.sendAll(SourceGuard, cmds)
+			e.control.Set(Scope{AccountID: acct.AccountID}, model.TradingFrozen, "GUARD_BLACK", time.Now())
 			e.logger.Error("guard_black_close_all",
 				zap.String("account", acct.AccountID),
 				zap.Float64("drawdown", acct.DrawdownPct),
 			)
+			e.publishAlert(model.AlertCritical, "GUARD_BLACK",
+				fmt.Sprintf("drawdown %.2f%%: closing all positions and freezing the account", acct.DrawdownPct),
+				acct.AccountID, "")
 			continue
 		}
+		acctPositions := e.netOfPartials(filterAccountPositions(snapshot.Positions, acct.AccountID))
+
+		// Hedge evaluation (partial, lock, delayed, unlock)
+		hedgeCmds := e.hedge.Evaluate(acct.AccountID, acctPositions,
+			e.quotesFor(acct.AccountID, StrategyHedge, quotes), guard.ForceHedge, time.Now())
+		e.sendAll(strategySource(StrategyHedge), hedgeCmds)
+
+		// Stealth HFT (magic range 5000-5999): exits at every guard level,
+		// entries gated by it
+		e.stealthExits(acct.AccountID, acctPositions, quotes)
 		if guard.ForceHedge {
-			cmds := e.buildHedgeAllCommands(acct.AccountID)
-			e.sendAll(cmds)
 			continue
 		}
+		stealthCmds := e.stealth.Evaluate(acct.AccountID, acctPositions,
+			e.quotesFor(acct.AccountID, StrategyStealth, quotes), e.store, guard, time.Now())
+		e.sendAll(strategySource(StrategyStealth), stealthCmds)
+
+		// Signal execution (magic range 6000-6999)
+		sigCmds, sigResults := e.signalProc.Execute(acct.AccountID, acctPositions,
+			e.quotesFor(acct.AccountID, StrategySignal, quotes), guard, time.Now())
+		e.sendAll(strategySource(StrategySignal), sigCmds)
+		for _, res := range sigResults {
+			e.updateSignal(res)
+		}
 
-		acctPositions := filterAccountPositions(snapshot.Positions, acct.AccountID)
-
-		// Smart close evaluation
-		scResult := e.smartClose.Evaluate(acctPositions, acct)
+		// Smart close evaluation, over grid and cascade positions (magic
+		// range 1000-4999) only: hedge legs, stealth and signal positions
+		// are managed by their own engines. Legs of a locked symbol stay
+		// put so the lock is not broken from the basket side.
+		var scPositions []model.Position
+		for _, pos := range filterGridPositions(acctPositions, gridMagicStart, gridMagicEnd) {
+			if !e.hedge.IsLocked(acct.AccountID, pos.Symbol) {
+				scPositions = append(scPositions, pos)
+			}
+		}
+		scResult := e.smartClose.Evaluate(e.positionsFor(acct.AccountID, StrategySmartClose, scPositions), acct)
 		if scResult.ShouldClose {
-			e.sendAll(scResult.Commands)
+			e.sendAll(strategySource(StrategySmartClose), scResult.Commands)
 			continue
 		}
 
@@ -392,6 +781,14 @@ func (e *Engine) processTradingLogic() {
 				continue
 			}
 
+			// Locked baskets must not grow
+			if e.hedge.IsLocked(acct.AccountID, sym.Symbol) {
+				continue
+			}
+			if !e.control.Allowed(acct.AccountID, sym.Symbol, StrategyGrid) {
+				continue
+			}
+
 			symbolPositions := filterSymbolPositions(acctPositions, sym.Symbol)
 
 			// Consolidation filter
@@ -401,9 +798,21 @@ func (e *Engine) processTradingLogic() {
 				continue
 			}
 
-			// Determine grid direction from scoring
+			// Determine grid direction from an override, an active signal,
+			// else scoring
 			direction := GridBothDir
-			if len(ticks) > 50 {
+			if o, ok := e.overrides.Match(model.OverrideDirection, acct.AccountID, sym.Symbol, time.Now()); ok {
+				direction = GridBuyOnly
+				if model.Side(o.Value) == model.SideSell {
+					direction = GridSellOnly
+				}
+			} else if side, ok := e.signalProc.Direction(acct.AccountID, sym.Symbol, time.Now()); ok {
+				if side == model.SideBuy {
+					direction = GridBuyOnly
+				} else {
+					direction = GridSellOnly
+				}
+			} else if len(ticks) > 50 {
 				score := e.scoring.Score(sym.Symbol, ticks)
 				if score.Direction == model.SideBuy {
 					direction = GridBuyOnly
@@ -413,36 +822,66 @@ func (e *Engine) processTradingLogic() {
 			}
 
 			// Grid evaluation
-			grid := e.gridMgr.GetOrCreate(sym.Symbol, acct.AccountID, *preset)
+			symPreset := e.symbolPreset(acct.AccountID, sym.Symbol, preset, time.Now())
+			grid := e.gridMgr.GetOrCreate(sym.Symbol, acct.AccountID, *symPreset)
 			gridCmds := grid.Evaluate(sym.Bid, sym.Ask, symbolPositions, guard, direction, 1000)
-			e.sendAll(gridCmds)
+			e.sendAll(strategySource(StrategyGrid), gridCmds)
 
 			// Cascade evaluation
-			if guard.AllowCascade && preset.CascadeLevels > 0 {
-				cascade := e.cascadeMgr.GetOrCreate(sym.Symbol, acct.AccountID, preset.CascadeLevels)
+			_, noCascade := e.overrides.Match(model.OverrideDisableCascade, acct.AccountID, sym.Symbol, time.Now())
+			if guard.AllowCascade && symPreset.CascadeLevels > 0 && !noCascade &&
+				e.control.Allowed(acct.AccountID, sym.Symbol, StrategyCascade) {
+				cascade := e.cascadeMgr.GetOrCreate(sym.Symbol, acct.AccountID, symPreset.CascadeLevels)
 				if grid.State().AnchorPrice > 0 {
 					if len(cascade.Levels()) > 0 && cascade.Levels()[0].Price == 0 {
 						side := model.SideBuy
 						if direction == GridSellOnly {
 							side = model.SideSell
 						}
-						cascade.Initialize(grid.State().AnchorPrice, preset.GridSpacing, side)
+						cascade.Initialize(grid.State().AnchorPrice, symPreset.GridSpacing, side)
 					}
 
 					cascadeParams := GridCascadeParams{
-						BaseLot:       preset.BaseLot,
-						LotMultiplier: preset.LotMultiplier,
+						BaseLot:       symPreset.BaseLot,
+						LotMultiplier: symPreset.LotMultiplier,
 						Direction:     model.SideBuy,
 					}
 					if direction == GridSellOnly {
 						cascadeParams.Direction = model.SideSell
 					}
 					cascadeCmds := cascade.Evaluate(sym.Bid, sym.Ask, symbolPositions, guard, cascadeParams)
-					e.sendAll(cascadeCmds)
+					e.sendAll(strategySource(StrategyCascade), cascadeCmds)
 				}
 			}
 		}
 	}
+
+	for _, res := range e.signalProc.Sweep(sortedAccountIDs(snapshot.Accounts), time.Now()) {
+		e.updateSignal(res)
+	}
+}
+
+// evolveStealth feeds new ticks to the genetic optimizer and promotes the
+// winning genome to the live stealth engine at generation boundaries.
+func (e *Engine) evolveStealth(ticks []model.Tick, now time.Time) {
+	seen := make(map[string]bool)
+	for _, t := range ticks {
+		if seen[t.Symbol] {
+			continue
+		}
+		seen[t.Symbol] = true
+		e.evolver.Observe(t.Symbol, e.store.GetTicks(t.Symbol), now)
+	}
+	if params, promoted := e.evolver.Step(e.stealth.LosingStreak(), now); promoted {
+		e.stealth.SetParams(params)
+		e.logger.Info("stealth_params_promoted",
+			zap.Int("window", params.Window),
+			zap.Float64("imbalance_min", params.ImbalanceMin),
+			zap.Float64("momentum_pips", params.MomentumPips),
+			zap.Float64("tp_pips", params.TPPips),
+			zap.Float64("sl_pips", params.SLPips),
+		)
+	}
 }
 
 // findPreset returns the preset config by name.
@@ -458,35 +897,6 @@ func (e *Engine) findPreset(name string) *config.PresetConfig {
 	return nil
 }
 
-// buildHedgeAllCommands creates hedge commands for all open positions.
-func (e *Engine) buildHedgeAllCommands(accountID string) []model.Command {
-	snapshot := e.store.Snapshot()
-	cmds := make([]model.Command, 0)
-	for _, pos := range snapshot.Positions {
-		if pos.Pending {
-			continue
-		}
-		if accountID != "" && pos.AccountID != accountID {
-			continue
-		}
-		side := model.SideBuy
-		if pos.Side == model.SideBuy {
-			side = model.SideSell
-		}
-		cmds = append(cmds, model.Command{
-			Type:      model.CommandOpen,
-			Symbol:    pos.Symbol,
-			Side:      side,
-			Volume:    pos.Volume,
-			Magic:     pos.Magic,
-			AccountID: pos.AccountID,
-			Reason:    "HEDGE_ALL",
-			Time:      time.Now(),
-		})
-	}
-	return cmds
-}
-
 // buildCloseAllCommands creates close commands for all open positions.
 func (e *Engine) buildCloseAllCommands(accountID, reason string, at time.Time) []model.Command {
 	snapshot := e.store.Snapshot()
@@ -512,19 +922,74 @@ func (e *Engine) buildCloseAllCommands(accountID, reason string, at time.Time) [
 	return cmds
 }
 
-// sendAll sends multiple commands through the bridge.
-func (e *Engine) sendAll(cmds []model.Command) {
+// sendAll sends multiple commands through the bridge, recording source as
+// their producer.
+func (e *Engine) sendAll(source string, cmds []model.Command) {
 	for _, cmd := range cmds {
-		e.bridge.SendCommand(cmd)
-		e.mu.Lock()
-		e.metrics.CommandCount++
-		e.metrics.LastCommandAt = time.Now()
-		e.recentCmds = append(e.recentCmds, cmd)
-		if len(e.recentCmds) > 50 {
-			e.recentCmds = e.recentCmds[len(e.recentCmds)-50:]
+		if cmd.Source == "" {
+			cmd.Source = source
+		}
+		if cmd.Time.IsZero() {
+			cmd.Time = time.Now()
+		}
+		if cmd.Type == model.CommandPartialClose {
+			resolved, err := e.preparePartialClose(cmd)
+			if err != nil {
+				e.logger.Warn("partial_close_rejected", zap.Int64("ticket", cmd.Ticket), zap.Error(err))
+				continue
+			}
+			cmd = resolved
 		}
+		ok := e.dispatch(cmd)
+		e.recordCommand(cmd)
+		e.auditCommand(cmd, sentStatus(ok), nil)
+	}
+}
+
+// sentStatus maps a bridge write result onto a command status.
+func sentStatus(ok bool) model.CommandStatus {
+	if ok {
+		return model.CommandSent
+	}
+	return model.CommandFailed
+}
+
+// dispatch writes a single command to the bridge. Partial closes are
+// tracked as in flight until the EA reports the reduced volume, so the
+// next step does not repeat them.
+func (e *Engine) dispatch(cmd model.Command) bool {
+	var closing model.Position
+	isClose := cmd.Type == model.CommandClose || cmd.Type == model.CommandPartialClose
+	if isClose && cmd.Ticket > 0 {
+		closing, isClose = e.store.FindPosition(cmd.AccountID, cmd.Ticket)
+	}
+	ok := e.bridge.SendCommand(cmd)
+	if !ok {
+		e.mu.Lock()
+		e.metrics.CommandFailed++
 		e.mu.Unlock()
 	}
+	if ok && cmd.Type == model.CommandPartialClose {
+		remaining := 0.0
+		if isClose {
+			remaining = e.trackPartial(closing, cmd.Volume, time.Now())
+		}
+		e.logger.Info("partial_close_sent",
+			zap.Int64("ticket", cmd.Ticket),
+			zap.Float64("volume", cmd.Volume),
+			zap.Float64("remaining", remaining),
+			zap.String("reason", cmd.Reason),
+		)
+		if isClose {
+			closing.Volume = remaining
+			action := "REDUCED"
+			if remaining == 0 {
+				action = "CLOSED"
+			}
+			e.publishPosition(action, closing)
+		}
+	}
+	return ok
 }
 
 // filterAccountPositions returns positions for a specific account.
@@ -0,0 +1,52 @@
+package engine
+
+import (
+	"time"
+
+	"go-trade/internal/model"
+)
+
+// Event is an incremental state change published to the event sink.
+// AccountID and Symbol are set when the change concerns one account or
+// symbol, so subscribers can filter on them.
+type Event struct {
+	Topic     string
+	AccountID string
+	Symbol    string
+	Data      any
+	Time      time.Time
+}
+
+// EventSink receives engine events. It is called from the engine loop and
+// must not block.
+type EventSink func(Event)
+
+// SetEventSink attaches the event sink. Without one no events are
+// published. Must be called before Run.
+func (e *Engine) SetEventSink(sink EventSink) {
+	e.events = sink
+}
+
+// publish hands an event to the sink.
+func (e *Engine) publish(topic, accountID, symbol string, data any) {
+	if e.events == nil {
+		return
+	}
+	e.events(Event{Topic: topic, AccountID: accountID, Symbol: symbol, Data: data, Time: time.Now()})
+}
+
+// publishAlert publishes an operator alert.
+func (e *Engine) publishAlert(severity model.AlertSeverity, code, message, accountID, symbol string) {
+	e.publish(model.TopicAlert, accountID, symbol, model.Alert{
+		Severity:  severity,
+		Code:      code,
+		Message:   message,
+		AccountID: accountID,
+		Symbol:    symbol,
+	})
+}
+
+// publishPosition publishes a position change.
+func (e *Engine) publishPosition(action string, pos model.Position) {
+	e.publish(model.TopicPosition, pos.AccountID, pos.Symbol, model.PositionEvent{Action: action, Position: pos})
+}
@@ -0,0 +1,402 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"go-trade/internal/config"
+	"go-trade/internal/model"
+
+	"go.uber.org/zap"
+)
+
+// evolutionMinTrades is the number of paper trades a genome needs before
+// its fitness is trusted for ranking and promotion.
+const evolutionMinTrades = 3
+
+// StealthGenome is one candidate parameter set with its shadow-mode
+// (paper) performance for the current generation.
+type StealthGenome struct {
+	ID        int           `json:"id"`
+	Params    StealthParams `json:"params"`
+	Trades    int           `json:"trades"`
+	Wins      int           `json:"wins"`
+	PnLPips   float64       `json:"pnlPips"`
+	PeakPips  float64       `json:"peakPips"`
+	MaxDDPips float64       `json:"maxDdPips"`
+	Fitness   float64       `json:"fitness"`
+
+	open map[string]*paperTrade // symbol -> open paper trade
+}
+
+// paperTrade is a simulated stealth position held by a genome.
+type paperTrade struct {
+	side   model.Side
+	entry  float64
+	openAt time.Time
+}
+
+// EvolutionState is a serializable view of the optimizer.
+type EvolutionState struct {
+	Generation   int             `json:"generation"`
+	StartedAt    time.Time       `json:"startedAt"`
+	MutationRate float64         `json:"mutationRate"`
+	Promoted     StealthParams   `json:"promoted"`
+	Population   []StealthGenome `json:"population"`
+}
+
+// Evolver runs a genetic optimizer over stealth parameters. Every genome
+// paper-trades the live tick stream in shadow mode; at the end of each
+// generation the fittest genome is promoted to the live stealth engine and
+// a new population is bred. Mutation is boosted while the live strategy is
+// on a losing streak. The population is persisted to the data directory.
+type Evolver struct {
+	mu         sync.Mutex
+	cfg        config.StealthConfig
+	path       string
+	rng        *rand.Rand
+	population []*StealthGenome
+	generation int
+	startedAt  time.Time
+	promoted   StealthParams
+	boosted    bool
+	nextID     int
+	logger     *zap.Logger
+}
+
+// NewEvolver creates an optimizer, restoring a persisted population from
+// dataDir when one exists.
+func NewEvolver(cfg config.StealthConfig, dataDir string, logger *zap.Logger) *Evolver {
+	ev := &Evolver{
+		cfg:       cfg,
+		path:      filepath.Join(dataDir, "stealth_population.json"),
+		rng:       rand.New(rand.NewSource(time.Now().UnixNano())),
+		startedAt: time.Now(),
+		promoted:  DefaultStealthParams(),
+		logger:    logger,
+	}
+	if err := ev.load(); err != nil {
+		ev.seed()
+	}
+	return ev
+}
+
+// Promoted returns the parameters of the last promoted genome.
+func (ev *Evolver) Promoted() StealthParams {
+	ev.mu.Lock()
+	defer ev.mu.Unlock()
+	return ev.promoted
+}
+
+// Observe feeds the latest ticks of a symbol to every genome, closing and
+// opening paper trades.
+func (ev *Evolver) Observe(symbol string, ticks []model.Tick, now time.Time) {
+	if len(ticks) == 0 {
+		return
+	}
+	ev.mu.Lock()
+	defer ev.mu.Unlock()
+
+	last := ticks[len(ticks)-1]
+	pip := pipSize(symbol)
+	maxHold := time.Duration(ev.cfg.MaxHoldMinutes) * time.Minute
+
+	for _, g := range ev.population {
+		if trade, ok := g.open[symbol]; ok {
+			movePips := (last.Bid - trade.entry) / pip
+			if trade.side == model.SideSell {
+				movePips = (trade.entry - last.Ask) / pip
+			}
+			expired := maxHold > 0 && now.Sub(trade.openAt) >= maxHold
+			if movePips >= g.Params.TPPips || movePips <= -g.Params.SLPips || expired {
+				g.book(movePips)
+				delete(g.open, symbol)
+			}
+			continue
+		}
+		side, ok := StealthSignal(ticks, g.Params)
+		if !ok {
+			continue
+		}
+		entry := last.Ask
+		if side == model.SideSell {
+			entry = last.Bid
+		}
+		g.open[symbol] = &paperTrade{side: side, entry: entry, openAt: now}
+	}
+}
+
+// Step ends the current generation once generationMinutes have elapsed.
+// It returns the newly promoted parameters and true when a promotion
+// happened. losingStreak is the live stealth engine's consecutive losses.
+func (ev *Evolver) Step(losingStreak int, now time.Time) (StealthParams, bool) {
+	ev.mu.Lock()
+	defer ev.mu.Unlock()
+
+	ev.boosted = ev.cfg.BoostAfterLosses > 0 && losingStreak >= ev.cfg.BoostAfterLosses
+	if now.Sub(ev.startedAt) < time.Duration(ev.cfg.GenerationMinutes)*time.Minute {
+		return StealthParams{}, false
+	}
+
+	ranked := ev.rank()
+	best := ranked[0]
+	promoted := best.Trades >= evolutionMinTrades && best.PnLPips > 0
+	if promoted {
+		ev.promoted = best.Params
+	}
+
+	ev.logger.Info("stealth_generation_complete",
+		zap.Int("generation", ev.generation),
+		zap.Int("best_id", best.ID),
+		zap.Float64("best_fitness", best.Fitness),
+		zap.Float64("best_pnl_pips", best.PnLPips),
+		zap.Int("best_trades", best.Trades),
+		zap.Bool("promoted", promoted),
+		zap.Float64("mutation_rate", ev.mutationRate()),
+	)
+
+	ev.breed(ranked)
+	ev.generation++
+	ev.startedAt = now
+	if err := ev.saveLocked(); err != nil {
+		ev.logger.Warn("stealth_population_save_failed", zap.Error(err))
+	}
+	return ev.promoted, promoted
+}
+
+// Save persists the population to disk.
+func (ev *Evolver) Save() error {
+	ev.mu.Lock()
+	defer ev.mu.Unlock()
+	return ev.saveLocked()
+}
+
+// State returns a snapshot of the optimizer for API consumers.
+func (ev *Evolver) State() EvolutionState {
+	ev.mu.Lock()
+	defer ev.mu.Unlock()
+	pop := make([]StealthGenome, 0, len(ev.population))
+	for _, g := range ev.population {
+		c := *g
+		c.open = nil
+		c.Fitness = fitness(g)
+		pop = append(pop, c)
+	}
+	return EvolutionState{
+		Generation:   ev.generation,
+		StartedAt:    ev.startedAt,
+		MutationRate: ev.mutationRate(),
+		Promoted:     ev.promoted,
+		Population:   pop,
+	}
+}
+
+// rank computes fitness and sorts the population best first.
+func (ev *Evolver) rank() []*StealthGenome {
+	ranked := make([]*StealthGenome, len(ev.population))
+	copy(ranked, ev.population)
+	for _, g := range ranked {
+		g.Fitness = fitness(g)
+	}
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return ranked[i].Fitness > ranked[j].Fitness
+	})
+	return ranked
+}
+
+// breed replaces the population: the two fittest genomes survive unchanged
+// (elitism), the rest are tournament-selected, crossed over and mutated.
+func (ev *Evolver) breed(ranked []*StealthGenome) {
+	size := ev.populationSize()
+	next := make([]*StealthGenome, 0, size)
+	for i := 0; i < len(ranked) && i < 2 && len(next) < size; i++ {
+		next = append(next, ev.newGenome(ranked[i].Params))
+	}
+	rate := ev.mutationRate()
+	for len(next) < size {
+		a := ev.tournament(ranked)
+		b := ev.tournament(ranked)
+		child := crossover(a.Params, b.Params, ev.rng)
+		next = append(next, ev.newGenome(mutate(child, rate, ev.rng)))
+	}
+	ev.population = next
+}
+
+// tournament picks the fitter of two random genomes.
+func (ev *Evolver) tournament(ranked []*StealthGenome) *StealthGenome {
+	a := ranked[ev.rng.Intn(len(ranked))]
+	b := ranked[ev.rng.Intn(len(ranked))]
+	if a.Fitness >= b.Fitness {
+		return a
+	}
+	return b
+}
+
+// seed creates a fresh population around the promoted parameters.
+func (ev *Evolver) seed() {
+	size := ev.populationSize()
+	ev.population = make([]*StealthGenome, 0, size)
+	ev.population = append(ev.population, ev.newGenome(ev.promoted))
+	for len(ev.population) < size {
+		ev.population = append(ev.population, ev.newGenome(mutate(ev.promoted, 1.0, ev.rng)))
+	}
+}
+
+// newGenome allocates a genome with a fresh ID and empty paper book.
+func (ev *Evolver) newGenome(p StealthParams) *StealthGenome {
+	ev.nextID++
+	return &StealthGenome{
+		ID:     ev.nextID,
+		Params: p,
+		open:   make(map[string]*paperTrade),
+	}
+}
+
+// mutationRate returns the base or boosted mutation rate.
+func (ev *Evolver) mutationRate() float64 {
+	if ev.boosted {
+		return ev.cfg.MutationRateBoost
+	}
+	return ev.cfg.MutationRateBase
+}
+
+// populationSize returns the configured size with a minimum of 2.
+func (ev *Evolver) populationSize() int {
+	if ev.cfg.PopulationSize < 2 {
+		return 2
+	}
+	return ev.cfg.PopulationSize
+}
+
+// evolutionFile is the on-disk population format.
+type evolutionFile struct {
+	Generation int             `json:"generation"`
+	Promoted   StealthParams   `json:"promoted"`
+	Population []StealthGenome `json:"population"`
+	SavedAt    time.Time       `json:"savedAt"`
+}
+
+// saveLocked writes the population atomically. Caller must hold ev.mu.
+func (ev *Evolver) saveLocked() error {
+	file := evolutionFile{
+		Generation: ev.generation,
+		Promoted:   ev.promoted,
+		SavedAt:    time.Now(),
+	}
+	for _, g := range ev.population {
+		c := *g
+		c.open = nil
+		file.Population = append(file.Population, c)
+	}
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding population: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(ev.path), 0o755); err != nil {
+		return fmt.Errorf("creating data directory: %w", err)
+	}
+	tmp := ev.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("writing population: %w", err)
+	}
+	return os.Rename(tmp, ev.path)
+}
+
+// load restores a persisted population. Paper statistics are reset so the
+// restored genomes start a clean generation.
+func (ev *Evolver) load() error {
+	data, err := os.ReadFile(ev.path)
+	if err != nil {
+		return err
+	}
+	var file evolutionFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("parsing population %s: %w", ev.path, err)
+	}
+	if len(file.Population) == 0 {
+		return fmt.Errorf("population %s is empty", ev.path)
+	}
+	ev.generation = file.Generation
+	if file.Promoted.Window > 0 {
+		ev.promoted = file.Promoted
+	}
+	for _, g := range file.Population {
+		ev.population = append(ev.population, ev.newGenome(g.Params))
+	}
+	for len(ev.population) < ev.populationSize() {
+		ev.population = append(ev.population, ev.newGenome(mutate(ev.promoted, 1.0, ev.rng)))
+	}
+	return nil
+}
+
+// book records a closed paper trade.
+func (g *StealthGenome) book(pips float64) {
+	g.Trades++
+	if pips > 0 {
+		g.Wins++
+	}
+	g.PnLPips = math.Round((g.PnLPips+pips)*10) / 10
+	if g.PnLPips > g.PeakPips {
+		g.PeakPips = g.PnLPips
+	}
+	if dd := g.PeakPips - g.PnLPips; dd > g.MaxDDPips {
+		g.MaxDDPips = dd
+	}
+}
+
+// fitness scores a genome: paper P&L penalised by half its drawdown.
+// Genomes without enough trades rank below every evaluated genome.
+func fitness(g *StealthGenome) float64 {
+	score := g.PnLPips - 0.5*g.MaxDDPips
+	if g.Trades < evolutionMinTrades {
+		return score - 1e6
+	}
+	return score
+}
+
+// crossover mixes two parameter sets gene by gene.
+func crossover(a, b StealthParams, rng *rand.Rand) StealthParams {
+	pick := func(x, y float64) float64 {
+		if rng.Intn(2) == 0 {
+			return x
+		}
+		return y
+	}
+	child := StealthParams{
+		Window:        a.Window,
+		ImbalanceMin:  pick(a.ImbalanceMin, b.ImbalanceMin),
+		MomentumPips:  pick(a.MomentumPips, b.MomentumPips),
+		MaxSpreadPips: pick(a.MaxSpreadPips, b.MaxSpreadPips),
+		TPPips:        pick(a.TPPips, b.TPPips),
+		SLPips:        pick(a.SLPips, b.SLPips),
+	}
+	if rng.Intn(2) == 1 {
+		child.Window = b.Window
+	}
+	return child
+}
+
+// mutate perturbs each gene with probability rate by up to ±30% and
+// clamps the result to sane bounds.
+func mutate(p StealthParams, rate float64, rng *rand.Rand) StealthParams {
+	jitter := func(v, lo, hi float64) float64 {
+		if rng.Float64() >= rate {
+			return v
+		}
+		return clamp(v*(1+rng.NormFloat64()*0.3), lo, hi)
+	}
+	p.Window = int(math.Round(jitter(float64(p.Window), 5, 200)))
+	p.ImbalanceMin = jitter(p.ImbalanceMin, 0.05, 0.95)
+	p.MomentumPips = jitter(p.MomentumPips, 0.2, 20)
+	p.MaxSpreadPips = jitter(p.MaxSpreadPips, 0.5, 10)
+	p.TPPips = jitter(p.TPPips, 0.5, 30)
+	p.SLPips = jitter(p.SLPips, 0.5, 50)
+	return p
+}
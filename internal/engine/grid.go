@@ -21,6 +21,12 @@ const (
 	GridSellOnly
 )
 
+// Grid and cascade positions use magic numbers 1000-4999.
+const (
+	gridMagicStart = 1000
+	gridMagicEnd   = 4999
+)
+
 // GridEngine manages grid position placement for a single symbol+account.
 type GridEngine struct {
 	symbol    string
@@ -52,6 +58,12 @@ func (g *GridEngine) State() model.GridState {
 	return g.state
 }
 
+// SetPreset switches the grid to another preset, keeping its levels.
+func (g *GridEngine) SetPreset(preset config.PresetConfig) {
+	g.preset = preset
+	g.state.MaxLevel = preset.MaxLevels
+}
+
 // SetActive enables or disables the grid.
 func (g *GridEngine) SetActive(active bool) {
 	g.state.Active = active
@@ -330,6 +342,15 @@ func NewGridManager(logger *zap.Logger) *GridManager {
 func (m *GridManager) GetOrCreate(symbol, accountID string, preset config.PresetConfig) *GridEngine {
 	key := accountID + "|" + symbol
 	if g, ok := m.grids[key]; ok {
+		if g.preset.Name != preset.Name {
+			m.logger.Info("grid_preset_changed",
+				zap.String("symbol", symbol),
+				zap.String("account", accountID),
+				zap.String("from", g.preset.Name),
+				zap.String("to", preset.Name),
+			)
+			g.SetPreset(preset)
+		}
 		return g
 	}
 	g := NewGridEngine(symbol, accountID, preset, m.logger)
@@ -77,6 +77,35 @@ func (g *Guard) Evaluate(acct model.AccountState) GuardResult {
 	return result
 }
 
+// Raise returns res raised to level when level is stricter than the
+// evaluated one. Unknown levels leave res unchanged.
+func (g *Guard) Raise(res GuardResult, level model.GuardLevel) GuardResult {
+	i := g.levelIndex(level)
+	if i < 0 || i <= g.levelIndex(res.Level) {
+		return res
+	}
+	lvl := g.levels[i]
+	return GuardResult{
+		Level:        model.GuardLevel(lvl.Name),
+		MaxGridLevel: lvl.MaxGridLevel,
+		LotScale:     lvl.LotScale,
+		AllowCascade: lvl.AllowCascade,
+		AllowStealth: lvl.AllowStealth,
+		ForceHedge:   lvl.ForceHedge,
+		ForceClose:   lvl.ForceClose,
+	}
+}
+
+// levelIndex returns the position of a configured level, or -1.
+func (g *Guard) levelIndex(level model.GuardLevel) int {
+	for i, lvl := range g.levels {
+		if model.GuardLevel(lvl.Name) == level {
+			return i
+		}
+	}
+	return -1
+}
+
 // UpdateDrawdown recalculates drawdown fields on an AccountState
 // based on peak equity tracking. Returns the updated state.
 func UpdateDrawdown(acct model.AccountState) model.AccountState {
@@ -0,0 +1,79 @@
+package engine
+
+import (
+	"fmt"
+	"time"
+
+	"go-trade/internal/bridge"
+)
+
+// HealthCheck is the outcome of one readiness check.
+type HealthCheck struct {
+	Name   string `json:"name"`
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail"`
+}
+
+// Readiness is the combined result of the readiness checks.
+type Readiness struct {
+	Ready  bool          `json:"ready"`
+	Checks []HealthCheck `json:"checks"`
+}
+
+// Readiness reports whether the engine can trade: the bridge runs on
+// shared memory, the EA is delivering data, the loop is stepping, the
+// command ring has room and the configuration is valid. The SHM layout
+// has no EA-side heartbeat, so the time of the last tick, position or
+// account read from the bridge stands in for it.
+func (e *Engine) Readiness(now time.Time) Readiness {
+	rc := e.fullCfg.Engine.Readiness
+	e.mu.Lock()
+	lastData := e.metrics.LastBridgeDataAt
+	lastStep := e.metrics.LastStepAt
+	e.mu.Unlock()
+
+	var checks []HealthCheck
+	add := func(name string, ok bool, format string, args ...any) {
+		checks = append(checks, HealthCheck{Name: name, OK: ok, Detail: fmt.Sprintf(format, args...)})
+	}
+
+	mode := e.bridge.Mode()
+	add("bridge", mode == bridge.ModeSharedMemory, "mode %s", mode)
+
+	if lastData.IsZero() {
+		add("heartbeat", false, "no data received from the EA yet")
+	} else {
+		age := now.Sub(lastData)
+		add("heartbeat", age <= time.Duration(rc.HeartbeatStaleMs)*time.Millisecond,
+			"last EA data %dms ago (max %dms)", age.Milliseconds(), rc.HeartbeatStaleMs)
+	}
+
+	if lastStep.IsZero() {
+		add("engine_loop", false, "engine loop has not stepped yet")
+	} else {
+		age := now.Sub(lastStep)
+		add("engine_loop", age <= time.Duration(rc.StepStaleMs)*time.Millisecond,
+			"last step %dms ago (max %dms)", age.Milliseconds(), rc.StepStaleMs)
+	}
+
+	pending, capacity := e.bridge.CommandQueue()
+	if capacity == 0 {
+		add("command_ring", false, "command ring unreadable")
+	} else {
+		pct := float64(pending) / float64(capacity) * 100
+		add("command_ring", pct < rc.CommandRingMaxPct,
+			"%d/%d pending (%.1f%%, max %.0f%%)", pending, capacity, pct, rc.CommandRingMaxPct)
+	}
+
+	if e.configErr != nil {
+		add("config", false, "%v", e.configErr)
+	} else {
+		add("config", true, "valid")
+	}
+
+	ready := true
+	for _, c := range checks {
+		ready = ready && c.OK
+	}
+	return Readiness{Ready: ready, Checks: checks}
+}
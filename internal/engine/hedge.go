@@ -0,0 +1,551 @@
+package engine
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"go-trade/internal/config"
+	"go-trade/internal/model"
+
+	"go.uber.org/zap"
+)
+
+// HedgeStage represents how far a basket has been hedged.
+type HedgeStage string
+
+const (
+	HedgeNone    HedgeStage = "NONE"
+	HedgePartial HedgeStage = "PARTIAL"
+	HedgeLocked  HedgeStage = "LOCKED"
+)
+
+// hedgeRetryAfter is how long an unlock close is allowed to settle before
+// it is sent again.
+const hedgeRetryAfter = 10 * time.Second
+
+// HedgeEngine manages basket-level hedging. A basket is every grid and
+// cascade position (magic 1000-4999) on one side of an account+symbol;
+// stealth and signal positions are managed by their own engines. Once the basket's adverse
+// excursion passes partialClosePip it receives a partial hedge, past
+// lockThresholdPip it is fully locked, and once price recovers to within
+// unlockPip of the average entry the hedge is closed again.
+type HedgeEngine struct {
+	mu      sync.Mutex
+	cfg     config.HedgeConfig
+	baskets map[string]*hedgeBasket // key: accountID|symbol|side
+	forced  map[string]bool         // accountID -> manual HEDGE_ALL lock
+	logger  *zap.Logger
+}
+
+// hedgeBasket holds the hedge bookkeeping for a single basket.
+type hedgeBasket struct {
+	accountID  string
+	symbol     string
+	side       model.Side
+	stage      HedgeStage
+	armedAt    time.Time // first time a higher stage was requested (delay start)
+	armedPips  float64
+	sentVolume float64   // hedge volume requested so far
+	sentAt     time.Time // when the last hedge open was sent
+	trimAt     time.Time // when the last over-hedge trim was sent
+	unlockAt   time.Time
+	lossPips   float64
+	volume     float64
+	hedgeVol   float64
+}
+
+// HedgeState is a serializable view of a hedged basket.
+type HedgeState struct {
+	AccountID   string     `json:"accountId"`
+	Symbol      string     `json:"symbol"`
+	Side        model.Side `json:"side"`
+	Stage       HedgeStage `json:"stage"`
+	LossPips    float64    `json:"lossPips"`
+	Volume      float64    `json:"volume"`
+	HedgeVolume float64    `json:"hedgeVolume"`
+}
+
+// NewHedgeEngine creates a hedge engine from configuration.
+func NewHedgeEngine(cfg config.HedgeConfig, logger *zap.Logger) *HedgeEngine {
+	return &HedgeEngine{
+		cfg:     cfg,
+		baskets: make(map[string]*hedgeBasket),
+		forced:  make(map[string]bool),
+		logger:  logger,
+	}
+}
+
+// SetForced enables or clears a manual full lock for an account.
+// An empty accountID applies to every account.
+func (h *HedgeEngine) SetForced(accountID string, forced bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if accountID == "" && !forced {
+		h.forced = make(map[string]bool)
+		return
+	}
+	if forced {
+		h.forced[accountID] = true
+	} else {
+		delete(h.forced, accountID)
+	}
+}
+
+// IsForced reports whether a manual full lock is active for an account.
+func (h *HedgeEngine) IsForced(accountID string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.forced[accountID] || h.forced[""]
+}
+
+// IsLocked reports whether any basket on the symbol is fully locked.
+func (h *HedgeEngine) IsLocked(accountID, symbol string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, b := range h.baskets {
+		if b.accountID == accountID && b.symbol == symbol && b.stage == HedgeLocked {
+			return true
+		}
+	}
+	return false
+}
+
+// IsHedgeMagic reports whether a magic number belongs to the hedge range.
+func (h *HedgeEngine) IsHedgeMagic(magic int) bool {
+	return magic >= h.cfg.MagicBase && magic < h.cfg.MagicBase+100
+}
+
+// hedgeMagic returns the magic number used to hedge a basket on the given side.
+func (h *HedgeEngine) hedgeMagic(side model.Side) int {
+	if side == model.SideSell {
+		return h.cfg.MagicBase + 1
+	}
+	return h.cfg.MagicBase
+}
+
+// Evaluate checks every basket of an account and returns hedge open/close
+// commands. When force is set all baskets are fully locked immediately and
+// never unlocked. Commands are idempotent: a basket is only hedged up to
+// its target volume once, regardless of how often Evaluate runs.
+func (h *HedgeEngine) Evaluate(
+	accountID string,
+	positions []model.Position,
+	quotes map[string]SymbolSnapshot,
+	force bool,
+	now time.Time,
+) []model.Command {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	force = force || h.forced[accountID] || h.forced[""]
+	if !h.cfg.Enable && !force {
+		return nil
+	}
+
+	// Group basket and hedge positions per symbol+side
+	type group struct {
+		basket []model.Position
+		hedges []model.Position
+	}
+	groups := make(map[string]*group)
+	getGroup := func(symbol string, side model.Side) *group {
+		key := accountID + "|" + symbol + "|" + string(side)
+		g, ok := groups[key]
+		if !ok {
+			g = &group{}
+			groups[key] = g
+		}
+		return g
+	}
+	for _, pos := range positions {
+		if pos.Pending || pos.AccountID != accountID {
+			continue
+		}
+		if h.IsHedgeMagic(pos.Magic) {
+			// A hedge sits on the opposite side of the basket it protects
+			basketSide := model.SideBuy
+			if pos.Magic == h.hedgeMagic(model.SideSell) {
+				basketSide = model.SideSell
+			}
+			g := getGroup(pos.Symbol, basketSide)
+			g.hedges = append(g.hedges, pos)
+			continue
+		}
+		if pos.Magic < gridMagicStart || pos.Magic > gridMagicEnd {
+			continue
+		}
+		g := getGroup(pos.Symbol, pos.Side)
+		g.basket = append(g.basket, pos)
+	}
+	// Keep tracking baskets whose positions have all disappeared
+	for key, b := range h.baskets {
+		if b.accountID == accountID {
+			if _, ok := groups[key]; !ok {
+				groups[key] = &group{}
+			}
+		}
+	}
+
+	keys := make([]string, 0, len(groups))
+	for key := range groups {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var cmds []model.Command
+	for _, key := range keys {
+		g := groups[key]
+		b := h.baskets[key]
+		if b == nil {
+			var sample model.Position
+			if len(g.basket) > 0 {
+				sample = g.basket[0]
+			} else if len(g.hedges) > 0 {
+				sample = g.hedges[0]
+				sample.Side = oppositeSide(sample.Side)
+			} else {
+				continue
+			}
+			b = &hedgeBasket{
+				accountID: accountID,
+				symbol:    sample.Symbol,
+				side:      sample.Side,
+				stage:     HedgeNone,
+			}
+			h.baskets[key] = b
+		}
+		quote, ok := quotes[b.symbol]
+		if !ok || !quote.HasTick {
+			continue
+		}
+		cmds = append(cmds, h.evaluateBasket(b, g.basket, g.hedges, quote, force, now)...)
+		if len(g.basket) == 0 && len(g.hedges) == 0 {
+			delete(h.baskets, key)
+		}
+	}
+	return cmds
+}
+
+// evaluateBasket runs the hedge state machine for one basket.
+func (h *HedgeEngine) evaluateBasket(
+	b *hedgeBasket,
+	basket, hedges []model.Position,
+	quote SymbolSnapshot,
+	force bool,
+	now time.Time,
+) []model.Command {
+	volume, avgPrice := basketExposure(basket)
+	hedgeVol := 0.0
+	for _, pos := range hedges {
+		hedgeVol += pos.Volume
+	}
+	b.volume = volume
+	b.hedgeVol = hedgeVol
+
+	// Orphaned hedge: the basket was closed, release the hedge
+	if volume == 0 {
+		b.stage = HedgeNone
+		b.sentVolume = 0
+		b.lossPips = 0
+		if len(hedges) == 0 || now.Sub(b.unlockAt) < hedgeRetryAfter {
+			return nil
+		}
+		b.unlockAt = now
+		return h.buildHedgeClose(hedges, "HEDGE_ORPHAN_CLOSE", now)
+	}
+
+	// Pick up hedges that exist from a previous run
+	if b.stage == HedgeNone && hedgeVol > 0 && b.sentVolume == 0 && b.unlockAt.IsZero() {
+		b.sentVolume = hedgeVol
+		b.stage = HedgePartial
+		if hedgeVol >= volume-0.005 {
+			b.stage = HedgeLocked
+		}
+	}
+
+	// Reconcile with the legs actually open once the last open has had
+	// time to show up. A hedge closed elsewhere (smart close, stop-out,
+	// manual) downgrades the stage, so it is re-opened below and IsLocked
+	// stops holding back the grid.
+	if hedgeVol >= b.sentVolume-0.005 {
+		b.sentAt = time.Time{} // the last open has been filled
+	}
+	inFlight := !b.sentAt.IsZero() && now.Sub(b.sentAt) < hedgeRetryAfter
+	if !inFlight && b.stage != HedgeNone {
+		b.sentVolume = hedgeVol
+		if live := hedgeStageFor(hedgeVol, volume); hedgeStageRank(live) < hedgeStageRank(b.stage) {
+			h.logger.Warn("hedge_leg_lost",
+				zap.String("account", b.accountID),
+				zap.String("symbol", b.symbol),
+				zap.String("side", string(b.side)),
+				zap.String("stage", string(b.stage)),
+				zap.Float64("hedge_volume", hedgeVol),
+			)
+			b.stage = live
+		}
+	}
+	hedged := hedgeVol
+	if inFlight {
+		hedged = b.sentVolume
+	}
+
+	pip := pipSize(b.symbol)
+	lossPips := (avgPrice - quote.Bid) / pip
+	if b.side == model.SideSell {
+		lossPips = (quote.Ask - avgPrice) / pip
+	}
+	b.lossPips = math.Round(lossPips*10) / 10
+
+	target := HedgeNone
+	switch {
+	case force:
+		target = HedgeLocked
+	case h.cfg.LockThresholdPip > 0 && lossPips >= h.cfg.LockThresholdPip:
+		target = HedgeLocked
+	case h.cfg.PartialClosePip > 0 && lossPips >= h.cfg.PartialClosePip:
+		target = HedgePartial
+	}
+
+	// Unlock once price recovers, never while a lock is being forced
+	if !force && b.stage != HedgeNone && lossPips <= h.cfg.UnlockPip {
+		b.stage = HedgeNone
+		b.sentVolume = 0
+		b.armedAt = time.Time{}
+		if len(hedges) == 0 {
+			return nil
+		}
+		b.unlockAt = now
+		h.logger.Info("hedge_unlock",
+			zap.String("account", b.accountID),
+			zap.String("symbol", b.symbol),
+			zap.String("side", string(b.side)),
+			zap.Float64("loss_pips", lossPips),
+		)
+		return h.buildHedgeClose(hedges, "HEDGE_UNLOCK", now)
+	}
+	if b.stage == HedgeNone && len(hedges) > 0 && now.Sub(b.unlockAt) >= hedgeRetryAfter {
+		b.unlockAt = now
+		return h.buildHedgeClose(hedges, "HEDGE_UNLOCK", now)
+	}
+
+	if hedgeStageRank(target) <= hedgeStageRank(b.stage) {
+		b.armedAt = time.Time{}
+		// The basket shrank under its hedge (smart close, partial
+		// close, stop-out): trim the legs back to the stage's volume
+		if b.stage == HedgeNone || inFlight || now.Sub(b.trimAt) < hedgeRetryAfter {
+			return nil
+		}
+		targetVol := h.stageVolume(b.stage, volume)
+		excess := math.Round((hedgeVol-targetVol)*100) / 100
+		if excess < 0.01 {
+			return nil
+		}
+		b.trimAt = now
+		b.sentVolume = targetVol
+		h.logger.Warn("hedge_trim",
+			zap.String("account", b.accountID),
+			zap.String("symbol", b.symbol),
+			zap.String("side", string(b.side)),
+			zap.String("stage", string(b.stage)),
+			zap.Float64("basket_volume", volume),
+			zap.Float64("hedge_volume", hedgeVol),
+			zap.Float64("trim_volume", excess),
+		)
+		return h.buildHedgeTrim(hedges, excess, now)
+	}
+
+	// Delayed hedge: wait for time and/or further adverse movement
+	if !force && (h.cfg.DelaySeconds > 0 || h.cfg.DelayPips > 0) {
+		if b.armedAt.IsZero() {
+			b.armedAt = now
+			b.armedPips = lossPips
+			return nil
+		}
+		if now.Sub(b.armedAt) < time.Duration(h.cfg.DelaySeconds)*time.Second {
+			return nil
+		}
+		if lossPips-b.armedPips < h.cfg.DelayPips {
+			return nil
+		}
+	}
+
+	targetVol := h.stageVolume(target, volume)
+	delta := math.Round((targetVol-hedged)*100) / 100
+	b.stage = target
+	b.armedAt = time.Time{}
+	b.unlockAt = time.Time{}
+	if delta < 0.01 {
+		return nil
+	}
+	b.sentVolume = targetVol
+	b.sentAt = now
+
+	reason := "HEDGE_PARTIAL"
+	if target == HedgeLocked {
+		reason = "HEDGE_LOCK"
+	}
+	if force {
+		reason = "HEDGE_FORCE"
+	}
+	side := oppositeSide(b.side)
+	price := quote.Ask
+	if side == model.SideSell {
+		price = quote.Bid
+	}
+
+	h.logger.Warn("hedge_open",
+		zap.String("account", b.accountID),
+		zap.String("symbol", b.symbol),
+		zap.String("basket_side", string(b.side)),
+		zap.String("stage", string(target)),
+		zap.Float64("loss_pips", lossPips),
+		zap.Float64("basket_volume", volume),
+		zap.Float64("hedge_volume", delta),
+	)
+
+	return []model.Command{{
+		Type:      model.CommandOpen,
+		Symbol:    b.symbol,
+		Side:      side,
+		Volume:    delta,
+		Price:     price,
+		Magic:     h.hedgeMagic(b.side),
+		AccountID: b.accountID,
+		Reason:    reason,
+		Time:      now,
+	}}
+}
+
+// stageVolume returns the hedge volume a stage calls for on a basket of
+// volume.
+func (h *HedgeEngine) stageVolume(stage HedgeStage, volume float64) float64 {
+	ratio := 1.0
+	if stage == HedgePartial {
+		ratio = h.cfg.PartialRatio
+	}
+	return math.Round(volume*ratio*100) / 100
+}
+
+// hedgeStageFor returns the stage a hedge of hedgeVol gives a basket of
+// volume.
+func hedgeStageFor(hedgeVol, volume float64) HedgeStage {
+	switch {
+	case hedgeVol < 0.005:
+		return HedgeNone
+	case hedgeVol >= volume-0.005:
+		return HedgeLocked
+	}
+	return HedgePartial
+}
+
+// buildHedgeClose creates close commands for hedge positions.
+func (h *HedgeEngine) buildHedgeClose(hedges []model.Position, reason string, at time.Time) []model.Command {
+	cmds := make([]model.Command, 0, len(hedges))
+	for _, pos := range hedges {
+		cmds = append(cmds, model.Command{
+			Type:      model.CommandClose,
+			Symbol:    pos.Symbol,
+			Side:      pos.Side,
+			Ticket:    pos.ID,
+			Volume:    pos.Volume,
+			AccountID: pos.AccountID,
+			Reason:    reason,
+			Time:      at,
+		})
+	}
+	return cmds
+}
+
+// buildHedgeTrim closes excess volume of hedge legs, newest leg first:
+// whole legs while the excess covers them, the remainder partially.
+func (h *HedgeEngine) buildHedgeTrim(hedges []model.Position, excess float64, at time.Time) []model.Command {
+	legs := append([]model.Position(nil), hedges...)
+	sort.Slice(legs, func(i, j int) bool { return legs[i].ID > legs[j].ID })
+	var cmds []model.Command
+	for _, pos := range legs {
+		if excess < 0.01 {
+			break
+		}
+		cmd := model.Command{
+			Type:      model.CommandClose,
+			Symbol:    pos.Symbol,
+			Side:      pos.Side,
+			Ticket:    pos.ID,
+			Volume:    pos.Volume,
+			AccountID: pos.AccountID,
+			Reason:    "HEDGE_TRIM",
+			Time:      at,
+		}
+		if pos.Volume > excess+0.005 {
+			cmd.Type = model.CommandPartialClose
+			cmd.Volume = excess
+		}
+		cmds = append(cmds, cmd)
+		excess = math.Round((excess-cmd.Volume)*100) / 100
+	}
+	return cmds
+}
+
+// States returns the current state of all tracked baskets.
+func (h *HedgeEngine) States() []HedgeState {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	out := make([]HedgeState, 0, len(h.baskets))
+	for _, b := range h.baskets {
+		out = append(out, HedgeState{
+			AccountID:   b.accountID,
+			Symbol:      b.symbol,
+			Side:        b.side,
+			Stage:       b.stage,
+			LossPips:    b.lossPips,
+			Volume:      b.volume,
+			HedgeVolume: b.hedgeVol,
+		})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].AccountID != out[j].AccountID {
+			return out[i].AccountID < out[j].AccountID
+		}
+		if out[i].Symbol != out[j].Symbol {
+			return out[i].Symbol < out[j].Symbol
+		}
+		return out[i].Side < out[j].Side
+	})
+	return out
+}
+
+// basketExposure returns the total volume and volume-weighted entry price.
+func basketExposure(positions []model.Position) (float64, float64) {
+	volume := 0.0
+	weighted := 0.0
+	for _, pos := range positions {
+		volume += pos.Volume
+		weighted += pos.Volume * pos.Price
+	}
+	if volume == 0 {
+		return 0, 0
+	}
+	return math.Round(volume*100) / 100, weighted / volume
+}
+
+// hedgeStageRank orders hedge stages for comparison.
+func hedgeStageRank(stage HedgeStage) int {
+	switch stage {
+	case HedgePartial:
+		return 1
+	case HedgeLocked:
+		return 2
+	default:
+		return 0
+	}
+}
+
+// oppositeSide returns the other trading direction.
+func oppositeSide(side model.Side) model.Side {
+	if side == model.SideBuy {
+		return model.SideSell
+	}
+	return model.SideBuy
+}
@@ -0,0 +1,406 @@
+package engine
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go-trade/internal/config"
+	"go-trade/internal/model"
+
+	"go.uber.org/zap"
+)
+
+// Override limits.
+const (
+	overrideMaxTTL     = 30 * 24 * time.Hour
+	overrideHistoryCap = 500
+)
+
+// Override audit actions.
+const (
+	OverrideCreated = "CREATED"
+	OverrideUpdated = "UPDATED"
+	OverrideRemoved = "REMOVED"
+	OverrideExpired = "EXPIRED"
+)
+
+// Override errors.
+var (
+	ErrOverrideNotFound = errors.New("override not found")
+	ErrInvalidOverride  = errors.New("invalid override")
+)
+
+// OverrideUpdate holds the mutable fields of an override. Nil fields are
+// left unchanged.
+type OverrideUpdate struct {
+	ExpiresAt *time.Time
+	Reason    *string
+}
+
+// overrideFile is the on-disk layout of the registry.
+type overrideFile struct {
+	Overrides []model.Override      `json:"overrides"`
+	History   []model.OverrideEvent `json:"history"`
+}
+
+// OverrideRegistry holds active overrides and their audit trail, persisted
+// to a JSON file so interventions survive a restart.
+type OverrideRegistry struct {
+	path      string
+	mu        sync.RWMutex
+	overrides map[string]model.Override
+	history   []model.OverrideEvent
+	seq       int64
+}
+
+// OpenOverrideRegistry loads the registry at path. An empty path keeps it
+// in memory only. On a load error an empty registry is returned with the
+// error so the engine can still run.
+func OpenOverrideRegistry(path string) (*OverrideRegistry, error) {
+	r := &OverrideRegistry{path: path, overrides: make(map[string]model.Override)}
+	if path == "" {
+		return r, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return r, nil
+	}
+	if err != nil {
+		return r, fmt.Errorf("reading overrides: %w", err)
+	}
+	var f overrideFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return r, fmt.Errorf("parsing overrides %s: %w", path, err)
+	}
+	for _, o := range f.Overrides {
+		r.overrides[o.ID] = o
+	}
+	r.history = f.History
+	return r, nil
+}
+
+// Add stores a validated override and records it in the audit trail.
+func (r *OverrideRegistry) Add(o model.Override, now time.Time) (model.Override, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.seq++
+	o.ID = fmt.Sprintf("ovr_%d_%d", now.UnixNano(), r.seq)
+	o.CreatedAt = now
+	r.overrides[o.ID] = o
+	r.recordLocked(now, OverrideCreated, o.Author, o)
+	return o, r.saveLocked()
+}
+
+// Update changes the expiry or reason of an active override.
+func (r *OverrideRegistry) Update(id string, upd OverrideUpdate, actor string, now time.Time) (model.Override, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	o, ok := r.overrides[id]
+	if !ok || !now.Before(o.ExpiresAt) {
+		return model.Override{}, ErrOverrideNotFound
+	}
+	if upd.ExpiresAt != nil {
+		if err := validateExpiry(*upd.ExpiresAt, now); err != nil {
+			return model.Override{}, err
+		}
+		o.ExpiresAt = *upd.ExpiresAt
+	}
+	if upd.Reason != nil {
+		if strings.TrimSpace(*upd.Reason) == "" {
+			return model.Override{}, fmt.Errorf("%w: reason is required", ErrInvalidOverride)
+		}
+		o.Reason = strings.TrimSpace(*upd.Reason)
+	}
+	r.overrides[id] = o
+	r.recordLocked(now, OverrideUpdated, actor, o)
+	return o, r.saveLocked()
+}
+
+// Remove deletes an override before it expires.
+func (r *OverrideRegistry) Remove(id, actor string, now time.Time) (model.Override, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	o, ok := r.overrides[id]
+	if !ok {
+		return model.Override{}, ErrOverrideNotFound
+	}
+	delete(r.overrides, id)
+	r.recordLocked(now, OverrideRemoved, actor, o)
+	return o, r.saveLocked()
+}
+
+// Expire drops overrides whose expiry has passed and returns them.
+func (r *OverrideRegistry) Expire(now time.Time) ([]model.Override, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var expired []model.Override
+	for id, o := range r.overrides {
+		if !now.Before(o.ExpiresAt) {
+			delete(r.overrides, id)
+			r.recordLocked(now, OverrideExpired, "system", o)
+			expired = append(expired, o)
+		}
+	}
+	if len(expired) == 0 {
+		return nil, nil
+	}
+	return expired, r.saveLocked()
+}
+
+// Active returns unexpired overrides, soonest expiry first.
+func (r *OverrideRegistry) Active(now time.Time) []model.Override {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := make([]model.Override, 0, len(r.overrides))
+	for _, o := range r.overrides {
+		if now.Before(o.ExpiresAt) {
+			out = append(out, o)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ExpiresAt.Before(out[j].ExpiresAt) })
+	return out
+}
+
+// History returns the audit trail, newest first.
+func (r *OverrideRegistry) History() []model.OverrideEvent {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := make([]model.OverrideEvent, len(r.history))
+	for i, ev := range r.history {
+		out[len(r.history)-1-i] = ev
+	}
+	return out
+}
+
+// Match returns the most specific active override of a kind for an
+// account and symbol. Account matches outrank symbol matches; ties go to
+// the newest override.
+func (r *OverrideRegistry) Match(kind model.OverrideKind, accountID, symbol string, now time.Time) (model.Override, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var best model.Override
+	bestRank := -1
+	for _, o := range r.overrides {
+		if o.Kind != kind || !now.Before(o.ExpiresAt) ||
+			(o.AccountID != "" && o.AccountID != accountID) ||
+			(o.Symbol != "" && o.Symbol != symbol) {
+			continue
+		}
+		rank := 0
+		if o.AccountID != "" {
+			rank += 2
+		}
+		if o.Symbol != "" {
+			rank++
+		}
+		if rank > bestRank || (rank == bestRank && o.CreatedAt.After(best.CreatedAt)) {
+			best, bestRank = o, rank
+		}
+	}
+	return best, bestRank >= 0
+}
+
+// recordLocked appends an audit event, keeping the newest entries.
+func (r *OverrideRegistry) recordLocked(now time.Time, action, actor string, o model.Override) {
+	r.history = append(r.history, model.OverrideEvent{Time: now, Action: action, Actor: actor, Override: o})
+	if len(r.history) > overrideHistoryCap {
+		r.history = r.history[len(r.history)-overrideHistoryCap:]
+	}
+}
+
+// saveLocked writes the registry atomically.
+func (r *OverrideRegistry) saveLocked() error {
+	if r.path == "" {
+		return nil
+	}
+	f := overrideFile{
+		Overrides: make([]model.Override, 0, len(r.overrides)),
+		History:   r.history,
+	}
+	for _, o := range r.overrides {
+		f.Overrides = append(f.Overrides, o)
+	}
+	sort.Slice(f.Overrides, func(i, j int) bool { return f.Overrides[i].CreatedAt.Before(f.Overrides[j].CreatedAt) })
+
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding overrides: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(r.path), 0o755); err != nil {
+		return fmt.Errorf("creating data directory: %w", err)
+	}
+	tmp := r.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("writing overrides: %w", err)
+	}
+	if err := os.Rename(tmp, r.path); err != nil {
+		return fmt.Errorf("replacing overrides: %w", err)
+	}
+	return nil
+}
+
+// validateExpiry checks that an expiry lies in the future and within the
+// maximum override lifetime.
+func validateExpiry(expires, now time.Time) error {
+	if !expires.After(now) {
+		return fmt.Errorf("%w: expiresAt must be in the future", ErrInvalidOverride)
+	}
+	if expires.Sub(now) > overrideMaxTTL {
+		return fmt.Errorf("%w: expiresAt is more than %d days ahead", ErrInvalidOverride, int(overrideMaxTTL.Hours()/24))
+	}
+	return nil
+}
+
+// CreateOverride validates an override against the configuration and
+// stores it. Author, Reason and ExpiresAt are required.
+func (e *Engine) CreateOverride(o model.Override, now time.Time) (model.Override, error) {
+	o.Kind = model.OverrideKind(strings.ToUpper(string(o.Kind)))
+	o.Symbol = strings.ToUpper(strings.TrimSpace(o.Symbol))
+	o.AccountID = strings.TrimSpace(o.AccountID)
+	o.Value = strings.TrimSpace(o.Value)
+	o.Reason = strings.TrimSpace(o.Reason)
+	if err := e.validateOverride(&o); err != nil {
+		return model.Override{}, err
+	}
+	if err := validateExpiry(o.ExpiresAt, now); err != nil {
+		return model.Override{}, err
+	}
+
+	created, err := e.overrides.Add(o, now)
+	e.auditOverride(OverrideCreated, created.Author, created)
+	e.logger.Warn("override_created",
+		zap.String("id", created.ID),
+		zap.String("kind", string(created.Kind)),
+		zap.String("account", created.AccountID),
+		zap.String("symbol", created.Symbol),
+		zap.String("value", created.Value),
+		zap.String("author", created.Author),
+		zap.String("reason", created.Reason),
+		zap.Time("expires", created.ExpiresAt),
+	)
+	if err != nil {
+		e.logger.Error("override_save_failed", zap.Error(err))
+	}
+	return created, nil
+}
+
+// UpdateOverride extends, shortens or re-explains an active override.
+func (e *Engine) UpdateOverride(id string, upd OverrideUpdate, actor string, now time.Time) (model.Override, error) {
+	o, err := e.overrides.Update(id, upd, actor, now)
+	if errors.Is(err, ErrOverrideNotFound) || errors.Is(err, ErrInvalidOverride) {
+		return model.Override{}, err
+	}
+	e.auditOverride(OverrideUpdated, actor, o)
+	e.logger.Warn("override_updated",
+		zap.String("id", id),
+		zap.String("actor", actor),
+		zap.Time("expires", o.ExpiresAt),
+	)
+	if err != nil {
+		e.logger.Error("override_save_failed", zap.Error(err))
+	}
+	return o, nil
+}
+
+// RemoveOverride deletes an override before it expires.
+func (e *Engine) RemoveOverride(id, actor string, now time.Time) (model.Override, error) {
+	o, err := e.overrides.Remove(id, actor, now)
+	if errors.Is(err, ErrOverrideNotFound) {
+		return model.Override{}, err
+	}
+	e.auditOverride(OverrideRemoved, actor, o)
+	e.logger.Warn("override_removed",
+		zap.String("id", id),
+		zap.String("kind", string(o.Kind)),
+		zap.String("actor", actor),
+	)
+	if err != nil {
+		e.logger.Error("override_save_failed", zap.Error(err))
+	}
+	return o, nil
+}
+
+// Overrides returns the active overrides.
+func (e *Engine) Overrides() []model.Override {
+	return e.overrides.Active(time.Now())
+}
+
+// OverrideHistory returns the override audit trail, newest first.
+func (e *Engine) OverrideHistory() []model.OverrideEvent {
+	return e.overrides.History()
+}
+
+// expireOverrides drops overrides past their expiry.
+func (e *Engine) expireOverrides(now time.Time) {
+	expired, err := e.overrides.Expire(now)
+	for _, o := range expired {
+		e.auditOverride(OverrideExpired, "system", o)
+		e.logger.Info("override_expired",
+			zap.String("id", o.ID),
+			zap.String("kind", string(o.Kind)),
+			zap.String("account", o.AccountID),
+			zap.String("symbol", o.Symbol),
+		)
+	}
+	if err != nil {
+		e.logger.Error("override_save_failed", zap.Error(err))
+	}
+}
+
+// validateOverride checks the kind, value and required fields.
+func (e *Engine) validateOverride(o *model.Override) error {
+	if o.Reason == "" {
+		return fmt.Errorf("%w: reason is required", ErrInvalidOverride)
+	}
+	if o.Author == "" {
+		return fmt.Errorf("%w: author is required", ErrInvalidOverride)
+	}
+	switch o.Kind {
+	case model.OverridePreset:
+		for _, p := range e.fullCfg.Engine.Presets {
+			if p.Name == o.Value {
+				return nil
+			}
+		}
+		return fmt.Errorf("%w: unknown preset %q", ErrInvalidOverride, o.Value)
+	case model.OverrideDirection:
+		o.Value = strings.ToUpper(o.Value)
+		if o.Value != string(model.SideBuy) && o.Value != string(model.SideSell) {
+			return fmt.Errorf("%w: direction must be BUY or SELL", ErrInvalidOverride)
+		}
+	case model.OverrideDisableCascade:
+		o.Value = ""
+	case model.OverrideGuardLevel:
+		o.Value = strings.ToUpper(o.Value)
+		if o.Symbol != "" {
+			return fmt.Errorf("%w: guard level overrides apply to whole accounts", ErrInvalidOverride)
+		}
+		if e.guard.levelIndex(model.GuardLevel(o.Value)) < 0 {
+			return fmt.Errorf("%w: unknown guard level %q", ErrInvalidOverride, o.Value)
+		}
+	default:
+		return fmt.Errorf("%w: unknown kind %q", ErrInvalidOverride, o.Kind)
+	}
+	return nil
+}
+
+// symbolPreset returns the preset overridden for a symbol, or def.
+func (e *Engine) symbolPreset(accountID, symbol string, def *config.PresetConfig, now time.Time) *config.PresetConfig {
+	o, ok := e.overrides.Match(model.OverridePreset, accountID, symbol, now)
+	if !ok {
+		return def
+	}
+	for i := range e.fullCfg.Engine.Presets {
+		if e.fullCfg.Engine.Presets[i].Name == o.Value {
+			return &e.fullCfg.Engine.Presets[i]
+		}
+	}
+	return def
+}
@@ -0,0 +1,158 @@
+package engine
+
+import (
+	"math"
+	"time"
+
+	"go-trade/internal/model"
+
+	"go.uber.org/zap"
+)
+
+// partialCloseTimeout is how long a sent PARTIAL_CLOSE may go unconfirmed
+// by the EA's position feed before it is treated as rejected.
+const partialCloseTimeout = 10 * time.Second
+
+// partialClose is the in-flight part of a position's partial closes. The
+// EA reports positions before it processes commands, so the feed keeps
+// showing the old volume for at least one step after a send.
+type partialClose struct {
+	from   float64   // volume reported when the first close was sent
+	volume float64   // lots sent and not yet confirmed
+	sentAt time.Time // last send
+}
+
+// preparePartialClose resolves a PARTIAL_CLOSE command against the store:
+// a fraction is converted into lots, the volume is snapped down to the
+// broker lot step, and a remainder below the minimum lot turns the command
+// into a full close. Errors are *commandError values carrying the result
+// code.
+func (e *Engine) preparePartialClose(cmd model.Command) (model.Command, error) {
+	if cmd.Ticket <= 0 {
+		return cmd, commandErrorf(CodeNotFound, "partial close requires a ticket")
+	}
+	pos, ok := e.store.FindPosition(cmd.AccountID, cmd.Ticket)
+	if !ok {
+		return cmd, commandErrorf(CodeNotFound, "position %d not found", cmd.Ticket)
+	}
+	if pos.Pending {
+		return cmd, commandErrorf(CodeUnsupported, "position %d is a pending order", cmd.Ticket)
+	}
+
+	if inflight, ok := e.partials[feedKey{pos.AccountID, pos.ID}]; ok {
+		pos.Volume = math.Max(0, pos.Volume-inflight.volume)
+	}
+	if pos.Volume < e.fullCfg.Engine.MinLot-1e-9 {
+		return cmd, commandErrorf(CodeInvalidVolume, "position %d is already being closed", cmd.Ticket)
+	}
+
+	volume := cmd.Volume
+	if cmd.Fraction > 0 {
+		if cmd.Fraction > 1 {
+			return cmd, commandErrorf(CodeInvalidVolume, "fraction %.4f out of range (0-1]", cmd.Fraction)
+		}
+		volume = pos.Volume * cmd.Fraction
+	}
+	if volume <= 0 {
+		return cmd, commandErrorf(CodeInvalidVolume, "partial close requires volume or fraction")
+	}
+
+	step := e.fullCfg.Engine.LotStep
+	minLot := e.fullCfg.Engine.MinLot
+	volume = normalizeLot(math.Min(volume, pos.Volume), step)
+	if volume < minLot {
+		return cmd, commandErrorf(CodeInvalidVolume, "volume %.2f below minimum lot %.2f", volume, minLot)
+	}
+
+	cmd.Symbol = pos.Symbol
+	cmd.Side = pos.Side
+	cmd.AccountID = pos.AccountID
+	cmd.Fraction = 0
+	cmd.Volume = volume
+	if pos.Volume-volume < minLot-1e-9 {
+		// Remainder would be untradeable: close the whole position
+		cmd.Type = model.CommandClose
+		cmd.Volume = pos.Volume
+	}
+	return cmd, nil
+}
+
+// trackPartial records a sent partial close of pos and returns the volume
+// left once every in-flight close is applied. Runs on the engine
+// goroutine.
+func (e *Engine) trackPartial(pos model.Position, volume float64, now time.Time) float64 {
+	key := feedKey{pos.AccountID, pos.ID}
+	p, ok := e.partials[key]
+	if !ok {
+		p.from = pos.Volume
+	}
+	p.volume = math.Round((p.volume+volume)*1e8) / 1e8
+	p.sentAt = now
+	e.partials[key] = p
+	return math.Max(0, math.Round((p.from-p.volume)*1e8)/1e8)
+}
+
+// settlePartials drops in-flight partial closes the feed now confirms,
+// and expires the ones the EA never applied. Runs on the engine goroutine
+// after trackClosures.
+func (e *Engine) settlePartials(positions []model.Position, now time.Time) {
+	for _, pos := range positions {
+		key := feedKey{pos.AccountID, pos.ID}
+		p, ok := e.partials[key]
+		if !ok || pos.Volume >= p.from-1e-6 {
+			continue
+		}
+		p.volume = math.Round((p.volume-(p.from-pos.Volume))*1e8) / 1e8
+		p.from = pos.Volume
+		if p.volume < 1e-6 {
+			delete(e.partials, key)
+			continue
+		}
+		e.partials[key] = p
+	}
+	for key, p := range e.partials {
+		if _, open := e.feed[key]; !open {
+			delete(e.partials, key)
+			continue
+		}
+		if now.Sub(p.sentAt) >= partialCloseTimeout {
+			delete(e.partials, key)
+			e.logger.Warn("partial_close_unconfirmed",
+				zap.String("account", key.accountID),
+				zap.Int64("ticket", key.ticket),
+				zap.Float64("volume", p.volume),
+			)
+		}
+	}
+}
+
+// netOfPartials returns positions with their in-flight partial closes
+// subtracted from volume and, pro rata, from P&L; positions left below
+// the minimum lot are dropped.
+func (e *Engine) netOfPartials(positions []model.Position) []model.Position {
+	if len(e.partials) == 0 {
+		return positions
+	}
+	out := make([]model.Position, 0, len(positions))
+	for _, pos := range positions {
+		if p, ok := e.partials[feedKey{pos.AccountID, pos.ID}]; ok {
+			volume := math.Round((pos.Volume-p.volume)*1e8) / 1e8
+			if volume < e.fullCfg.Engine.MinLot-1e-9 {
+				continue
+			}
+			pos.ProfitLoss *= volume / pos.Volume
+			pos.Volume = volume
+		}
+		out = append(out, pos)
+	}
+	return out
+}
+
+// normalizeLot rounds a volume down to the broker lot step.
+func normalizeLot(volume, step float64) float64 {
+	if step <= 0 {
+		step = 0.01
+	}
+	lots := math.Floor(volume/step+1e-9) * step
+	return math.Round(lots*1e8) / 1e8
+}
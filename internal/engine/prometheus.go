@@ -0,0 +1,146 @@
+package engine
+
+import (
+	"sort"
+	"time"
+
+	"go-trade/internal/metrics"
+	"go-trade/internal/model"
+)
+
+// stepBuckets are the step duration histogram bounds in seconds, around
+// the 50ms step interval.
+var stepBuckets = []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1}
+
+// maxReasonLabels caps distinct reason label values; API comments are
+// free text, so later reasons are counted as "other".
+const maxReasonLabels = 200
+
+// commandKey labels the command counter.
+type commandKey struct {
+	typ    model.CommandType
+	reason string
+}
+
+// countCommand increments the per type/reason counter. Caller holds e.mu.
+func (e *Engine) countCommand(cmd model.Command) {
+	key := commandKey{typ: cmd.Type, reason: cmd.Reason}
+	if _, ok := e.cmdCounts[key]; !ok && len(e.cmdCounts) >= maxReasonLabels {
+		key.reason = "other"
+	}
+	e.cmdCounts[key]++
+}
+
+// observeStep records how long one loop iteration took.
+func (e *Engine) observeStep(start time.Time) {
+	now := time.Now()
+	e.stepHist.Observe(now.Sub(start).Seconds())
+	e.mu.Lock()
+	e.metrics.LastStepAt = now
+	e.mu.Unlock()
+}
+
+// WritePrometheus writes the engine metric families.
+func (e *Engine) WritePrometheus(w *metrics.Writer) {
+	now := time.Now()
+	snapshot := e.store.Snapshot()
+
+	e.mu.Lock()
+	m := e.metrics
+	cmdSamples := make([]metrics.Sample, 0, len(e.cmdCounts))
+	for k, n := range e.cmdCounts {
+		cmdSamples = append(cmdSamples, metrics.Sample{
+			Labels: metrics.L("type", string(k.typ), "reason", k.reason),
+			Value:  float64(n),
+		})
+	}
+	rejectSamples := make([]metrics.Sample, 0, len(e.rejects))
+	for code, n := range e.rejects {
+		rejectSamples = append(rejectSamples, metrics.Sample{Labels: metrics.L("code", code), Value: float64(n)})
+	}
+	guardSamples := make([]metrics.Sample, 0, len(e.guardLevels))
+	for acct, lvl := range e.guardLevels {
+		guardSamples = append(guardSamples, metrics.Sample{
+			Labels: metrics.L("account", acct, "level", string(lvl)),
+			Value:  float64(e.guard.levelIndex(lvl)),
+		})
+	}
+	e.mu.Unlock()
+	sortSamples(cmdSamples)
+	sortSamples(rejectSamples)
+	sortSamples(guardSamples)
+
+	w.Gauge("hayalet_up", "Whether the engine is running.", metrics.Sample{Value: 1})
+	w.Gauge("hayalet_uptime_seconds", "Seconds since the engine started.",
+		metrics.Sample{Value: now.Sub(e.started).Seconds()})
+	w.Gauge("hayalet_bridge_mode", "Active bridge IPC mode.",
+		metrics.Sample{Labels: metrics.L("mode", string(e.bridge.Mode())), Value: 1})
+	w.Gauge("hayalet_bridge_lag_seconds", "Receive time minus timestamp of the newest tick read from the bridge.",
+		metrics.Sample{Value: m.BridgeLagMs / 1000})
+	if !m.LastStepAt.IsZero() {
+		w.Gauge("hayalet_last_step_age_seconds", "Seconds since the engine loop last completed a step.",
+			metrics.Sample{Value: now.Sub(m.LastStepAt).Seconds()})
+	}
+	w.Histogram("hayalet_step_duration_seconds", "Duration of one engine loop step.", e.stepHist.Snapshot())
+
+	w.Counter("hayalet_ticks_total", "Ticks read from the bridge.", metrics.Sample{Value: float64(m.TickCount)})
+	w.Counter("hayalet_position_updates_total", "Position records read from the bridge.",
+		metrics.Sample{Value: float64(m.PositionCount)})
+	w.Counter("hayalet_commands_total", "Commands dispatched, by type and reason.", cmdSamples...)
+	w.Counter("hayalet_commands_rejected_total", "API commands rejected by engine checks, by code.", rejectSamples...)
+	w.Counter("hayalet_commands_failed_total", "Commands the bridge did not accept.",
+		metrics.Sample{Value: float64(m.CommandFailed)})
+	w.Counter("hayalet_signals_total", "Signals received.", metrics.Sample{Value: float64(m.SignalCount)})
+	w.Counter("hayalet_signals_dropped_total", "Signals dropped because the queue was full.",
+		metrics.Sample{Value: float64(m.SignalDropped)})
+	w.Counter("hayalet_signals_duplicate_total", "Signals ignored as duplicates.",
+		metrics.Sample{Value: float64(m.SignalDuplicate)})
+
+	w.Gauge("hayalet_guard_level", "Balance Guard level per account (index into the configured levels).", guardSamples...)
+
+	var equity, balance, drawdown []metrics.Sample
+	for _, acct := range snapshot.Accounts {
+		labels := metrics.L("account", acct.AccountID)
+		equity = append(equity, metrics.Sample{Labels: labels, Value: acct.Equity})
+		balance = append(balance, metrics.Sample{Labels: labels, Value: acct.Balance})
+		drawdown = append(drawdown, metrics.Sample{Labels: labels, Value: acct.DrawdownPct})
+	}
+	sortSamples(equity)
+	sortSamples(balance)
+	sortSamples(drawdown)
+	w.Gauge("hayalet_account_equity", "Account equity.", equity...)
+	w.Gauge("hayalet_account_balance", "Account balance.", balance...)
+	w.Gauge("hayalet_account_drawdown_percent", "Drawdown from peak equity in percent.", drawdown...)
+
+	counts := make(map[string]int)
+	lots := make(map[string]float64)
+	for _, pos := range snapshot.Positions {
+		if pos.Pending {
+			continue
+		}
+		counts[pos.Symbol]++
+		lots[pos.Symbol] += pos.Volume
+	}
+	var open, volume []metrics.Sample
+	for sym, n := range counts {
+		labels := metrics.L("symbol", sym)
+		open = append(open, metrics.Sample{Labels: labels, Value: float64(n)})
+		volume = append(volume, metrics.Sample{Labels: labels, Value: lots[sym]})
+	}
+	sortSamples(open)
+	sortSamples(volume)
+	w.Gauge("hayalet_open_positions", "Open positions per symbol.", open...)
+	w.Gauge("hayalet_open_volume_lots", "Open volume per symbol in lots.", volume...)
+}
+
+// sortSamples orders samples by their label values so output is stable.
+func sortSamples(samples []metrics.Sample) {
+	key := func(s metrics.Sample) string {
+		var k string
+		for _, l := range s.Labels {
+			k += l.Value + "\x00"
+		}
+		return k
+	}
+	sort.Slice(samples, func(i, j int) bool { return key(samples[i]) < key(samples[j]) })
+}
@@ -0,0 +1,263 @@
+package engine
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"go-trade/internal/model"
+)
+
+// ErrDuplicateSignal is returned when a signal ID has already been received.
+var ErrDuplicateSignal = errors.New("duplicate signal id")
+
+// ErrSignalQueueFull is returned when a signal is dropped because both the
+// signal channel and the overflow buffer are full.
+var ErrSignalQueueFull = errors.New("signal queue full")
+
+// signalOverflowCap bounds the in-memory overflow buffer used when the
+// signal channel is full.
+const signalOverflowCap = 10000
+
+// journalCompactEvery is the number of done records after which the
+// journal is rewritten with only unprocessed signals.
+const journalCompactEvery = 1000
+
+// journalSeenCap bounds how many signal IDs are remembered for dedupe.
+// Compaction keeps done records for this many IDs.
+const journalSeenCap = 4096
+
+// journalRecord is a single line of the signal journal.
+type journalRecord struct {
+	Op     string        `json:"op"` // push | done
+	ID     string        `json:"id"`
+	Signal *model.Signal `json:"signal,omitempty"`
+}
+
+// SignalJournal is an append-only JSONL log of received signals and their
+// completion. Signals pushed but never marked done are replayed after a
+// restart. It also remembers every ID it has seen for deduplication.
+type SignalJournal struct {
+	mu      sync.Mutex
+	path    string
+	file    *os.File
+	pending map[string]model.Signal // pushed, not yet done
+	order   []string                // push order of pending IDs
+	seen    map[string]bool
+	seenIDs []string // seen IDs, oldest first
+	done    int      // done records since last compaction
+}
+
+// OpenSignalJournal opens (or creates) the journal and loads its state.
+// The file is compacted on open so only unprocessed signals remain.
+func OpenSignalJournal(path string) (*SignalJournal, error) {
+	j := &SignalJournal{
+		path:    path,
+		pending: make(map[string]model.Signal),
+		seen:    make(map[string]bool),
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("creating data directory: %w", err)
+	}
+	if err := j.load(); err != nil {
+		return nil, err
+	}
+	if err := j.compact(); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+// Pending returns unprocessed signals in the order they were received.
+func (j *SignalJournal) Pending() []model.Signal {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	out := make([]model.Signal, 0, len(j.order))
+	for _, id := range j.order {
+		if sig, ok := j.pending[id]; ok {
+			out = append(out, sig)
+		}
+	}
+	return out
+}
+
+// Append records a received signal. It returns ErrDuplicateSignal when
+// the ID was seen before.
+func (j *SignalJournal) Append(sig model.Signal) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.seen[sig.ID] {
+		return ErrDuplicateSignal
+	}
+	if err := j.write(journalRecord{Op: "push", ID: sig.ID, Signal: &sig}); err != nil {
+		return err
+	}
+	j.markSeen(sig.ID)
+	j.pending[sig.ID] = sig
+	j.order = append(j.order, sig.ID)
+	return nil
+}
+
+// MarkDone records that a signal reached a terminal state.
+func (j *SignalJournal) MarkDone(id string) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if _, ok := j.pending[id]; !ok {
+		return nil
+	}
+	if err := j.write(journalRecord{Op: "done", ID: id}); err != nil {
+		return err
+	}
+	delete(j.pending, id)
+	j.done++
+	if j.done >= journalCompactEvery {
+		return j.compactLocked()
+	}
+	return nil
+}
+
+// Close closes the journal file.
+func (j *SignalJournal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.file == nil {
+		return nil
+	}
+	err := j.file.Close()
+	j.file = nil
+	return err
+}
+
+// markSeen remembers an ID for dedupe, forgetting the oldest processed
+// IDs beyond journalSeenCap. Caller must hold j.mu.
+func (j *SignalJournal) markSeen(id string) {
+	if j.seen[id] {
+		return
+	}
+	j.seen[id] = true
+	j.seenIDs = append(j.seenIDs, id)
+	for len(j.seenIDs) > journalSeenCap {
+		old := j.seenIDs[0]
+		if _, pending := j.pending[old]; pending {
+			break
+		}
+		delete(j.seen, old)
+		j.seenIDs = j.seenIDs[1:]
+	}
+}
+
+// write appends one record and syncs it to disk. Caller must hold j.mu.
+func (j *SignalJournal) write(rec journalRecord) error {
+	if j.file == nil {
+		return fmt.Errorf("signal journal %s is closed", j.path)
+	}
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("encoding journal record: %w", err)
+	}
+	if _, err := j.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("writing signal journal: %w", err)
+	}
+	return j.file.Sync()
+}
+
+// load replays the journal file into memory. Corrupt lines (for example a
+// torn final write) are skipped.
+func (j *SignalJournal) load() error {
+	f, err := os.Open(j.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("opening signal journal: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1<<20)
+	for scanner.Scan() {
+		var rec journalRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil || rec.ID == "" {
+			continue
+		}
+		switch rec.Op {
+		case "push":
+			if rec.Signal == nil || j.seen[rec.ID] {
+				continue
+			}
+			j.pending[rec.ID] = *rec.Signal
+			j.order = append(j.order, rec.ID)
+			j.markSeen(rec.ID)
+		case "done":
+			delete(j.pending, rec.ID)
+			j.markSeen(rec.ID)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("reading signal journal: %w", err)
+	}
+	return nil
+}
+
+// compact rewrites the journal with only pending signals and the done
+// records still needed for dedupe.
+func (j *SignalJournal) compact() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.compactLocked()
+}
+
+// compactLocked rewrites the journal atomically. Caller must hold j.mu.
+func (j *SignalJournal) compactLocked() error {
+	if j.file != nil {
+		j.file.Close()
+		j.file = nil
+	}
+
+	tmp := j.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("compacting signal journal: %w", err)
+	}
+	for _, id := range j.seenIDs {
+		if _, pending := j.pending[id]; pending {
+			continue
+		}
+		line, _ := json.Marshal(journalRecord{Op: "done", ID: id})
+		f.Write(append(line, '\n'))
+	}
+	order := j.order[:0]
+	for _, id := range j.order {
+		sig, ok := j.pending[id]
+		if !ok {
+			continue
+		}
+		order = append(order, id)
+		line, err := json.Marshal(journalRecord{Op: "push", ID: id, Signal: &sig})
+		if err != nil {
+			f.Close()
+			return fmt.Errorf("encoding journal record: %w", err)
+		}
+		f.Write(append(line, '\n'))
+	}
+	j.order = order
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("syncing signal journal: %w", err)
+	}
+	f.Close()
+	if err := os.Rename(tmp, j.path); err != nil {
+		return fmt.Errorf("replacing signal journal: %w", err)
+	}
+
+	j.file, err = os.OpenFile(j.path, os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("reopening signal journal: %w", err)
+	}
+	j.done = 0
+	return nil
+}
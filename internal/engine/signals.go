@@ -0,0 +1,495 @@
+package engine
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"go-trade/internal/config"
+	"go-trade/internal/model"
+
+	"go.uber.org/zap"
+)
+
+// SignalResult reports the outcome of processing a queued signal.
+type SignalResult struct {
+	ID     string
+	Status model.SignalStatus
+	Note   string
+}
+
+// pendingSignal is a queued signal with the accounts it has executed on.
+type pendingSignal struct {
+	sig  model.Signal
+	done map[string]bool // accountID -> executed
+}
+
+// signalDirection is a signal-driven grid direction override.
+type signalDirection struct {
+	side  model.Side
+	until time.Time
+}
+
+// SignalProcessor turns external signals into orders in the signal magic
+// range (6000-6999). It applies per-source lot sizing and score thresholds,
+// resolves conflicting signals, expires stale ones, tracks per-source
+// performance and can override the scoring direction of the grid.
+type SignalProcessor struct {
+	mu         sync.Mutex
+	cfg        config.SignalConfig
+	sources    map[string]config.SignalSourceConfig
+	pending    []*pendingSignal
+	recent     map[string][]model.Signal  // key: accountID|symbol, accepted OPEN signals
+	directions map[string]signalDirection // key: accountID|symbol
+	stats      map[string]*SignalSourceStats
+	magicSrc   map[int]signalMagic // magic -> source that opened it
+	realized   map[int64]float64   // ticket -> P&L of partial closes so far
+	disabled   map[string]string   // source -> auto/manual disable reason
+	nextMagic  int
+	lotStep    float64 // broker lot step
+	minLot     float64 // broker minimum lot
+	logger     *zap.Logger
+}
+
+// NewSignalProcessor creates a signal processor from configuration.
+func NewSignalProcessor(cfg config.SignalConfig, logger *zap.Logger) *SignalProcessor {
+	sources := make(map[string]config.SignalSourceConfig, len(cfg.Sources))
+	for _, src := range cfg.Sources {
+		sources[src.Name] = src
+	}
+	return &SignalProcessor{
+		cfg:        cfg,
+		sources:    sources,
+		recent:     make(map[string][]model.Signal),
+		directions: make(map[string]signalDirection),
+		stats:      make(map[string]*SignalSourceStats),
+		magicSrc:   make(map[int]signalMagic),
+		realized:   make(map[int64]float64),
+		disabled:   make(map[string]string),
+		nextMagic:  cfg.MagicRangeStart,
+		lotStep:    0.01,
+		minLot:     0.01,
+		logger:     logger,
+	}
+}
+
+// SetLotLimits sets the broker lot step and minimum lot signal orders are
+// sized to.
+func (p *SignalProcessor) SetLotLimits(step, minLot float64) {
+	if step > 0 {
+		p.lotStep = step
+	}
+	if minLot > 0 {
+		p.minLot = minLot
+	}
+}
+
+// IsSignalMagic reports whether a magic number belongs to the signal range.
+func (p *SignalProcessor) IsSignalMagic(magic int) bool {
+	return magic >= p.cfg.MagicRangeStart && magic <= p.cfg.MagicRangeEnd
+}
+
+// Submit validates a signal, resolves conflicts with recent opposing
+// signals and queues it for execution. The first result always describes
+// the submitted signal; further results describe pending signals that were
+// cancelled by conflict resolution.
+func (p *SignalProcessor) Submit(sig model.Signal, now time.Time) []SignalResult {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	st := p.sourceStats(sig.Source)
+	st.Received++
+	st.LastSignalAt = now
+
+	results, ok := p.admit(sig, now)
+	if !ok {
+		st.Rejected++
+	}
+	return results
+}
+
+// admit performs validation and conflict resolution, returning the result
+// for sig first. Caller must hold p.mu.
+func (p *SignalProcessor) admit(sig model.Signal, now time.Time) ([]SignalResult, bool) {
+	reject := func(note string) ([]SignalResult, bool) {
+		return []SignalResult{{ID: sig.ID, Status: model.SignalRejected, Note: note}}, false
+	}
+	if !p.cfg.Enable {
+		return reject("signal execution disabled")
+	}
+
+	src := p.source(sig.Source)
+	if src.Disabled {
+		return reject("source disabled")
+	}
+	if reason, ok := p.disabled[sig.Source]; ok {
+		return reject("source disabled: " + reason)
+	}
+
+	// Derive side from score for score-only signals
+	if sig.Side == "" && sig.Action != model.CommandClose && sig.Score != 0 {
+		sig.Side = model.SideBuy
+		if sig.Score < 0 {
+			sig.Side = model.SideSell
+		}
+	}
+	if sig.Action == "" && sig.Side != "" {
+		sig.Action = model.CommandOpen
+	}
+	if sig.Action != model.CommandOpen && sig.Action != model.CommandClose {
+		return reject(fmt.Sprintf("unsupported action %q", sig.Action))
+	}
+
+	// Score threshold only applies to scored signals
+	minScore := p.cfg.MinScore
+	if src.MinScore > 0 {
+		minScore = src.MinScore
+	}
+	if sig.Action == model.CommandOpen && sig.Score != 0 && math.Abs(sig.Score) < minScore {
+		return reject(fmt.Sprintf("score %.1f below %.1f", sig.Score, minScore))
+	}
+
+	if sig.Time.IsZero() {
+		sig.Time = now
+	}
+
+	var cancelled []SignalResult
+	if sig.Action == model.CommandOpen {
+		var note string
+		var ok bool
+		cancelled, note, ok = p.resolveConflict(sig, now)
+		if !ok {
+			res, _ := reject(note)
+			return append(res, cancelled...), false
+		}
+	}
+
+	if p.cfg.OverrideDirection && sig.Action == model.CommandOpen {
+		p.directions[sig.AccountID+"|"+sig.Symbol] = signalDirection{
+			side:  sig.Side,
+			until: now.Add(time.Duration(p.cfg.DirectionTTLMinutes) * time.Minute),
+		}
+	}
+	p.pending = append(p.pending, &pendingSignal{sig: sig, done: make(map[string]bool)})
+	queued := SignalResult{ID: sig.ID, Status: model.SignalQueued}
+	return append([]SignalResult{queued}, cancelled...), true
+}
+
+// resolveConflict applies the configured conflict policy to an OPEN signal
+// against accepted OPEN signals for the same account+symbol within the
+// conflict window. It returns results for cancelled pending signals, a note
+// and whether the new signal may proceed. Caller must hold p.mu.
+func (p *SignalProcessor) resolveConflict(sig model.Signal, now time.Time) ([]SignalResult, string, bool) {
+	key := sig.AccountID + "|" + sig.Symbol
+	window := time.Duration(p.cfg.ConflictWindowSec) * time.Second
+
+	recent := p.recent[key][:0]
+	var opposing []model.Signal
+	for _, r := range p.recent[key] {
+		if now.Sub(r.Time) > window {
+			continue
+		}
+		recent = append(recent, r)
+		if r.Side != sig.Side {
+			opposing = append(opposing, r)
+		}
+	}
+	p.recent[key] = append(recent, sig)
+	if len(opposing) == 0 {
+		return nil, "", true
+	}
+
+	newSrc := p.source(sig.Source)
+	switch p.cfg.ConflictPolicy {
+	case "priority":
+		for _, o := range opposing {
+			if p.source(o.Source).Priority > newSrc.Priority {
+				p.dropRecent(key, sig.ID)
+				return nil, fmt.Sprintf("overridden by higher-priority source %s", o.Source), false
+			}
+		}
+		return p.cancelPending(opposing, "superseded by "+sig.Source), "", true
+	case "veto":
+		p.dropRecent(key, sig.ID)
+		cancelled := p.cancelPending(opposing, "vetoed by "+sig.Source)
+		return cancelled, fmt.Sprintf("vetoed by opposing source %s", opposing[0].Source), false
+	case "weighted":
+		vote := 0.0
+		for _, r := range p.recent[key] {
+			w := p.source(r.Source).Weight
+			if w <= 0 {
+				w = 1
+			}
+			strength := 1.0
+			if r.Score != 0 {
+				strength = math.Abs(r.Score) / 100
+			}
+			if r.Side == model.SideSell {
+				w = -w
+			}
+			vote += w * strength
+		}
+		if vote == 0 || (vote > 0) != (sig.Side == model.SideBuy) {
+			p.dropRecent(key, sig.ID)
+			return nil, fmt.Sprintf("outvoted (net vote %.2f)", vote), false
+		}
+		return p.cancelPending(opposing, "outvoted"), "", true
+	default: // latest
+		return p.cancelPending(opposing, "superseded by "+sig.Source), "", true
+	}
+}
+
+// dropRecent removes a signal from the conflict window. Caller must hold p.mu.
+func (p *SignalProcessor) dropRecent(key, id string) {
+	list := p.recent[key]
+	for i := range list {
+		if list[i].ID == id {
+			p.recent[key] = append(list[:i], list[i+1:]...)
+			return
+		}
+	}
+}
+
+// cancelPending removes still-pending signals and reports them as rejected.
+// Signals that already executed on some account are dropped silently.
+// Caller must hold p.mu.
+func (p *SignalProcessor) cancelPending(signals []model.Signal, note string) []SignalResult {
+	ids := make(map[string]bool, len(signals))
+	for _, s := range signals {
+		ids[s.ID] = true
+	}
+	var results []SignalResult
+	kept := p.pending[:0]
+	for _, ps := range p.pending {
+		if !ids[ps.sig.ID] {
+			kept = append(kept, ps)
+			continue
+		}
+		if len(ps.done) == 0 {
+			p.sourceStats(ps.sig.Source).Rejected++
+			results = append(results, SignalResult{ID: ps.sig.ID, Status: model.SignalRejected, Note: note})
+		}
+	}
+	p.pending = kept
+	return results
+}
+
+// Direction returns the signal-driven direction for an account+symbol, if
+// one is active. Signals without an account apply to every account.
+func (p *SignalProcessor) Direction(accountID, symbol string, now time.Time) (model.Side, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, key := range []string{accountID + "|" + symbol, "|" + symbol} {
+		if d, ok := p.directions[key]; ok {
+			if now.After(d.until) {
+				delete(p.directions, key)
+				continue
+			}
+			return d.side, true
+		}
+	}
+	return "", false
+}
+
+// Execute turns pending signals targeting the account into commands.
+// Signals with an empty AccountID execute once on every account.
+func (p *SignalProcessor) Execute(
+	accountID string,
+	positions []model.Position,
+	quotes map[string]SymbolSnapshot,
+	guard GuardResult,
+	now time.Time,
+) ([]model.Command, []SignalResult) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var cmds []model.Command
+	var results []SignalResult
+	for _, ps := range p.pending {
+		sig := ps.sig
+		if ps.done[accountID] || (sig.AccountID != "" && sig.AccountID != accountID) {
+			continue
+		}
+		if p.expired(sig, now) {
+			continue
+		}
+
+		switch sig.Action {
+		case model.CommandOpen:
+			quote, ok := quotes[sig.Symbol]
+			if !ok || !quote.HasTick || quote.Bid <= 0 || quote.Ask <= 0 {
+				continue // wait for a quote until expiry
+			}
+			if guard.LotScale <= 0 {
+				ps.done[accountID] = true
+				results = append(results, SignalResult{ID: sig.ID, Status: model.SignalRejected, Note: "guard " + string(guard.Level)})
+				continue
+			}
+			lot := p.lotFor(sig.Source) * guard.LotScale
+			lot = normalizeLot(lot, p.lotStep)
+			if lot < p.minLot {
+				ps.done[accountID] = true
+				results = append(results, SignalResult{ID: sig.ID, Status: model.SignalRejected, Note: "lot below minimum"})
+				continue
+			}
+			price := quote.Ask
+			if sig.Side == model.SideSell {
+				price = quote.Bid
+			}
+			magic := p.allocateMagic(now)
+			p.magicSrc[magic] = signalMagic{source: sig.Source, sentAt: now}
+			cmds = append(cmds, model.Command{
+				Type:      model.CommandOpen,
+				Symbol:    sig.Symbol,
+				Side:      sig.Side,
+				Volume:    lot,
+				Price:     price,
+				Magic:     magic,
+				AccountID: accountID,
+				Reason:    "SIGNAL_" + sig.Source,
+				Time:      now,
+			})
+		case model.CommandClose:
+			for _, pos := range positions {
+				if pos.Pending || pos.Symbol != sig.Symbol || !p.IsSignalMagic(pos.Magic) {
+					continue
+				}
+				if sig.Side != "" && pos.Side != sig.Side {
+					continue
+				}
+				cmds = append(cmds, model.Command{
+					Type:      model.CommandClose,
+					Symbol:    pos.Symbol,
+					Side:      pos.Side,
+					Ticket:    pos.ID,
+					Volume:    pos.Volume,
+					Magic:     pos.Magic,
+					AccountID: accountID,
+					Reason:    "SIGNAL_CLOSE_" + sig.Source,
+					Time:      now,
+				})
+			}
+		}
+
+		if len(ps.done) == 0 {
+			p.sourceStats(sig.Source).Executed++
+		}
+		ps.done[accountID] = true
+		results = append(results, SignalResult{ID: sig.ID, Status: model.SignalExecuted, Note: "account " + accountID})
+		p.logger.Info("signal_executed",
+			zap.String("id", sig.ID),
+			zap.String("source", sig.Source),
+			zap.String("account", accountID),
+			zap.String("symbol", sig.Symbol),
+			zap.String("action", string(sig.Action)),
+			zap.String("side", string(sig.Side)),
+		)
+	}
+	return cmds, results
+}
+
+// Sweep drops signals that expired or have executed on every account they
+// target, reporting the ones that expired without executing anywhere.
+func (p *SignalProcessor) Sweep(accountIDs []string, now time.Time) []SignalResult {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var results []SignalResult
+	kept := p.pending[:0]
+	for _, ps := range p.pending {
+		if p.expired(ps.sig, now) {
+			if len(ps.done) == 0 {
+				p.sourceStats(ps.sig.Source).Expired++
+				results = append(results, SignalResult{ID: ps.sig.ID, Status: model.SignalExpired, Note: "not executed before expiry"})
+			}
+			continue
+		}
+		complete := ps.done[ps.sig.AccountID]
+		if ps.sig.AccountID == "" {
+			complete = len(accountIDs) > 0
+			for _, id := range accountIDs {
+				if !ps.done[id] {
+					complete = false
+					break
+				}
+			}
+		}
+		if complete {
+			continue
+		}
+		kept = append(kept, ps)
+	}
+	p.pending = kept
+	return results
+}
+
+// Pending returns the number of queued signals.
+func (p *SignalProcessor) Pending() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.pending)
+}
+
+// expired reports whether a signal is older than the configured expiry.
+func (p *SignalProcessor) expired(sig model.Signal, now time.Time) bool {
+	return p.cfg.ExpirySeconds > 0 && now.Sub(sig.Time) > time.Duration(p.cfg.ExpirySeconds)*time.Second
+}
+
+// source returns the settings for a signal source, or defaults.
+func (p *SignalProcessor) source(name string) config.SignalSourceConfig {
+	if src, ok := p.sources[name]; ok {
+		return src
+	}
+	return config.SignalSourceConfig{Name: name}
+}
+
+// lotFor returns the base lot for a signal source.
+func (p *SignalProcessor) lotFor(name string) float64 {
+	if src := p.source(name); src.Lot > 0 {
+		return src.Lot
+	}
+	return p.cfg.DefaultLot
+}
+
+// signalMagicHold is how long the magic of an OPEN that has not shown up
+// in the bridge feed stays reserved.
+const signalMagicHold = time.Minute
+
+// signalMagic records which source an allocated magic belongs to.
+type signalMagic struct {
+	source string
+	sentAt time.Time
+	open   bool // seen in the bridge feed
+}
+
+// allocateMagic returns the next magic number within the signal range,
+// skipping magics of open positions and of recent OPENs still in flight.
+// When every magic is taken the next one is reused.
+func (p *SignalProcessor) allocateMagic(now time.Time) int {
+	size := p.cfg.MagicRangeEnd - p.cfg.MagicRangeStart + 1
+	magic := p.nextMagic
+	for range size {
+		candidate := p.nextMagic
+		p.nextMagic++
+		if p.nextMagic > p.cfg.MagicRangeEnd {
+			p.nextMagic = p.cfg.MagicRangeStart
+		}
+		m, used := p.magicSrc[candidate]
+		if !used || (!m.open && now.Sub(m.sentAt) >= signalMagicHold) {
+			return candidate
+		}
+	}
+	return magic
+}
+
+// sortedAccountIDs returns the account IDs of a snapshot in stable order.
+func sortedAccountIDs(accounts []model.AccountState) []string {
+	ids := make([]string, 0, len(accounts))
+	for _, acct := range accounts {
+		ids = append(ids, acct.AccountID)
+	}
+	sort.Strings(ids)
+	return ids
+}
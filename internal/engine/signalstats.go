@@ -0,0 +1,177 @@
+package engine
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"go-trade/internal/model"
+
+	"go.uber.org/zap"
+)
+
+// SignalSourceStats holds signal counters and closed-trade performance for
+// one signal source.
+type SignalSourceStats struct {
+	Source         string    `json:"source"`
+	Received       int64     `json:"received"`
+	Executed       int64     `json:"executed"`
+	Rejected       int64     `json:"rejected"`
+	Expired        int64     `json:"expired"`
+	Trades         int       `json:"trades"`
+	Wins           int       `json:"wins"`
+	HitRate        float64   `json:"hitRate"`
+	TotalPL        float64   `json:"totalPl"`
+	AvgPL          float64   `json:"avgPl"`
+	PeakPL         float64   `json:"peakPl"`
+	MaxDrawdown    float64   `json:"maxDrawdown"`
+	Disabled       bool      `json:"disabled"`
+	DisabledReason string    `json:"disabledReason,omitempty"`
+	LastSignalAt   time.Time `json:"lastSignalAt"`
+}
+
+// sourceStats returns the stats entry for a source. Caller must hold p.mu.
+func (p *SignalProcessor) sourceStats(name string) *SignalSourceStats {
+	st, ok := p.stats[name]
+	if !ok {
+		st = &SignalSourceStats{Source: name}
+		p.stats[name] = st
+	}
+	return st
+}
+
+// RecordOpen marks the magic of a signal position seen in the bridge feed
+// as in use, so it is not handed out again while the position is open.
+func (p *SignalProcessor) RecordOpen(pos model.Position) {
+	if !p.IsSignalMagic(pos.Magic) {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if m, ok := p.magicSrc[pos.Magic]; ok {
+		m.open = true
+		p.magicSrc[pos.Magic] = m
+	}
+}
+
+// RecordReduce books the share of floating P&L realized when a signal
+// position's volume in the bridge feed drops to volume. It is added to
+// the trade when the position closes.
+func (p *SignalProcessor) RecordReduce(prev model.Position, volume float64) {
+	if !p.IsSignalMagic(prev.Magic) || prev.Volume <= 0 {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.realized[prev.ID] += prev.ProfitLoss * (prev.Volume - volume) / prev.Volume
+}
+
+// RecordClose books a signal position that left the bridge feed as one
+// trade of the source that opened it, at its last P&L plus any realized
+// partial closes, and frees its magic.
+func (p *SignalProcessor) RecordClose(pos model.Position) {
+	if !p.IsSignalMagic(pos.Magic) {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	source := "unknown"
+	if m, ok := p.magicSrc[pos.Magic]; ok {
+		source = m.source
+		delete(p.magicSrc, pos.Magic)
+	}
+	pl := pos.ProfitLoss + p.realized[pos.ID]
+	delete(p.realized, pos.ID)
+
+	st := p.sourceStats(source)
+	st.Trades++
+	if pl > 0 {
+		st.Wins++
+	}
+	st.TotalPL = math.Round((st.TotalPL+pl)*100) / 100
+	st.HitRate = float64(st.Wins) / float64(st.Trades)
+	st.AvgPL = math.Round(st.TotalPL/float64(st.Trades)*100) / 100
+	if st.TotalPL > st.PeakPL {
+		st.PeakPL = st.TotalPL
+	}
+	if dd := st.PeakPL - st.TotalPL; dd > st.MaxDrawdown {
+		st.MaxDrawdown = math.Round(dd*100) / 100
+	}
+
+	p.checkAutoDisable(st)
+}
+
+// checkAutoDisable switches a source off when its closed-trade record
+// breaks the configured thresholds. Caller must hold p.mu.
+func (p *SignalProcessor) checkAutoDisable(st *SignalSourceStats) {
+	rules := p.cfg.AutoDisable
+	if !rules.Enable || st.Disabled || st.Trades < rules.MinTrades {
+		return
+	}
+	reason := ""
+	switch {
+	case rules.MinHitRate > 0 && st.HitRate < rules.MinHitRate:
+		reason = fmt.Sprintf("hit rate %.2f below %.2f", st.HitRate, rules.MinHitRate)
+	case rules.MaxDrawdown > 0 && st.MaxDrawdown >= rules.MaxDrawdown:
+		reason = fmt.Sprintf("drawdown %.2f reached %.2f", st.MaxDrawdown, rules.MaxDrawdown)
+	}
+	if reason == "" {
+		return
+	}
+	st.Disabled = true
+	st.DisabledReason = reason
+	p.disabled[st.Source] = reason
+	p.logger.Warn("signal_source_auto_disabled",
+		zap.String("source", st.Source),
+		zap.String("reason", reason),
+		zap.Int("trades", st.Trades),
+	)
+}
+
+// SetSourceEnabled manually enables or disables a source. Re-enabling
+// resets the source's performance record so auto-disable starts afresh.
+func (p *SignalProcessor) SetSourceEnabled(name string, enabled bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	st := p.sourceStats(name)
+	if enabled {
+		delete(p.disabled, name)
+		*st = SignalSourceStats{
+			Source:       name,
+			Received:     st.Received,
+			Executed:     st.Executed,
+			Rejected:     st.Rejected,
+			Expired:      st.Expired,
+			LastSignalAt: st.LastSignalAt,
+		}
+		return
+	}
+	st.Disabled = true
+	st.DisabledReason = "disabled by operator"
+	p.disabled[name] = st.DisabledReason
+}
+
+// SourceStats returns the stats of every known source, including
+// configured sources that have not sent anything yet.
+func (p *SignalProcessor) SourceStats() []SignalSourceStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for name := range p.sources {
+		p.sourceStats(name)
+	}
+	out := make([]SignalSourceStats, 0, len(p.stats))
+	for _, st := range p.stats {
+		c := *st
+		if src, ok := p.sources[c.Source]; ok && src.Disabled {
+			c.Disabled = true
+			c.DisabledReason = "disabled in config"
+		}
+		out = append(out, c)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Source < out[j].Source
+	})
+	return out
+}
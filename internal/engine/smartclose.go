@@ -21,6 +21,8 @@ type SmartClose struct {
 	singleTP   float64 // single position TP ($)
 	groupTP    float64 // group TP ($)
 	portfolioTP float64 // portfolio TP ($)
+	lotStep    float64 // broker lot step for partial closes
+	minLot     float64 // broker minimum lot
 	logger     *zap.Logger
 }
 
@@ -34,10 +36,22 @@ func NewSmartClose(minPnL, minDD, maxSL float64, logger *zap.Logger) *SmartClose
 		singleTP:    0.50,
 		groupTP:     3.00,
 		portfolioTP: 5.00,
+		lotStep:     0.01,
+		minLot:      0.01,
 		logger:      logger,
 	}
 }
 
+// SetLotLimits sets the broker lot step and minimum lot used for partial closes.
+func (sc *SmartClose) SetLotLimits(step, minLot float64) {
+	if step > 0 {
+		sc.lotStep = step
+	}
+	if minLot > 0 {
+		sc.minLot = minLot
+	}
+}
+
 // SmartCloseResult holds the evaluation output.
 type SmartCloseResult struct {
 	ShouldClose bool
@@ -46,7 +60,9 @@ type SmartCloseResult struct {
 	Reason      string
 }
 
-// Evaluate checks if a smart close should be executed.
+// Evaluate checks if a smart close should be executed. positions must
+// hold only the positions smart close may close (grid and cascade); the
+// emergency and portfolio closes act on all of them.
 func (sc *SmartClose) Evaluate(
 	positions []model.Position,
 	acct model.AccountState,
@@ -77,16 +93,10 @@ func (sc *SmartClose) Evaluate(
 		return SmartCloseResult{}
 	}
 
-	// Find best group of profitable positions that can offset the worst
-	group := findBestGroup(positions, *worst, sc.minPnL)
-	if group == nil {
-		return SmartCloseResult{}
-	}
-
-	// Build close commands
-	var cmds []model.Command
-	// Close the worst position
-	cmds = append(cmds, model.Command{
+	// Find best group of profitable positions that can offset the worst.
+	// If they cannot offset all of it, close only the part of the worst
+	// position that the profitable group pays for.
+	worstCmd := model.Command{
 		Type:      model.CommandClose,
 		Symbol:    worst.Symbol,
 		Side:      worst.Side,
@@ -95,7 +105,23 @@ func (sc *SmartClose) Evaluate(
 		AccountID: acct.AccountID,
 		Reason:    "SMART_CLOSE_WORST",
 		Time:      time.Now(),
-	})
+	}
+	group := findBestGroup(positions, *worst, sc.minPnL)
+	if group == nil {
+		var partialLots float64
+		group, partialLots = sc.findPartialGroup(positions, *worst)
+		if group == nil {
+			return SmartCloseResult{}
+		}
+		worstCmd.Type = model.CommandPartialClose
+		worstCmd.Volume = partialLots
+		worstCmd.Reason = "SMART_CLOSE_PARTIAL"
+	}
+
+	// Build close commands
+	var cmds []model.Command
+	// Close the worst position (fully or partially)
+	cmds = append(cmds, worstCmd)
 
 	// Close the profitable group
 	for _, posID := range group.Positions {
@@ -118,7 +144,9 @@ func (sc *SmartClose) Evaluate(
 		zap.Float64("worst_pl", worst.ProfitLoss),
 		zap.Float64("group_pl", group.NetPL),
 		zap.Int("group_size", group.GroupSize),
-		zap.Float64("net_pl", group.NetPL+worst.ProfitLoss),
+		zap.Float64("net_pl", group.NetPL),
+		zap.String("worst_close", string(worstCmd.Type)),
+		zap.Float64("worst_volume", worstCmd.Volume),
 	)
 
 	return SmartCloseResult{
@@ -305,6 +333,42 @@ func findBestGroup(positions []model.Position, worst model.Position, minNetPL fl
 	return nil
 }
 
+// findPartialGroup takes every profitable position and sizes a partial close
+// of the worst position so that the combined net P&L stays at or above the
+// minimum threshold. Returns the group and the lots to close from the worst.
+func (sc *SmartClose) findPartialGroup(positions []model.Position, worst model.Position) (*model.SmartCloseGroup, float64) {
+	if worst.Volume <= 0 || worst.ProfitLoss >= 0 {
+		return nil, 0
+	}
+
+	groupPL := 0.0
+	var groupIDs []int64
+	for _, pos := range positions {
+		if pos.ID != worst.ID && !pos.Pending && pos.ProfitLoss > 0 {
+			groupPL += pos.ProfitLoss
+			groupIDs = append(groupIDs, pos.ID)
+		}
+	}
+	budget := groupPL - sc.minPnL
+	if len(groupIDs) == 0 || budget <= 0 {
+		return nil, 0
+	}
+
+	// Loss is assumed proportional to volume
+	fraction := budget / -worst.ProfitLoss
+	lots := normalizeLot(worst.Volume*fraction, sc.lotStep)
+	if lots < sc.minLot || lots >= worst.Volume {
+		return nil, 0
+	}
+
+	closedPL := worst.ProfitLoss * lots / worst.Volume
+	return &model.SmartCloseGroup{
+		Positions: groupIDs,
+		NetPL:     math.Round((groupPL+closedPL)*100) / 100,
+		GroupSize: len(groupIDs) + 1,
+	}, lots
+}
+
 // totalProfitLoss sums up P&L across all non-pending positions.
 func totalProfitLoss(positions []model.Position) float64 {
 	total := 0.0
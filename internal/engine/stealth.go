@@ -0,0 +1,471 @@
+package engine
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"go-trade/internal/config"
+	"go-trade/internal/model"
+
+	"go.uber.org/zap"
+)
+
+// stealthOpenTimeout is how long an OPEN may stay unconfirmed before the
+// symbol becomes eligible for a new entry again.
+const stealthOpenTimeout = 5 * time.Second
+
+// stealthCloseRetry is how long a CLOSE may go unconfirmed before the
+// position is evaluated for exit again, so a rejected close is retried.
+const stealthCloseRetry = 10 * time.Second
+
+// StealthParams holds the tunable entry/exit parameters of the stealth
+// scalper. Exits are managed by the engine (hidden TP/SL), never sent to
+// the broker.
+type StealthParams struct {
+	Window        int     `json:"window"`        // ticks used for microstructure features
+	ImbalanceMin  float64 `json:"imbalanceMin"`  // min |upticks-downticks|/moves (0-1)
+	MomentumPips  float64 `json:"momentumPips"`  // min mid-price move over the window
+	MaxSpreadPips float64 `json:"maxSpreadPips"` // skip entries when spread is wider
+	TPPips        float64 `json:"tpPips"`        // hidden take profit
+	SLPips        float64 `json:"slPips"`        // hidden stop loss
+}
+
+// DefaultStealthParams returns the baseline stealth parameters.
+func DefaultStealthParams() StealthParams {
+	return StealthParams{
+		Window:        30,
+		ImbalanceMin:  0.4,
+		MomentumPips:  1.5,
+		MaxSpreadPips: 2.0,
+		TPPips:        2.0,
+		SLPips:        4.0,
+	}
+}
+
+// StealthEngine is a short-horizon scalper driven by tick microstructure
+// (tick imbalance, short-window momentum and spread). It only trades inside
+// the configured stealth magic range and enforces hold time, per-trade and
+// per-day loss limits, and a cooldown after consecutive losses.
+type StealthEngine struct {
+	mu        sync.Mutex
+	cfg       config.StealthConfig
+	params    StealthParams
+	accounts  map[string]*stealthAccount
+	nextMagic int
+	lotStep   float64 // broker lot step
+	minLot    float64 // broker minimum lot
+	logger    *zap.Logger
+}
+
+// stealthAccount holds per-account stealth risk bookkeeping.
+type stealthAccount struct {
+	day          string
+	dailyPL      float64
+	consecLosses int
+	pausedUntil  time.Time
+	trades       int
+	wins         int
+	pendingOpen  map[string]time.Time // symbol -> OPEN sent at
+	closing      map[int64]time.Time  // ticket -> CLOSE sent at
+	openCount    int
+}
+
+// StealthState is a serializable view of the stealth engine per account.
+type StealthState struct {
+	AccountID         string    `json:"accountId"`
+	OpenPositions     int       `json:"openPositions"`
+	DailyPL           float64   `json:"dailyPl"`
+	ConsecutiveLosses int       `json:"consecutiveLosses"`
+	PausedUntil       time.Time `json:"pausedUntil"`
+	Trades            int       `json:"trades"`
+	Wins              int       `json:"wins"`
+}
+
+// NewStealthEngine creates a stealth engine from configuration.
+func NewStealthEngine(cfg config.StealthConfig, logger *zap.Logger) *StealthEngine {
+	return &StealthEngine{
+		cfg:       cfg,
+		params:    DefaultStealthParams(),
+		accounts:  make(map[string]*stealthAccount),
+		nextMagic: cfg.MagicRangeStart,
+		lotStep:   0.01,
+		minLot:    0.01,
+		logger:    logger,
+	}
+}
+
+// SetLotLimits sets the broker lot step and minimum lot entries are sized
+// to.
+func (s *StealthEngine) SetLotLimits(step, minLot float64) {
+	if step > 0 {
+		s.lotStep = step
+	}
+	if minLot > 0 {
+		s.minLot = minLot
+	}
+}
+
+// Params returns the active stealth parameters.
+func (s *StealthEngine) Params() StealthParams {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.params
+}
+
+// SetParams replaces the active stealth parameters.
+func (s *StealthEngine) SetParams(p StealthParams) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.params = p
+}
+
+// LosingStreak returns the longest current run of consecutive losses
+// across all accounts.
+func (s *StealthEngine) LosingStreak() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	streak := 0
+	for _, acct := range s.accounts {
+		if acct.consecLosses > streak {
+			streak = acct.consecLosses
+		}
+	}
+	return streak
+}
+
+// IsStealthMagic reports whether a magic number belongs to the stealth range.
+func (s *StealthEngine) IsStealthMagic(magic int) bool {
+	return magic >= s.cfg.MagicRangeStart && magic <= s.cfg.MagicRangeEnd
+}
+
+// Exits closes open stealth positions that reached their hidden TP/SL,
+// max hold time or max loss. It runs at every guard level and on paused
+// scopes, so those positions stay protected when risk is highest.
+func (s *StealthEngine) Exits(
+	accountID string,
+	positions []model.Position,
+	quotes map[string]SymbolSnapshot,
+	now time.Time,
+) []model.Command {
+	if !s.cfg.Enable {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	acct := s.account(accountID, now)
+	var cmds []model.Command
+	for _, pos := range s.track(acct, positions, now) {
+		quote, ok := quotes[pos.Symbol]
+		if !ok || !quote.HasTick {
+			continue
+		}
+		reason := s.exitReason(pos, quote, now)
+		if reason == "" {
+			continue
+		}
+		cmds = append(cmds, model.Command{
+			Type:      model.CommandClose,
+			Symbol:    pos.Symbol,
+			Side:      pos.Side,
+			Ticket:    pos.ID,
+			Volume:    pos.Volume,
+			Magic:     pos.Magic,
+			AccountID: accountID,
+			Reason:    reason,
+			Time:      now,
+		})
+		acct.closing[pos.ID] = now
+		acct.openCount--
+	}
+	return cmds
+}
+
+// RecordClose books a stealth position that left the bridge feed as a
+// closed trade at its last reported P&L, whether the engine, the broker
+// or a user closed it.
+func (s *StealthEngine) RecordClose(pos model.Position, now time.Time) {
+	if !s.cfg.Enable || !s.IsStealthMagic(pos.Magic) {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	acct := s.account(pos.AccountID, now)
+	delete(acct.closing, pos.ID)
+	s.recordResult(pos.AccountID, acct, pos.ProfitLoss, now)
+}
+
+// Evaluate looks for new entries; Exits must have run first. Entries
+// require guard.AllowStealth.
+func (s *StealthEngine) Evaluate(
+	accountID string,
+	positions []model.Position,
+	quotes map[string]SymbolSnapshot,
+	store *Store,
+	guard GuardResult,
+	now time.Time,
+) []model.Command {
+	if !s.cfg.Enable {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	acct := s.account(accountID, now)
+	openSymbols := make(map[string]bool)
+	for _, pos := range s.track(acct, positions, now) {
+		openSymbols[pos.Symbol] = true
+	}
+
+	if !guard.AllowStealth || guard.LotScale <= 0 {
+		return nil
+	}
+	if now.Before(acct.pausedUntil) {
+		return nil
+	}
+	if s.cfg.MaxLossPerDay > 0 && acct.dailyPL <= -s.cfg.MaxLossPerDay {
+		return nil
+	}
+
+	var cmds []model.Command
+
+	symbols := make([]string, 0, len(quotes))
+	for symbol := range quotes {
+		symbols = append(symbols, symbol)
+	}
+	sort.Strings(symbols)
+
+	for _, symbol := range symbols {
+		if s.cfg.MaxPositions > 0 && acct.openCount+len(acct.pendingOpen) >= s.cfg.MaxPositions {
+			break
+		}
+		if openSymbols[symbol] {
+			continue
+		}
+		if sentAt, ok := acct.pendingOpen[symbol]; ok {
+			if now.Sub(sentAt) < stealthOpenTimeout {
+				continue
+			}
+			delete(acct.pendingOpen, symbol)
+		}
+		quote := quotes[symbol]
+		if !quote.HasTick || quote.Bid <= 0 || quote.Ask <= 0 {
+			continue
+		}
+		side, ok := StealthSignal(store.GetTicks(symbol), s.params)
+		if !ok {
+			continue
+		}
+		lot := normalizeLot(s.cfg.Lot*guard.LotScale, s.lotStep)
+		if lot < s.minLot {
+			continue
+		}
+		price := quote.Ask
+		if side == model.SideSell {
+			price = quote.Bid
+		}
+		cmds = append(cmds, model.Command{
+			Type:      model.CommandOpen,
+			Symbol:    symbol,
+			Side:      side,
+			Volume:    lot,
+			Price:     price,
+			Magic:     s.allocateMagic(),
+			AccountID: accountID,
+			Reason:    "STEALTH_ENTRY",
+			Time:      now,
+		})
+		acct.pendingOpen[symbol] = now
+		s.logger.Info("stealth_entry",
+			zap.String("account", accountID),
+			zap.String("symbol", symbol),
+			zap.String("side", string(side)),
+			zap.Float64("lot", lot),
+		)
+	}
+
+	return cmds
+}
+
+// track updates the open and in-flight bookkeeping from the account's
+// positions and returns the stealth positions without a close in flight.
+// A close unconfirmed after stealthCloseRetry no longer counts as in
+// flight.
+func (s *StealthEngine) track(acct *stealthAccount, positions []model.Position, now time.Time) []model.Position {
+	var open []model.Position
+	present := make(map[int64]bool)
+	for _, pos := range positions {
+		if pos.Pending || !s.IsStealthMagic(pos.Magic) {
+			continue
+		}
+		present[pos.ID] = true
+		if sentAt, ok := acct.closing[pos.ID]; ok {
+			if now.Sub(sentAt) < stealthCloseRetry {
+				continue
+			}
+			delete(acct.closing, pos.ID)
+			s.logger.Warn("stealth_close_unconfirmed",
+				zap.String("account", pos.AccountID),
+				zap.Int64("ticket", pos.ID),
+			)
+		}
+		open = append(open, pos)
+		delete(acct.pendingOpen, pos.Symbol)
+	}
+	acct.openCount = len(open)
+	for ticket := range acct.closing {
+		if !present[ticket] {
+			delete(acct.closing, ticket)
+		}
+	}
+	return open
+}
+
+// exitReason returns the close reason for a stealth position, or "" to hold.
+func (s *StealthEngine) exitReason(pos model.Position, quote SymbolSnapshot, now time.Time) string {
+	if s.cfg.MaxLossPerTrade > 0 && pos.ProfitLoss <= -s.cfg.MaxLossPerTrade {
+		return "STEALTH_MAX_LOSS"
+	}
+	if s.cfg.MaxHoldMinutes > 0 && !pos.OpenTime.IsZero() &&
+		now.Sub(pos.OpenTime) >= time.Duration(s.cfg.MaxHoldMinutes)*time.Minute {
+		return "STEALTH_MAX_HOLD"
+	}
+	pip := pipSize(pos.Symbol)
+	movePips := (quote.Bid - pos.Price) / pip
+	if pos.Side == model.SideSell {
+		movePips = (pos.Price - quote.Ask) / pip
+	}
+	if s.params.TPPips > 0 && movePips >= s.params.TPPips {
+		return "STEALTH_TP"
+	}
+	if s.params.SLPips > 0 && movePips <= -s.params.SLPips {
+		return "STEALTH_SL"
+	}
+	return ""
+}
+
+// recordResult books the P&L of a closed stealth trade and applies the
+// consecutive-loss cooldown.
+func (s *StealthEngine) recordResult(accountID string, acct *stealthAccount, pl float64, now time.Time) {
+	acct.trades++
+	acct.dailyPL = math.Round((acct.dailyPL+pl)*100) / 100
+	if pl >= 0 {
+		acct.wins++
+		acct.consecLosses = 0
+		return
+	}
+	acct.consecLosses++
+	if s.cfg.PauseAfterLosses > 0 && acct.consecLosses >= s.cfg.PauseAfterLosses {
+		acct.pausedUntil = now.Add(time.Duration(s.cfg.PauseMinutes) * time.Minute)
+		acct.consecLosses = 0
+		s.logger.Warn("stealth_paused",
+			zap.String("account", accountID),
+			zap.Int("losses", s.cfg.PauseAfterLosses),
+			zap.Time("until", acct.pausedUntil),
+		)
+	}
+	if s.cfg.MaxLossPerDay > 0 && acct.dailyPL <= -s.cfg.MaxLossPerDay {
+		s.logger.Warn("stealth_daily_loss_limit",
+			zap.String("account", accountID),
+			zap.Float64("daily_pl", acct.dailyPL),
+		)
+	}
+}
+
+// account returns the bookkeeping for an account, resetting daily
+// counters at the start of a new UTC day.
+func (s *StealthEngine) account(accountID string, now time.Time) *stealthAccount {
+	day := now.UTC().Format("2006-01-02")
+	acct, ok := s.accounts[accountID]
+	if !ok {
+		acct = &stealthAccount{
+			day:         day,
+			pendingOpen: make(map[string]time.Time),
+			closing:     make(map[int64]time.Time),
+		}
+		s.accounts[accountID] = acct
+	}
+	if acct.day != day {
+		acct.day = day
+		acct.dailyPL = 0
+	}
+	return acct
+}
+
+// allocateMagic returns the next magic number within the stealth range.
+func (s *StealthEngine) allocateMagic() int {
+	magic := s.nextMagic
+	s.nextMagic++
+	if s.nextMagic > s.cfg.MagicRangeEnd {
+		s.nextMagic = s.cfg.MagicRangeStart
+	}
+	return magic
+}
+
+// States returns the stealth bookkeeping of all accounts.
+func (s *StealthEngine) States() []StealthState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]StealthState, 0, len(s.accounts))
+	for id, acct := range s.accounts {
+		out = append(out, StealthState{
+			AccountID:         id,
+			OpenPositions:     acct.openCount,
+			DailyPL:           acct.dailyPL,
+			ConsecutiveLosses: acct.consecLosses,
+			PausedUntil:       acct.pausedUntil,
+			Trades:            acct.trades,
+			Wins:              acct.wins,
+		})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].AccountID < out[j].AccountID
+	})
+	return out
+}
+
+// StealthSignal evaluates tick microstructure over the last p.Window ticks
+// and returns an entry side when tick imbalance and momentum agree and the
+// spread is acceptable.
+func StealthSignal(ticks []model.Tick, p StealthParams) (model.Side, bool) {
+	if p.Window < 2 || len(ticks) < p.Window+1 {
+		return "", false
+	}
+	window := ticks[len(ticks)-p.Window-1:]
+	last := window[len(window)-1]
+	pip := pipSize(last.Symbol)
+
+	if p.MaxSpreadPips > 0 && (last.Ask-last.Bid)/pip > p.MaxSpreadPips {
+		return "", false
+	}
+
+	upticks, downticks := 0, 0
+	for i := 1; i < len(window); i++ {
+		diff := (window[i].Bid + window[i].Ask) - (window[i-1].Bid + window[i-1].Ask)
+		if diff > 0 {
+			upticks++
+		} else if diff < 0 {
+			downticks++
+		}
+	}
+	moves := upticks + downticks
+	if moves == 0 {
+		return "", false
+	}
+	imbalance := float64(upticks-downticks) / float64(moves)
+
+	first := window[0]
+	momentum := ((last.Bid+last.Ask)/2 - (first.Bid+first.Ask)/2) / pip
+
+	switch {
+	case imbalance >= p.ImbalanceMin && momentum >= p.MomentumPips:
+		return model.SideBuy, true
+	case imbalance <= -p.ImbalanceMin && momentum <= -p.MomentumPips:
+		return model.SideSell, true
+	}
+	return "", false
+}
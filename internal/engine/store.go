@@ -42,6 +42,8 @@ func NewStore() *Store {
 }
 
 // UpdatePositions upserts position entries grouped by accountID|symbol.
+// The initial volume of a position is preserved across updates so partial
+// closes can be tracked against it.
 func (s *Store) UpdatePositions(list []model.Position) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -50,10 +52,41 @@ func (s *Store) UpdatePositions(list []model.Position) {
 		if _, ok := s.positions[key]; !ok {
 			s.positions[key] = make(map[int64]model.Position)
 		}
+		if prev, ok := s.positions[key][pos.ID]; ok && prev.InitialVolume > 0 {
+			pos.InitialVolume = prev.InitialVolume
+		}
+		if pos.InitialVolume == 0 {
+			pos.InitialVolume = pos.Volume
+		}
 		s.positions[key][pos.ID] = pos
 	}
 }
 
+// FindPosition looks up a position by ticket within an account.
+// An empty accountID searches every account.
+func (s *Store) FindPosition(accountID string, ticket int64) (model.Position, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, m := range s.positions {
+		pos, ok := m[ticket]
+		if ok && (accountID == "" || pos.AccountID == accountID) {
+			return pos, true
+		}
+	}
+	return model.Position{}, false
+}
+
+// RemovePosition deletes a position that is no longer open.
+func (s *Store) RemovePosition(accountID, symbol string, ticket int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := accountID + "|" + symbol
+	delete(s.positions[key], ticket)
+	if len(s.positions[key]) == 0 {
+		delete(s.positions, key)
+	}
+}
+
 // SetAccount sets the account state for a single account.
 func (s *Store) SetAccount(state model.AccountState) {
 	s.mu.Lock()
@@ -205,11 +238,41 @@ func (s *Store) Snapshot() StoreSnapshot {
 		}
 	}
 
+	accounts := make([]model.AccountState, 0, len(s.accounts))
+	for _, acc := range s.accounts {
+		accounts = append(accounts, acc)
+	}
+
+	return StoreSnapshot{
+		Symbols:   s.symbolsLocked(positionCounts),
+		Accounts:  accounts,
+		Positions: positions,
+	}
+}
+
+// Symbols returns the latest quote and open position count per symbol.
+func (s *Store) Symbols() []SymbolSnapshot {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	counts := make(map[string]int)
+	for _, items := range s.positions {
+		for _, pos := range items {
+			if !pos.Pending {
+				counts[pos.Symbol]++
+			}
+		}
+	}
+	return s.symbolsLocked(counts)
+}
+
+// symbolsLocked builds the per-symbol snapshots from the tick buffers.
+// counts holds open positions per symbol. Caller holds s.mu.
+func (s *Store) symbolsLocked(counts map[string]int) []SymbolSnapshot {
 	symbols := make([]SymbolSnapshot, 0, len(s.ticks))
 	for symbol, list := range s.ticks {
 		snap := SymbolSnapshot{
 			Symbol:        symbol,
-			PositionCount: positionCounts[symbol],
+			PositionCount: counts[symbol],
 		}
 		if len(list) > 0 {
 			last := list[len(list)-1]
@@ -220,15 +283,5 @@ func (s *Store) Snapshot() StoreSnapshot {
 		}
 		symbols = append(symbols, snap)
 	}
-
-	accounts := make([]model.AccountState, 0, len(s.accounts))
-	for _, acc := range s.accounts {
-		accounts = append(accounts, acc)
-	}
-
-	return StoreSnapshot{
-		Symbols:   symbols,
-		Accounts:  accounts,
-		Positions: positions,
-	}
+	return symbols
 }
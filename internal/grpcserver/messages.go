@@ -0,0 +1,301 @@
+package grpcserver
+
+import (
+	"encoding/json"
+	"time"
+
+	"go-trade/internal/engine"
+	"go-trade/internal/model"
+)
+
+// Message encoders and request decoders for proto/hayalet/v1/hayalet.proto.
+// Field numbers must match the .proto file.
+
+// statusSummary is the part of /api/status the Status message models.
+type statusSummary struct {
+	Time          time.Time           `json:"time"`
+	StartedAt     time.Time           `json:"startedAt"`
+	BridgeMode    string              `json:"bridgeMode"`
+	Mode          string              `json:"mode"`
+	SymbolCount   int                 `json:"symbolCount"`
+	AccountCount  int                 `json:"accountCount"`
+	PositionCount int                 `json:"positionCount"`
+	GuardLevel    string              `json:"guardLevel"`
+	LatestTickAt  time.Time           `json:"latestTickAt"`
+	LatestSymbol  string              `json:"latestSymbol"`
+	TradingStates []engine.ScopeState `json:"tradingStates"`
+}
+
+// encodeStatus writes a Status from the JSON status payload.
+func encodeStatus(e *encoder, raw []byte) error {
+	var st statusSummary
+	if err := json.Unmarshal(raw, &st); err != nil {
+		return err
+	}
+	e.timestamp(1, st.Time)
+	e.timestamp(2, st.StartedAt)
+	e.string(3, st.BridgeMode)
+	e.string(4, st.Mode)
+	e.int64(5, int64(st.SymbolCount))
+	e.int64(6, int64(st.AccountCount))
+	e.int64(7, int64(st.PositionCount))
+	e.string(8, st.GuardLevel)
+	e.timestamp(9, st.LatestTickAt)
+	e.string(10, st.LatestSymbol)
+	for _, ts := range st.TradingStates {
+		e.message(11, func(m *encoder) {
+			m.string(1, ts.AccountID)
+			m.string(2, ts.Symbol)
+			m.string(3, ts.Strategy)
+			m.string(4, string(ts.Mode))
+			m.string(5, ts.Reason)
+			m.timestamp(6, ts.Since)
+		})
+	}
+	e.string(15, string(raw))
+	return nil
+}
+
+func encodeTick(e *encoder, t model.Tick) {
+	e.string(1, t.Symbol)
+	e.double(2, t.Bid)
+	e.double(3, t.Ask)
+	e.timestamp(4, t.Time)
+}
+
+func encodePosition(e *encoder, p model.Position) {
+	e.int64(1, p.ID)
+	e.string(2, p.Symbol)
+	e.string(3, string(p.Side))
+	e.double(4, p.Volume)
+	e.double(5, p.Price)
+	e.timestamp(6, p.OpenTime)
+	e.int64(7, int64(p.Magic))
+	e.string(8, p.AccountID)
+	e.bool(9, p.Pending)
+	e.double(10, p.ProfitLoss)
+	e.double(11, p.Swap)
+	e.string(12, p.Comment)
+	e.double(13, p.InitialVolume)
+}
+
+func encodeAccount(e *encoder, a model.AccountState) {
+	e.string(1, a.AccountID)
+	e.double(2, a.Balance)
+	e.double(3, a.Equity)
+	e.double(4, a.Margin)
+	e.double(5, a.FreeMargin)
+	e.double(6, a.MarginLevel)
+	e.double(7, a.PeakEquity)
+	e.double(8, a.DrawdownPct)
+	e.string(9, string(a.GuardLevel))
+	e.timestamp(10, a.Time)
+}
+
+func encodeGrid(e *encoder, g model.GridState) {
+	e.string(1, g.Symbol)
+	e.string(2, g.AccountID)
+	e.bool(3, g.Active)
+	e.string(4, string(g.Direction))
+	e.double(5, g.AnchorPrice)
+	e.int64(6, int64(g.CurrentLevel))
+	e.int64(7, int64(g.MaxLevel))
+	e.double(8, g.TotalLots)
+	e.double(9, g.FloatingPL)
+	e.timestamp(10, g.CreatedAt)
+}
+
+func encodeCommand(e *encoder, c model.Command) {
+	e.string(1, string(c.Type))
+	e.string(2, c.Symbol)
+	e.string(3, string(c.Side))
+	e.double(4, c.Volume)
+	e.double(5, c.Fraction)
+	e.double(6, c.Price)
+	e.double(7, c.TP)
+	e.double(8, c.SL)
+	e.int64(9, c.Ticket)
+	e.int64(10, int64(c.Magic))
+	e.string(11, c.AccountID)
+	e.string(12, c.Strategy)
+	e.string(13, c.Reason)
+	e.string(14, c.Source)
+	e.timestamp(15, c.Time)
+}
+
+func encodeCommandResult(e *encoder, r model.CommandResult) {
+	e.string(1, r.ID)
+	e.string(2, string(r.Status))
+	e.string(3, r.Code)
+	e.string(4, r.Error)
+	e.message(5, func(m *encoder) { encodeCommand(m, r.Command) })
+	e.int64(6, r.Ticket)
+	e.timestamp(7, r.SentAt)
+	e.timestamp(8, r.FilledAt)
+}
+
+func encodePositionEvent(e *encoder, ev model.PositionEvent) {
+	e.string(1, ev.Action)
+	e.message(2, func(m *encoder) { encodePosition(m, ev.Position) })
+}
+
+func encodeSignal(e *encoder, s model.Signal) {
+	e.string(1, s.ID)
+	e.string(2, s.Source)
+	e.string(3, s.Symbol)
+	e.double(4, s.Score)
+	e.string(5, string(s.Action))
+	e.string(6, string(s.Side))
+	e.timestamp(7, s.Time)
+	e.string(8, s.AccountID)
+	e.string(9, string(s.Status))
+	e.string(10, s.Note)
+}
+
+// encodeEvent writes an Event with the payload for its data type. Data of
+// an unknown type leaves the payload unset.
+func encodeEvent(e *encoder, ev engine.Event) error {
+	e.string(1, ev.Topic)
+	e.string(2, ev.AccountID)
+	e.string(3, ev.Symbol)
+	e.timestamp(4, ev.Time)
+	switch d := ev.Data.(type) {
+	case engine.Status:
+		raw, err := json.Marshal(d)
+		if err != nil {
+			return err
+		}
+		e.message(10, func(m *encoder) { err = encodeStatus(m, raw) })
+		return err
+	case model.Tick:
+		e.message(11, func(m *encoder) { encodeTick(m, d) })
+	case model.PositionEvent:
+		e.message(12, func(m *encoder) { encodePositionEvent(m, d) })
+	case model.AccountState:
+		e.message(13, func(m *encoder) { encodeAccount(m, d) })
+	case model.GuardEvent:
+		e.message(14, func(m *encoder) {
+			m.string(1, d.AccountID)
+			m.string(2, string(d.From))
+			m.string(3, string(d.To))
+			m.double(4, d.DrawdownPct)
+			m.double(5, d.Equity)
+		})
+	case model.CommandEvent:
+		e.message(15, func(m *encoder) {
+			m.string(1, string(d.Status))
+			m.message(2, func(c *encoder) { encodeCommand(c, d.Command) })
+		})
+	case model.Signal:
+		e.message(16, func(m *encoder) { encodeSignal(m, d) })
+	case model.Alert:
+		e.message(17, func(m *encoder) {
+			m.string(1, string(d.Severity))
+			m.string(2, d.Code)
+			m.string(3, d.Message)
+			m.string(4, d.AccountID)
+			m.string(5, d.Symbol)
+		})
+	}
+	return nil
+}
+
+// filterRequest is ListPositionsRequest and ListGridsRequest.
+type filterRequest struct {
+	accountID string
+	symbol    string
+}
+
+func decodeFilterRequest(msg []byte) (filterRequest, error) {
+	var req filterRequest
+	err := fields(msg, func(d *decoder, field, wire int) (bool, error) {
+		var err error
+		switch field {
+		case 1:
+			req.accountID, err = d.readString(wire)
+		case 2:
+			req.symbol, err = d.readString(wire)
+		default:
+			return false, nil
+		}
+		return true, err
+	})
+	return req, err
+}
+
+// streamRequest is StreamRequest and StreamEventsRequest.
+type streamRequest struct {
+	topics   []string
+	accounts []string
+	symbols  []string
+}
+
+// decodeStreamRequest reads a StreamRequest, or a StreamEventsRequest
+// when withTopics is set; the latter has topics as field 1.
+func decodeStreamRequest(msg []byte, withTopics bool) (streamRequest, error) {
+	var req streamRequest
+	lists := []*[]string{&req.accounts, &req.symbols}
+	if withTopics {
+		lists = []*[]string{&req.topics, &req.accounts, &req.symbols}
+	}
+	err := fields(msg, func(d *decoder, field, wire int) (bool, error) {
+		if field > len(lists) {
+			return false, nil
+		}
+		s, err := d.readString(wire)
+		*lists[field-1] = append(*lists[field-1], s)
+		return true, err
+	})
+	return req, err
+}
+
+// decodeCommand reads a Command. source and time are ignored; the REST
+// route sets them.
+func decodeCommand(msg []byte) (model.Command, error) {
+	var c model.Command
+	err := fields(msg, func(d *decoder, field, wire int) (bool, error) {
+		var (
+			s   string
+			n   int64
+			err error
+		)
+		switch field {
+		case 1, 2, 3, 11, 12, 13:
+			s, err = d.readString(wire)
+		case 4:
+			c.Volume, err = d.readDouble(wire)
+		case 5:
+			c.Fraction, err = d.readDouble(wire)
+		case 6:
+			c.Price, err = d.readDouble(wire)
+		case 7:
+			c.TP, err = d.readDouble(wire)
+		case 8:
+			c.SL, err = d.readDouble(wire)
+		case 9, 10:
+			n, err = d.readInt64(wire)
+		default:
+			return false, nil
+		}
+		switch field {
+		case 1:
+			c.Type = model.CommandType(s)
+		case 2:
+			c.Symbol = s
+		case 3:
+			c.Side = model.Side(s)
+		case 9:
+			c.Ticket = n
+		case 10:
+			c.Magic = int(int32(n))
+		case 11:
+			c.AccountID = s
+		case 12:
+			c.Strategy = s
+		case 13:
+			c.Reason = s
+		}
+		return true, err
+	})
+	return c, err
+}
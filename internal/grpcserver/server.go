@@ -0,0 +1,570 @@
+// Package grpcserver serves the gRPC API described in
+// proto/hayalet/v1/hayalet.proto over cleartext HTTP/2, without a gRPC
+// library. Unary calls are replayed through the REST handler with the
+// caller's token, so they share its authentication, role checks, rate
+// limits, validation, idempotency and audit; streams read the WebSocket
+// hub.
+package grpcserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-trade/internal/api"
+	"go-trade/internal/engine"
+	"go-trade/internal/model"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// servicePrefix is the path prefix of every method.
+	servicePrefix = "/hayalet.v1.Hayalet/"
+
+	// maxMessageBytes is the largest request message accepted, the gRPC
+	// default.
+	maxMessageBytes = 4 << 20
+
+	// streamBuffer bounds the events buffered per stream; a slow client
+	// loses the oldest.
+	streamBuffer = 256
+)
+
+// gRPC status codes.
+const (
+	codeOK                 = 0
+	codeCanceled           = 1
+	codeUnknown            = 2
+	codeInvalidArgument    = 3
+	codeDeadlineExceeded   = 4
+	codeNotFound           = 5
+	codePermissionDenied   = 7
+	codeResourceExhausted  = 8
+	codeFailedPrecondition = 9
+	codeAborted            = 10
+	codeUnimplemented      = 12
+	codeInternal           = 13
+	codeUnavailable        = 14
+	codeUnauthenticated    = 16
+)
+
+// statusError ends a call with a gRPC status. apiCode carries the REST
+// error code, sent as the hayalet-code trailer.
+type statusError struct {
+	code    int
+	msg     string
+	apiCode string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("grpc status %d: %s", e.code, e.msg)
+}
+
+func statusErrorf(code int, format string, args ...any) error {
+	return &statusError{code: code, msg: fmt.Sprintf(format, args...)}
+}
+
+// unaryMethod answers one request message with one response message.
+type unaryMethod func(s *Server, r *http.Request, msg []byte) ([]byte, error)
+
+// streamMethod answers one request message with messages passed to send.
+type streamMethod func(s *Server, r *http.Request, msg []byte, send func([]byte) error) error
+
+var unaryMethods = map[string]unaryMethod{
+	"GetStatus":     (*Server).getStatus,
+	"ListPositions": (*Server).listPositions,
+	"ListAccounts":  (*Server).listAccounts,
+	"ListGrids":     (*Server).listGrids,
+	"SendCommand":   (*Server).sendCommand,
+}
+
+var streamMethods = map[string]streamMethod{
+	"StreamTicks":     (*Server).streamTicks,
+	"StreamPositions": (*Server).streamPositions,
+	"StreamEvents":    (*Server).streamEvents,
+}
+
+// Server is the gRPC server.
+type Server struct {
+	rest    http.Handler
+	hub     *api.Hub
+	address string
+	logger  *zap.Logger
+	srv     *http.Server
+	done    <-chan struct{}
+}
+
+// New creates a gRPC server on address. rest is the REST API handler
+// (api.Server.Handler) and hub its WebSocket hub.
+func New(address string, rest http.Handler, hub *api.Hub, logger *zap.Logger) *Server {
+	return &Server{rest: rest, hub: hub, address: address, logger: logger}
+}
+
+// Run serves until ctx is cancelled. Open streams end with UNAVAILABLE.
+func (s *Server) Run(ctx context.Context) error {
+	s.done = ctx.Done()
+
+	var protocols http.Protocols
+	protocols.SetUnencryptedHTTP2(true)
+	s.srv = &http.Server{
+		Addr:        s.address,
+		Handler:     s,
+		Protocols:   &protocols,
+		BaseContext: func(net.Listener) context.Context { return ctx },
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		s.logger.Info("grpc_server_started", zap.String("address", s.address))
+		if err := s.srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			errCh <- err
+		}
+	}()
+
+	select {
+	case <-ctx.Done():
+		shutCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		return s.srv.Shutdown(shutCtx)
+	case err := <-errCh:
+		return err
+	}
+}
+
+// ServeHTTP handles one gRPC call. The status is always sent in
+// trailers, also for calls that fail before any message.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "gRPC requires POST", http.StatusMethodNotAllowed)
+		return
+	}
+	if !strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+		http.Error(w, "gRPC requires Content-Type application/grpc", http.StatusUnsupportedMediaType)
+		return
+	}
+	w.Header().Set("Content-Type", "application/grpc")
+	w.Header().Set("Trailer", "Grpc-Status, Grpc-Message, Hayalet-Code")
+	w.WriteHeader(http.StatusOK)
+
+	err := s.serve(w, r)
+
+	code, msg, apiCode := codeOK, "", ""
+	var se *statusError
+	switch {
+	case err == nil:
+	case errors.As(err, &se):
+		code, msg, apiCode = se.code, se.msg, se.apiCode
+	case errors.Is(err, context.DeadlineExceeded):
+		code, msg = codeDeadlineExceeded, "deadline exceeded"
+	case errors.Is(err, context.Canceled):
+		code, msg = codeCanceled, "canceled"
+	default:
+		code, msg = codeInternal, err.Error()
+	}
+	if code != codeOK && code != codeCanceled {
+		s.logger.Debug("grpc_call_failed", zap.String("method", r.URL.Path), zap.Int("code", code), zap.String("message", msg))
+	}
+	w.Header().Set("Grpc-Status", strconv.Itoa(code))
+	if msg != "" {
+		w.Header().Set("Grpc-Message", percentEncode(msg))
+	}
+	if apiCode != "" {
+		w.Header().Set("Hayalet-Code", apiCode)
+	}
+}
+
+// serve reads the request message and runs the method.
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) error {
+	name, _ := strings.CutPrefix(r.URL.Path, servicePrefix)
+	unary, isUnary := unaryMethods[name]
+	stream, isStream := streamMethods[name]
+	if !strings.HasPrefix(r.URL.Path, servicePrefix) || (!isUnary && !isStream) {
+		return statusErrorf(codeUnimplemented, "unknown method %s", r.URL.Path)
+	}
+
+	if v := r.Header.Get("Grpc-Timeout"); v != "" {
+		d, err := parseTimeout(v)
+		if err != nil {
+			return statusErrorf(codeInvalidArgument, "invalid grpc-timeout %q", v)
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), d)
+		defer cancel()
+		r = r.WithContext(ctx)
+	}
+
+	msg, err := readMessage(r.Body)
+	if err != nil {
+		return err
+	}
+
+	if isUnary {
+		out, err := unary(s, r, msg)
+		if err != nil {
+			return err
+		}
+		return writeMessage(w, out)
+	}
+	// Send the headers now; a stream may stay quiet for a while.
+	flush := http.NewResponseController(w)
+	if err := flush.Flush(); err != nil {
+		return err
+	}
+	return stream(s, r, msg, func(out []byte) error {
+		if err := writeMessage(w, out); err != nil {
+			return err
+		}
+		return flush.Flush()
+	})
+}
+
+// readMessage reads one length-prefixed request message.
+func readMessage(body io.Reader) ([]byte, error) {
+	var hdr [5]byte
+	if _, err := io.ReadFull(body, hdr[:]); err != nil {
+		return nil, statusErrorf(codeInvalidArgument, "missing request message")
+	}
+	if hdr[0]&1 != 0 {
+		return nil, statusErrorf(codeUnimplemented, "compressed messages are not supported")
+	}
+	n := binary.BigEndian.Uint32(hdr[1:])
+	if n > maxMessageBytes {
+		return nil, statusErrorf(codeResourceExhausted, "request message of %d bytes exceeds %d", n, maxMessageBytes)
+	}
+	msg := make([]byte, n)
+	if _, err := io.ReadFull(body, msg); err != nil {
+		return nil, statusErrorf(codeInvalidArgument, "truncated request message")
+	}
+	return msg, nil
+}
+
+// writeMessage writes one uncompressed length-prefixed message.
+func writeMessage(w io.Writer, msg []byte) error {
+	frame := make([]byte, 5, 5+len(msg))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(msg)))
+	_, err := w.Write(append(frame, msg...))
+	return err
+}
+
+// parseTimeout reads a grpc-timeout value: up to eight digits and a unit.
+func parseTimeout(v string) (time.Duration, error) {
+	if len(v) < 2 || len(v) > 9 {
+		return 0, errors.New("bad length")
+	}
+	n, err := strconv.ParseInt(v[:len(v)-1], 10, 64)
+	if err != nil || n < 0 {
+		return 0, errors.New("bad value")
+	}
+	units := map[byte]time.Duration{
+		'H': time.Hour, 'M': time.Minute, 'S': time.Second,
+		'm': time.Millisecond, 'u': time.Microsecond, 'n': time.Nanosecond,
+	}
+	unit, ok := units[v[len(v)-1]]
+	if !ok {
+		return 0, errors.New("bad unit")
+	}
+	return time.Duration(n) * unit, nil
+}
+
+// percentEncode escapes a grpc-message value.
+func percentEncode(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c >= 0x20 && c <= 0x7e && c != '%' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// --- REST replay ---
+
+// restResponse is a recorded REST response.
+type restResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (r *restResponse) Header() http.Header         { return r.header }
+func (r *restResponse) WriteHeader(status int)      { r.status = status }
+func (r *restResponse) Write(p []byte) (int, error) { return r.body.Write(p) }
+
+// call replays a request against a REST route with the caller's token,
+// idempotency key and address.
+func (s *Server) call(r *http.Request, method, path string, body []byte) *restResponse {
+	req, _ := http.NewRequestWithContext(r.Context(), method, path, bytes.NewReader(body))
+	for _, h := range []string{"Authorization", "Idempotency-Key"} {
+		if v := r.Header.Get(h); v != "" {
+			req.Header.Set(h, v)
+		}
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.RemoteAddr = r.RemoteAddr
+	rec := &restResponse{header: make(http.Header), status: http.StatusOK}
+	s.rest.ServeHTTP(rec, req)
+	return rec
+}
+
+// get replays a GET and decodes its bare JSON body into out.
+func (s *Server) get(r *http.Request, path string, out any) error {
+	rec := s.call(r, http.MethodGet, path, nil)
+	if rec.status != http.StatusOK {
+		return restError(rec)
+	}
+	if err := json.Unmarshal(rec.body.Bytes(), out); err != nil {
+		return statusErrorf(codeInternal, "decode %s: %v", path, err)
+	}
+	return nil
+}
+
+// restEnvelope is the REST model.APIResponse with its data undecoded.
+type restEnvelope struct {
+	Data    json.RawMessage    `json:"data"`
+	Error   string             `json:"error"`
+	Code    string             `json:"code"`
+	Details []model.FieldError `json:"details"`
+}
+
+// restError converts a failed REST response to a status error.
+func restError(rec *restResponse) error {
+	var env restEnvelope
+	json.Unmarshal(rec.body.Bytes(), &env)
+	msg := env.Error
+	if msg == "" {
+		msg = strings.TrimSpace(rec.body.String())
+	}
+	if msg == "" {
+		msg = http.StatusText(rec.status)
+	}
+	for _, d := range env.Details {
+		msg += "; " + d.Field + ": " + d.Message
+	}
+	return &statusError{code: httpToCode(rec.status), msg: msg, apiCode: env.Code}
+}
+
+// httpToCode maps a REST status to the closest gRPC code.
+func httpToCode(status int) int {
+	switch status {
+	case http.StatusBadRequest:
+		return codeInvalidArgument
+	case http.StatusUnauthorized:
+		return codeUnauthenticated
+	case http.StatusForbidden:
+		return codePermissionDenied
+	case http.StatusNotFound:
+		return codeNotFound
+	case http.StatusConflict:
+		return codeAborted
+	case http.StatusRequestEntityTooLarge, http.StatusTooManyRequests:
+		return codeResourceExhausted
+	case http.StatusUnprocessableEntity:
+		return codeFailedPrecondition
+	case http.StatusNotImplemented:
+		return codeUnimplemented
+	case http.StatusServiceUnavailable:
+		return codeUnavailable
+	case http.StatusGatewayTimeout:
+		return codeDeadlineExceeded
+	}
+	if status >= 500 {
+		return codeInternal
+	}
+	return codeUnknown
+}
+
+// --- unary methods ---
+
+func (s *Server) getStatus(r *http.Request, msg []byte) ([]byte, error) {
+	var raw json.RawMessage
+	if err := s.get(r, "/api/status", &raw); err != nil {
+		return nil, err
+	}
+	var e encoder
+	if err := encodeStatus(&e, raw); err != nil {
+		return nil, statusErrorf(codeInternal, "decode status: %v", err)
+	}
+	return e.buf, nil
+}
+
+func (s *Server) listPositions(r *http.Request, msg []byte) ([]byte, error) {
+	req, err := decodeFilterRequest(msg)
+	if err != nil {
+		return nil, statusErrorf(codeInvalidArgument, "%v", err)
+	}
+	var positions []model.Position
+	if err := s.get(r, "/api/positions", &positions); err != nil {
+		return nil, err
+	}
+	var e encoder
+	for _, p := range positions {
+		if req.matches(p.AccountID, p.Symbol) {
+			e.message(1, func(m *encoder) { encodePosition(m, p) })
+		}
+	}
+	return e.buf, nil
+}
+
+func (s *Server) listAccounts(r *http.Request, msg []byte) ([]byte, error) {
+	var accounts []model.AccountState
+	if err := s.get(r, "/api/accounts", &accounts); err != nil {
+		return nil, err
+	}
+	var e encoder
+	for _, a := range accounts {
+		e.message(1, func(m *encoder) { encodeAccount(m, a) })
+	}
+	return e.buf, nil
+}
+
+func (s *Server) listGrids(r *http.Request, msg []byte) ([]byte, error) {
+	req, err := decodeFilterRequest(msg)
+	if err != nil {
+		return nil, statusErrorf(codeInvalidArgument, "%v", err)
+	}
+	var grids []model.GridState
+	if err := s.get(r, "/api/grids", &grids); err != nil {
+		return nil, err
+	}
+	var e encoder
+	for _, g := range grids {
+		if req.matches(g.AccountID, g.Symbol) {
+			e.message(1, func(m *encoder) { encodeGrid(m, g) })
+		}
+	}
+	return e.buf, nil
+}
+
+// sendCommand executes a command through /api/command. A response that
+// carries a CommandResult is returned as such whatever its HTTP status.
+func (s *Server) sendCommand(r *http.Request, msg []byte) ([]byte, error) {
+	cmd, err := decodeCommand(msg)
+	if err != nil {
+		return nil, statusErrorf(codeInvalidArgument, "%v", err)
+	}
+	body, _ := json.Marshal(cmd)
+	rec := s.call(r, http.MethodPost, "/api/command", body)
+
+	var env restEnvelope
+	var res model.CommandResult
+	if json.Unmarshal(rec.body.Bytes(), &env) == nil && len(env.Data) > 0 &&
+		json.Unmarshal(env.Data, &res) == nil && res.ID != "" {
+		var e encoder
+		encodeCommandResult(&e, res)
+		return e.buf, nil
+	}
+	return nil, restError(rec)
+}
+
+// matches reports whether an item passes the account and symbol filter.
+func (f filterRequest) matches(accountID, symbol string) bool {
+	return (f.accountID == "" || f.accountID == accountID) &&
+		(f.symbol == "" || strings.EqualFold(f.symbol, symbol))
+}
+
+// --- streams ---
+
+func (s *Server) streamTicks(r *http.Request, msg []byte, send func([]byte) error) error {
+	return s.stream(r, msg, false, []string{model.TopicTick}, send)
+}
+
+func (s *Server) streamPositions(r *http.Request, msg []byte, send func([]byte) error) error {
+	return s.stream(r, msg, false, []string{model.TopicPosition}, send)
+}
+
+func (s *Server) streamEvents(r *http.Request, msg []byte, send func([]byte) error) error {
+	return s.stream(r, msg, true, nil, send)
+}
+
+// stream authenticates the caller as a VIEWER, subscribes to the hub and
+// sends events until the client goes away or the server stops. Fixed
+// topics send the event payload alone (Tick, PositionEvent); otherwise
+// each event is sent as an Event.
+func (s *Server) stream(r *http.Request, msg []byte, withTopics bool, topics []string, send func([]byte) error) error {
+	req, err := decodeStreamRequest(msg, withTopics)
+	if err != nil {
+		return statusErrorf(codeInvalidArgument, "%v", err)
+	}
+	if rec := s.call(r, http.MethodGet, "/api/auth/me", nil); rec.status != http.StatusOK {
+		return restError(rec)
+	}
+	sessionID, err := s.hub.SessionID(r)
+	if err != nil {
+		return statusErrorf(codeUnauthenticated, "%v", err)
+	}
+	if !withTopics {
+		req.topics = topics
+	}
+
+	sub, errs := s.hub.Subscribe(sessionID, req.topics, req.accounts, req.symbols, streamBuffer)
+	if len(errs) > 0 {
+		msg := "invalid subscription"
+		for _, e := range errs {
+			msg += "; " + e.Field + ": " + e.Message
+		}
+		return &statusError{code: codeInvalidArgument, msg: msg, apiCode: "VALIDATION_FAILED"}
+	}
+	defer sub.Close()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			// Request contexts derive from the server's, so check which one
+			// ended.
+			select {
+			case <-s.done:
+				return statusErrorf(codeUnavailable, "server shutting down")
+			default:
+				return r.Context().Err()
+			}
+		case ev, ok := <-sub.Events():
+			if !ok {
+				if sub.Revoked() {
+					return statusErrorf(codeUnauthenticated, "session ended")
+				}
+				return statusErrorf(codeUnavailable, "stream closed")
+			}
+			out, err := encodeStreamEvent(ev, withTopics)
+			if err != nil {
+				s.logger.Debug("grpc_encode_failed", zap.String("topic", ev.Topic), zap.Error(err))
+				continue
+			}
+			if err := send(out); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// encodeStreamEvent encodes an event as an Event, or as its bare payload
+// for the fixed-topic streams.
+func encodeStreamEvent(ev engine.Event, asEvent bool) ([]byte, error) {
+	var e encoder
+	if asEvent {
+		err := encodeEvent(&e, ev)
+		return e.buf, err
+	}
+	switch d := ev.Data.(type) {
+	case model.Tick:
+		encodeTick(&e, d)
+	case model.PositionEvent:
+		encodePositionEvent(&e, d)
+	default:
+		return nil, fmt.Errorf("unexpected %T on %s", ev.Data, ev.Topic)
+	}
+	return e.buf, nil
+}
@@ -0,0 +1,207 @@
+package grpcserver
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"time"
+)
+
+// Protobuf wire types.
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+var errTruncated = errors.New("truncated protobuf message")
+
+// encoder appends protobuf fields. Zero values are omitted, as proto3
+// does for scalar fields.
+type encoder struct {
+	buf []byte
+}
+
+func (e *encoder) tag(field, wire int) {
+	e.buf = binary.AppendUvarint(e.buf, uint64(field)<<3|uint64(wire))
+}
+
+func (e *encoder) string(field int, s string) {
+	if s == "" {
+		return
+	}
+	e.tag(field, wireBytes)
+	e.buf = binary.AppendUvarint(e.buf, uint64(len(s)))
+	e.buf = append(e.buf, s...)
+}
+
+func (e *encoder) double(field int, v float64) {
+	if v == 0 {
+		return
+	}
+	e.tag(field, wireFixed64)
+	e.buf = binary.LittleEndian.AppendUint64(e.buf, math.Float64bits(v))
+}
+
+// int64 writes int64 and int32 fields; negative values take ten bytes.
+func (e *encoder) int64(field int, v int64) {
+	if v == 0 {
+		return
+	}
+	e.tag(field, wireVarint)
+	e.buf = binary.AppendUvarint(e.buf, uint64(v))
+}
+
+func (e *encoder) bool(field int, v bool) {
+	if !v {
+		return
+	}
+	e.tag(field, wireVarint)
+	e.buf = append(e.buf, 1)
+}
+
+// message writes a nested message built by fill. It is written even when
+// empty, so the receiver sees the field as set.
+func (e *encoder) message(field int, fill func(*encoder)) {
+	var sub encoder
+	fill(&sub)
+	e.tag(field, wireBytes)
+	e.buf = binary.AppendUvarint(e.buf, uint64(len(sub.buf)))
+	e.buf = append(e.buf, sub.buf...)
+}
+
+// timestamp writes a google.protobuf.Timestamp, omitting the zero time.
+func (e *encoder) timestamp(field int, t time.Time) {
+	if t.IsZero() {
+		return
+	}
+	e.message(field, func(ts *encoder) {
+		ts.int64(1, t.Unix())
+		ts.int64(2, int64(t.Nanosecond()))
+	})
+}
+
+// decoder reads protobuf fields in order.
+type decoder struct {
+	buf []byte
+}
+
+// next reads the next field's number and wire type; ok is false at the
+// end of the message.
+func (d *decoder) next() (field, wire int, ok bool, err error) {
+	if len(d.buf) == 0 {
+		return 0, 0, false, nil
+	}
+	key, err := d.varint()
+	if err != nil {
+		return 0, 0, false, err
+	}
+	field, wire = int(key>>3), int(key&7)
+	if field <= 0 {
+		return 0, 0, false, errors.New("invalid protobuf field number")
+	}
+	return field, wire, true, nil
+}
+
+func (d *decoder) varint() (uint64, error) {
+	v, n := binary.Uvarint(d.buf)
+	if n <= 0 {
+		return 0, errTruncated
+	}
+	d.buf = d.buf[n:]
+	return v, nil
+}
+
+func (d *decoder) fixed64() (uint64, error) {
+	if len(d.buf) < 8 {
+		return 0, errTruncated
+	}
+	v := binary.LittleEndian.Uint64(d.buf)
+	d.buf = d.buf[8:]
+	return v, nil
+}
+
+func (d *decoder) bytes() ([]byte, error) {
+	n, err := d.varint()
+	if err != nil {
+		return nil, err
+	}
+	if n > uint64(len(d.buf)) {
+		return nil, errTruncated
+	}
+	b := d.buf[:n]
+	d.buf = d.buf[n:]
+	return b, nil
+}
+
+// skip discards a field of an unknown number.
+func (d *decoder) skip(wire int) error {
+	switch wire {
+	case wireVarint:
+		_, err := d.varint()
+		return err
+	case wireFixed64:
+		_, err := d.fixed64()
+		return err
+	case wireBytes:
+		_, err := d.bytes()
+		return err
+	case wireFixed32:
+		if len(d.buf) < 4 {
+			return errTruncated
+		}
+		d.buf = d.buf[4:]
+		return nil
+	}
+	return errors.New("unsupported protobuf wire type")
+}
+
+// fields calls fn for every field of msg. fn reads the value with the
+// typed readers below and reports whether it knew the field; unknown
+// fields are skipped.
+func fields(msg []byte, fn func(d *decoder, field, wire int) (bool, error)) error {
+	d := &decoder{buf: msg}
+	for {
+		field, wire, ok, err := d.next()
+		if err != nil || !ok {
+			return err
+		}
+		known, err := fn(d, field, wire)
+		if err != nil {
+			return err
+		}
+		if !known {
+			if err := d.skip(wire); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// readString reads a string field value.
+func (d *decoder) readString(wire int) (string, error) {
+	if wire != wireBytes {
+		return "", errors.New("string field with wrong wire type")
+	}
+	b, err := d.bytes()
+	return string(b), err
+}
+
+// readDouble reads a double field value.
+func (d *decoder) readDouble(wire int) (float64, error) {
+	if wire != wireFixed64 {
+		return 0, errors.New("double field with wrong wire type")
+	}
+	v, err := d.fixed64()
+	return math.Float64frombits(v), err
+}
+
+// readInt64 reads an int64 or int32 field value.
+func (d *decoder) readInt64(wire int) (int64, error) {
+	if wire != wireVarint {
+		return 0, errors.New("integer field with wrong wire type")
+	}
+	v, err := d.varint()
+	return int64(v), err
+}
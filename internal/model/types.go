@@ -23,8 +23,54 @@ const (
 	CommandHedgeAll CommandType = "HEDGE_ALL"
 	CommandCloseAll CommandType = "CLOSE_ALL"
 	CommandFreeze   CommandType = "FREEZE"
+
+	// CommandPartialClose closes part of a position. Either Volume (lots)
+	// or Fraction (0-1 of the current volume) must be set.
+	CommandPartialClose CommandType = "PARTIAL_CLOSE"
+)
+
+// TradingMode is the trading state of a scope (global, account, symbol or
+// strategy).
+type TradingMode string
+
+const (
+	TradingRunning TradingMode = "RUNNING"
+	TradingPaused  TradingMode = "PAUSED" // strategies skip the scope until resumed
+	TradingFrozen  TradingMode = "FROZEN" // as paused, and manual orders are refused
 )
 
+// OverrideKind is the type of a manual override.
+type OverrideKind string
+
+const (
+	OverridePreset         OverrideKind = "PRESET"          // Value: preset name used by the grid
+	OverrideDirection      OverrideKind = "DIRECTION"       // Value: BUY or SELL, grid opens that side only
+	OverrideDisableCascade OverrideKind = "DISABLE_CASCADE" // no cascade levels are opened
+	OverrideGuardLevel     OverrideKind = "GUARD_LEVEL"     // Value: minimum guard level for the account
+)
+
+// Override is a temporary manual intervention. Empty AccountID or Symbol
+// match every account or symbol.
+type Override struct {
+	ID        string       `json:"id"`
+	Kind      OverrideKind `json:"kind"`
+	AccountID string       `json:"accountId,omitempty"`
+	Symbol    string       `json:"symbol,omitempty"`
+	Value     string       `json:"value,omitempty"`
+	Reason    string       `json:"reason"`
+	Author    string       `json:"author"`
+	CreatedAt time.Time    `json:"createdAt"`
+	ExpiresAt time.Time    `json:"expiresAt"`
+}
+
+// OverrideEvent is one entry in the override audit trail.
+type OverrideEvent struct {
+	Time     time.Time `json:"time"`
+	Action   string    `json:"action"` // CREATED, UPDATED, REMOVED, EXPIRED
+	Actor    string    `json:"actor"`
+	Override Override  `json:"override"`
+}
+
 // GuardLevel represents a Balance Guard protection level.
 type GuardLevel string
 
@@ -76,6 +122,7 @@ type Position struct {
 	ProfitLoss float64  `json:"profitLoss"`
 	Swap      float64   `json:"swap"`
 	Comment   string    `json:"comment"`
+	InitialVolume float64 `json:"initialVolume"` // volume when first seen, kept across partial closes
 }
 
 // AccountState represents the current state of a trading account.
@@ -98,18 +145,22 @@ type Command struct {
 	Symbol    string      `json:"symbol"`
 	Side      Side        `json:"side"`
 	Volume    float64     `json:"volume"`
+	Fraction  float64     `json:"fraction,omitempty"` // PARTIAL_CLOSE only, resolved to Volume before sending
 	Price     float64     `json:"price"`
 	TP        float64     `json:"tp"`
 	SL        float64     `json:"sl"`
 	Ticket    int64       `json:"ticket"`
 	Magic     int         `json:"magic"`
 	AccountID string      `json:"accountId"`
+	Strategy  string      `json:"strategy,omitempty"` // PAUSE/RESUME/FREEZE scope
 	Reason    string      `json:"reason"`
+	Source    string      `json:"source,omitempty"` // producer: strategy:grid, api:<user>, guard, ...
 	Time      time.Time   `json:"time"`
 }
 
 // Signal represents an external trading signal.
 type Signal struct {
+	ID        string         `json:"id"`
 	Source    string         `json:"source"`
 	Symbol   string         `json:"symbol"`
 	Score    float64        `json:"score"`
@@ -118,8 +169,20 @@ type Signal struct {
 	Time     time.Time      `json:"time"`
 	Raw      map[string]any `json:"raw,omitempty"`
 	AccountID string        `json:"accountId"`
+	Status    SignalStatus  `json:"status,omitempty"`
+	Note      string        `json:"note,omitempty"`
 }
 
+// SignalStatus represents the processing state of a signal.
+type SignalStatus string
+
+const (
+	SignalQueued   SignalStatus = "QUEUED"
+	SignalExecuted SignalStatus = "EXECUTED"
+	SignalRejected SignalStatus = "REJECTED"
+	SignalExpired  SignalStatus = "EXPIRED"
+)
+
 // GridState represents the current state of a grid for a symbol.
 type GridState struct {
 	Symbol       string    `json:"symbol"`
@@ -207,14 +270,98 @@ type Metrics struct {
 
 // WSMessage represents a WebSocket message sent to dashboard clients.
 type WSMessage struct {
-	Type      string    `json:"type"` // tick, position, account, risk, alert, grid, signal, heartbeat
+	Seq       uint64    `json:"seq,omitempty"` // per client and topic, set by the hub
+	Type      string    `json:"type"` // a Topic* constant
 	Data      any       `json:"data"`
 	Timestamp time.Time `json:"timestamp"`
 }
 
-// APIResponse is the standard REST API response envelope.
+// APIResponse is the standard REST API response envelope. Code and
+// Details are set on errors from the typed command API.
 type APIResponse struct {
-	Data      any       `json:"data,omitempty"`
-	Error     string    `json:"error,omitempty"`
-	Timestamp time.Time `json:"timestamp"`
+	Data      any          `json:"data,omitempty"`
+	Error     string       `json:"error,omitempty"`
+	Code      string       `json:"code,omitempty"`
+	Details   []FieldError `json:"details,omitempty"`
+	Timestamp time.Time    `json:"timestamp"`
+}
+
+// FieldError describes one invalid request field.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// CommandStatus is the outcome of a command executed through the API.
+type CommandStatus string
+
+const (
+	CommandApplied  CommandStatus = "APPLIED"  // engine state changed (pause, resume, ...)
+	CommandSent     CommandStatus = "SENT"     // written to the bridge, no fill seen yet
+	CommandFilled   CommandStatus = "FILLED"   // matching position reported by the EA
+	CommandRejected CommandStatus = "REJECTED" // refused by engine checks
+	CommandFailed   CommandStatus = "FAILED"   // bridge did not accept the command
+)
+
+// CommandResult is the synchronous result of an API command.
+type CommandResult struct {
+	ID       string        `json:"id"`
+	Status   CommandStatus `json:"status"`
+	Code     string        `json:"code,omitempty"`
+	Error    string        `json:"error,omitempty"`
+	Command  Command       `json:"command"`
+	Ticket   int64         `json:"ticket,omitempty"`
+	SentAt   time.Time     `json:"sentAt,omitempty"`
+	FilledAt time.Time     `json:"filledAt,omitempty"`
+}
+
+// WebSocket topics. A message's Type is the topic it was published on.
+const (
+	TopicStatus   = "status"   // full engine status, once per second
+	TopicTick     = "tick"     // Tick, throttled per symbol
+	TopicPosition = "position" // PositionEvent
+	TopicAccount  = "account"  // AccountState, throttled per account
+	TopicGuard    = "guard"    // GuardEvent
+	TopicCommand  = "command"  // CommandEvent
+	TopicSignal   = "signal"   // Signal with its processing status
+	TopicAlert    = "alert"    // Alert
+)
+
+// PositionEvent reports a change to a position.
+type PositionEvent struct {
+	Action   string   `json:"action"` // OPENED, UPDATED, REDUCED, CLOSED
+	Position Position `json:"position"`
+}
+
+// GuardEvent reports a Balance Guard level transition for an account.
+type GuardEvent struct {
+	AccountID   string     `json:"accountId"`
+	From        GuardLevel `json:"from"`
+	To          GuardLevel `json:"to"`
+	DrawdownPct float64    `json:"drawdownPct"`
+	Equity      float64    `json:"equity"`
+}
+
+// CommandEvent reports a command and its outcome.
+type CommandEvent struct {
+	Status  CommandStatus `json:"status"`
+	Command Command       `json:"command"`
+}
+
+// AlertSeverity ranks an alert.
+type AlertSeverity string
+
+const (
+	AlertInfo     AlertSeverity = "INFO"
+	AlertWarning  AlertSeverity = "WARNING"
+	AlertCritical AlertSeverity = "CRITICAL"
+)
+
+// Alert is an operator-facing notice about a state change.
+type Alert struct {
+	Severity  AlertSeverity `json:"severity"`
+	Code      string        `json:"code"`
+	Message   string        `json:"message"`
+	AccountID string        `json:"accountId,omitempty"`
+	Symbol    string        `json:"symbol,omitempty"`
 }
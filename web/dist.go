@@ -0,0 +1,13 @@
+// Package web exposes the dashboard's static export (web/out) to the Go
+// server when the binary is built with the embeddash tag:
+//
+//	cd web && npm ci && npm run build && cd .. && go build -tags embeddash ./cmd/hayaletd
+//
+// Without the tag the server reads dashboard.staticPath from disk.
+package web
+
+import "io/fs"
+
+// Dist is the embedded dashboard build, rooted at web/out, or nil when
+// the binary was built without the embeddash tag.
+var Dist fs.FS
@@ -0,0 +1,15 @@
+//go:build embeddash
+
+package web
+
+import (
+	"embed"
+	"io/fs"
+)
+
+//go:embed all:out
+var out embed.FS
+
+func init() {
+	Dist, _ = fs.Sub(out, "out")
+}
@@ -1,7 +1,9 @@
 import type { NextConfig } from "next";
 
 const nextConfig: NextConfig = {
-  /* config options here */
+  // Static export to web/out, served by hayaletd (dashboard.staticPath) or
+  // embedded with `go build -tags embeddash`.
+  output: "export",
 };
 
 export default nextConfig;
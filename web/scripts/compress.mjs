@@ -0,0 +1,30 @@
+// Writes .br and .gz copies of the text assets in out/ so hayaletd can
+// serve them precompressed (it gzips on the fly otherwise, and has no
+// brotli encoder of its own).
+import { readdir, readFile, stat, writeFile } from 'node:fs/promises';
+import { join, extname } from 'node:path';
+import { brotliCompressSync, gzipSync, constants } from 'node:zlib';
+
+const ROOT = new URL('../out/', import.meta.url).pathname;
+const EXTS = new Set(['.html', '.js', '.mjs', '.css', '.json', '.svg', '.txt', '.xml', '.map', '.webmanifest']);
+const MIN_BYTES = 1024;
+
+async function* walk(dir) {
+  for (const entry of await readdir(dir, { withFileTypes: true })) {
+    const path = join(dir, entry.name);
+    if (entry.isDirectory()) yield* walk(path);
+    else yield path;
+  }
+}
+
+let count = 0;
+for await (const file of walk(ROOT)) {
+  if (!EXTS.has(extname(file)) || (await stat(file)).size < MIN_BYTES) continue;
+  const data = await readFile(file);
+  await writeFile(file + '.br', brotliCompressSync(data, {
+    params: { [constants.BROTLI_PARAM_QUALITY]: constants.BROTLI_MAX_QUALITY },
+  }));
+  await writeFile(file + '.gz', gzipSync(data, { level: 9 }));
+  count++;
+}
+console.log(`compressed ${count} files in out/`);
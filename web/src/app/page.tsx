@@ -1,5 +1,6 @@
 'use client';
 
+import { useEffect, useState } from 'react';
 import WSProvider from '@/components/WSProvider';
 import StatusBar from '@/components/StatusBar';
 import AccountCard from '@/components/AccountCard';
@@ -9,8 +10,25 @@ import PositionsTable from '@/components/PositionsTable';
 import GridsTable from '@/components/GridsTable';
 import ControlPanel from '@/components/ControlPanel';
 import LocaleSwitcher from '@/components/LocaleSwitcher';
+import LoginForm from '@/components/LoginForm';
+import { SESSION_EXPIRED, hasSession, logout } from '@/lib/api';
+import { getLocale, t } from '@/lib/i18n';
 
 export default function Home() {
+  // null until mounted: the tokens live in localStorage.
+  const [signedIn, setSignedIn] = useState<boolean | null>(null);
+
+  useEffect(() => {
+    getLocale();
+    setSignedIn(hasSession());
+    const expired = () => setSignedIn(false);
+    window.addEventListener(SESSION_EXPIRED, expired);
+    return () => window.removeEventListener(SESSION_EXPIRED, expired);
+  }, []);
+
+  if (signedIn === null) return <div className="min-h-screen bg-black" />;
+  if (!signedIn) return <LoginForm onLogin={() => setSignedIn(true)} />;
+
   return (
     <WSProvider>
       <div className="min-h-screen bg-black">
@@ -18,7 +36,15 @@ export default function Home() {
         <div className="max-w-7xl mx-auto px-4 py-4">
           <div className="flex items-center justify-between mb-4">
             <h1 className="text-lg font-bold text-white">HAYALET</h1>
-            <LocaleSwitcher />
+            <div className="flex items-center gap-2">
+              <LocaleSwitcher />
+              <button
+                onClick={() => logout().then(() => setSignedIn(false))}
+                className="px-2 py-1 text-xs bg-gray-800 hover:bg-gray-700 text-gray-300 rounded border border-gray-700 transition-colors"
+              >
+                {t('login.logout')}
+              </button>
+            </div>
           </div>
 
           <div className="grid grid-cols-1 md:grid-cols-3 gap-4 mb-4">
@@ -0,0 +1,114 @@
+'use client';
+
+import { useState } from 'react';
+import { APIError, changePassword, fetchMe, login, logout } from '@/lib/api';
+import { t } from '@/lib/i18n';
+import LocaleSwitcher from '@/components/LocaleSwitcher';
+
+// LoginForm signs in and stores the tokens before the dashboard starts
+// fetching. A user with a forced password reset sets a new one first.
+export default function LoginForm({ onLogin }: { onLogin: () => void }) {
+  const [username, setUsername] = useState('');
+  const [password, setPassword] = useState('');
+  const [newPassword, setNewPassword] = useState('');
+  const [mustReset, setMustReset] = useState(false);
+  const [error, setError] = useState('');
+  const [busy, setBusy] = useState(false);
+
+  const submit = async (e: React.FormEvent) => {
+    e.preventDefault();
+    setBusy(true);
+    setError('');
+    try {
+      if (mustReset) {
+        await changePassword(password, newPassword);
+        onLogin();
+        return;
+      }
+      await login(username, password);
+      const me = await fetchMe();
+      if (me.mustResetPassword) {
+        setMustReset(true);
+        return;
+      }
+      onLogin();
+    } catch (err) {
+      if (mustReset) {
+        setError(err instanceof Error ? err.message : t('login.failed'));
+      } else {
+        await logout();
+        setError(err instanceof APIError && err.status === 401 ? t('login.invalid') : t('login.failed'));
+      }
+    } finally {
+      setBusy(false);
+    }
+  };
+
+  const input =
+    'w-full px-3 py-2 bg-black border border-gray-700 rounded text-sm text-white focus:outline-none focus:border-gray-500';
+
+  return (
+    <div className="min-h-screen bg-black flex items-center justify-center px-4">
+      <form onSubmit={submit} className="w-full max-w-sm bg-gray-900 border border-gray-800 rounded-lg p-6 space-y-4">
+        <div className="flex items-start justify-between">
+          <div>
+            <h1 className="text-lg font-bold text-white">HAYALET</h1>
+            <p className="text-sm text-gray-400">{t('login.title')}</p>
+          </div>
+          <LocaleSwitcher />
+        </div>
+        {mustReset ? (
+          <>
+            <p className="text-sm text-yellow-400">{t('login.resetRequired')}</p>
+            <label className="block text-sm text-gray-400">
+              {t('login.newPassword')}
+              <input
+                type="password"
+                autoComplete="new-password"
+                value={newPassword}
+                onChange={(e) => setNewPassword(e.target.value)}
+                className={`${input} mt-1`}
+                required
+                autoFocus
+              />
+            </label>
+          </>
+        ) : (
+          <>
+            <label className="block text-sm text-gray-400">
+              {t('login.username')}
+              <input
+                type="text"
+                autoComplete="username"
+                value={username}
+                onChange={(e) => setUsername(e.target.value)}
+                className={`${input} mt-1`}
+                required
+                autoFocus
+              />
+            </label>
+            <label className="block text-sm text-gray-400">
+              {t('login.password')}
+              <input
+                type="password"
+                autoComplete="current-password"
+                value={password}
+                onChange={(e) => setPassword(e.target.value)}
+                className={`${input} mt-1`}
+                required
+              />
+            </label>
+          </>
+        )}
+        {error && <p className="text-sm text-red-400">{error}</p>}
+        <button
+          type="submit"
+          disabled={busy}
+          className="w-full px-3 py-2 bg-blue-600 hover:bg-blue-500 disabled:opacity-50 text-white text-sm rounded transition-colors"
+        >
+          {mustReset ? t('login.setPassword') : t('login.submit')}
+        </button>
+      </form>
+    </div>
+  );
+}
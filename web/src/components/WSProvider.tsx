@@ -2,7 +2,7 @@
 
 import { useEffect, useRef } from 'react';
 import { useStore } from '@/lib/store';
-import { connectWebSocket, fetchStatus } from '@/lib/api';
+import { connectWebSocket, ensureFreshToken, fetchStatus, hasSession } from '@/lib/api';
 import type { EngineStatus, WSMessage } from '@/lib/types';
 
 export default function WSProvider({ children }: { children: React.ReactNode }) {
@@ -17,8 +17,18 @@ export default function WSProvider({ children }: { children: React.ReactNode })
       .then((data) => setStatus(data))
       .catch(() => {});
 
-    function connect() {
+    let stopped = false;
+
+    async function connect() {
       if (wsRef.current?.readyState === WebSocket.OPEN) return;
+      // The token is checked only at connect time, so renew it first. A
+      // rejected refresh ends the session; a network error is retried.
+      const fresh = await ensureFreshToken().catch(() => false);
+      if (stopped) return;
+      if (!fresh) {
+        if (hasSession()) retryRef.current = setTimeout(connect, 3000);
+        return;
+      }
 
       wsRef.current = connectWebSocket(
         (msg: unknown) => {
@@ -33,7 +43,7 @@ export default function WSProvider({ children }: { children: React.ReactNode })
         () => {
           setConnected(false);
           // Retry after 3 seconds
-          retryRef.current = setTimeout(connect, 3000);
+          if (!stopped) retryRef.current = setTimeout(connect, 3000);
         },
       );
     }
@@ -50,6 +60,7 @@ export default function WSProvider({ children }: { children: React.ReactNode })
     }, 5000);
 
     return () => {
+      stopped = true;
       clearInterval(pollInterval);
       clearTimeout(retryRef.current);
       wsRef.current?.close();
@@ -1,9 +1,146 @@
-import type { Command, EngineStatus } from './types';
+import type { Candle, Command, EngineStatus, LoginResponse, Tick, Timeframe, UserInfo, WSTopic } from './types';
 
-const API_BASE = process.env.NEXT_PUBLIC_API_URL || 'http://localhost:8090';
+// The production build is served by hayaletd itself, so it talks to its own
+// origin; `next dev` runs on :3000 and needs the API address.
+const API_BASE =
+  process.env.NEXT_PUBLIC_API_URL ??
+  (process.env.NODE_ENV === 'production' ? '' : 'http://localhost:8090');
+
+const ACCESS_KEY = 'hayalet.accessToken';
+const REFRESH_KEY = 'hayalet.refreshToken';
+const ACCESS_EXPIRES_KEY = 'hayalet.accessExpiresAt';
+
+// SESSION_EXPIRED is dispatched on window when the refresh token is
+// rejected, so the dashboard can return to the login view.
+export const SESSION_EXPIRED = 'hayalet:session-expired';
+
+function getToken(key: string): string | null {
+  return typeof window === 'undefined' ? null : window.localStorage.getItem(key);
+}
+
+function storeTokens(tokens: LoginResponse | null) {
+  if (typeof window === 'undefined') return;
+  if (tokens) {
+    window.localStorage.setItem(ACCESS_KEY, tokens.accessToken);
+    window.localStorage.setItem(REFRESH_KEY, tokens.refreshToken);
+    window.localStorage.setItem(ACCESS_EXPIRES_KEY, tokens.accessExpiresAt);
+  } else {
+    window.localStorage.removeItem(ACCESS_KEY);
+    window.localStorage.removeItem(REFRESH_KEY);
+    window.localStorage.removeItem(ACCESS_EXPIRES_KEY);
+  }
+}
+
+// hasSession reports whether a refresh token is stored.
+export function hasSession(): boolean {
+  return getToken(REFRESH_KEY) !== null;
+}
+
+// refreshing is the refresh in flight; concurrent callers share it, since
+// each refresh token may be used only once.
+let refreshing: Promise<boolean> | null = null;
+
+function refreshTokens(): Promise<boolean> {
+  if (!refreshing) {
+    refreshing = sendRefresh().finally(() => {
+      refreshing = null;
+    });
+  }
+  return refreshing;
+}
+
+async function sendRefresh(): Promise<boolean> {
+  const refreshToken = getToken(REFRESH_KEY);
+  if (!refreshToken) return false;
+  const res = await fetch(`${API_BASE}/api/auth/refresh`, {
+    method: 'POST',
+    headers: { 'Content-Type': 'application/json' },
+    body: JSON.stringify({ refreshToken }),
+  });
+  if (!res.ok) {
+    // Another tab rotated the shared token meanwhile: use its result
+    if (getToken(REFRESH_KEY) !== refreshToken) return hasSession();
+    storeTokens(null);
+    window.dispatchEvent(new Event(SESSION_EXPIRED));
+    return false;
+  }
+  const body = await res.json();
+  storeTokens(body.data as LoginResponse);
+  return true;
+}
+
+// ensureFreshToken refreshes the access token when it expires within 30s.
+// The WebSocket sends its token only once, at connect time.
+export async function ensureFreshToken(): Promise<boolean> {
+  const expires = Date.parse(getToken(ACCESS_EXPIRES_KEY) ?? '');
+  if (getToken(ACCESS_KEY) && expires - Date.now() > 30_000) return true;
+  return refreshTokens();
+}
+
+// authFetch sends the access token and retries once after refreshing it.
+async function authFetch(path: string, init: RequestInit = {}): Promise<Response> {
+  const send = () =>
+    fetch(`${API_BASE}${path}`, {
+      ...init,
+      headers: { ...init.headers, Authorization: `Bearer ${getToken(ACCESS_KEY) ?? ''}` },
+    });
+  const res = await send();
+  if (res.status === 401 && (await refreshTokens())) {
+    return send();
+  }
+  return res;
+}
+
+// APIError carries the HTTP status of a failed request.
+export class APIError extends Error {
+  constructor(
+    message: string,
+    readonly status: number,
+  ) {
+    super(message);
+  }
+}
+
+export async function login(username: string, password: string): Promise<LoginResponse> {
+  const res = await fetch(`${API_BASE}/api/auth/login`, {
+    method: 'POST',
+    headers: { 'Content-Type': 'application/json' },
+    body: JSON.stringify({ username, password }),
+  });
+  if (!res.ok) throw new APIError(`Login error: ${res.status}`, res.status);
+  const body = await res.json();
+  storeTokens(body.data as LoginResponse);
+  return body.data;
+}
+
+// fetchMe returns the signed-in user, including a pending forced password
+// reset.
+export async function fetchMe(): Promise<UserInfo> {
+  const res = await authFetch('/api/auth/me');
+  if (!res.ok) throw new Error(`API error: ${res.status}`);
+  const body = await res.json();
+  return body.data;
+}
+
+export async function changePassword(currentPassword: string, newPassword: string): Promise<void> {
+  const res = await authFetch('/api/auth/password', {
+    method: 'POST',
+    headers: { 'Content-Type': 'application/json' },
+    body: JSON.stringify({ currentPassword, newPassword }),
+  });
+  if (!res.ok) {
+    const body = await res.json().catch(() => ({}));
+    throw new Error(body.error ?? `API error: ${res.status}`);
+  }
+}
+
+export async function logout(): Promise<void> {
+  await authFetch('/api/auth/logout', { method: 'POST' }).catch(() => {});
+  storeTokens(null);
+}
 
 export async function fetchStatus(): Promise<EngineStatus> {
-  const res = await fetch(`${API_BASE}/api/status`);
+  const res = await authFetch('/api/status');
   if (!res.ok) throw new Error(`API error: ${res.status}`);
   return res.json();
 }
@@ -14,8 +151,41 @@ export async function fetchHealth(): Promise<{ data: { status: string } }> {
   return res.json();
 }
 
+export interface HistoryRange {
+  from?: string;
+  to?: string;
+  limit?: number;
+}
+
+function historyQuery(range: HistoryRange, extra: Record<string, string> = {}): string {
+  const q = new URLSearchParams(extra);
+  if (range.from) q.set('from', range.from);
+  if (range.to) q.set('to', range.to);
+  if (range.limit) q.set('limit', String(range.limit));
+  const s = q.toString();
+  return s ? `?${s}` : '';
+}
+
+// fetchTicks returns a symbol's recent ticks, oldest first.
+export async function fetchTicks(symbol: string, range: HistoryRange = {}): Promise<Tick[]> {
+  const res = await authFetch(`/api/ticks/${encodeURIComponent(symbol)}${historyQuery(range)}`);
+  if (!res.ok) throw new Error(`API error: ${res.status}`);
+  return res.json();
+}
+
+// fetchCandles returns a symbol's OHLC bars, oldest first.
+export async function fetchCandles(
+  symbol: string,
+  tf: Timeframe = 'M1',
+  range: HistoryRange = {},
+): Promise<Candle[]> {
+  const res = await authFetch(`/api/candles/${encodeURIComponent(symbol)}${historyQuery(range, { tf })}`);
+  if (!res.ok) throw new Error(`API error: ${res.status}`);
+  return res.json();
+}
+
 export async function sendCommand(cmd: Command): Promise<void> {
-  const res = await fetch(`${API_BASE}/api/command`, {
+  const res = await authFetch('/api/command', {
     method: 'POST',
     headers: { 'Content-Type': 'application/json' },
     body: JSON.stringify(cmd),
@@ -27,8 +197,12 @@ export function connectWebSocket(
   onMessage: (data: unknown) => void,
   onOpen: () => void,
   onClose: () => void,
+  topics: WSTopic[] = ['status'],
 ): WebSocket {
-  const wsUrl = API_BASE.replace(/^http/, 'ws') + '/ws';
+  const token = encodeURIComponent(getToken(ACCESS_KEY) ?? '');
+  const origin = API_BASE || window.location.origin;
+  const wsUrl =
+    origin.replace(/^http/, 'ws') + '/ws?token=' + token + '&topics=' + topics.join(',');
   const ws = new WebSocket(wsUrl);
 
   ws.onopen = onOpen;
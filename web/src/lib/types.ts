@@ -1,7 +1,7 @@
 export type Side = 'BUY' | 'SELL';
 export type GuardLevel = 'GREEN' | 'YELLOW' | 'ORANGE' | 'RED' | 'BLACK';
 export type EngineMode = 'RUNNING' | 'PAUSED' | 'FROZEN';
-export type CommandType = 'OPEN' | 'CLOSE' | 'MODIFY' | 'PAUSE' | 'RESUME' | 'HEDGE_ALL' | 'CLOSE_ALL' | 'FREEZE';
+export type CommandType = 'OPEN' | 'CLOSE' | 'MODIFY' | 'PAUSE' | 'RESUME' | 'HEDGE_ALL' | 'CLOSE_ALL' | 'FREEZE' | 'PARTIAL_CLOSE';
 
 export interface Tick {
   symbol: string;
@@ -23,6 +23,7 @@ export interface Position {
   profitLoss: number;
   swap: number;
   comment: string;
+  initialVolume: number;
 }
 
 export interface AccountState {
@@ -51,6 +52,21 @@ export interface GridState {
   createdAt: string;
 }
 
+export type Timeframe = 'M1' | 'M5' | 'M15' | 'M30' | 'H1';
+
+// Candle is an OHLC bar of bid prices; time is the bar's open time (UTC).
+// partial marks a bar that opened before the engine started or before the
+// kept M1 history begins.
+export interface Candle {
+  time: string;
+  open: number;
+  high: number;
+  low: number;
+  close: number;
+  ticks: number;
+  partial?: boolean;
+}
+
 export interface SymbolSnapshot {
   symbol: string;
   bid: number;
@@ -92,6 +108,8 @@ export interface EngineStatus {
   };
   latestTickAt: string;
   latestSymbol: string;
+  tradingStates: ScopeState[];
+  overrides: Override[];
   gridStates: GridState[];
   guardLevel: GuardLevel;
 }
@@ -101,17 +119,104 @@ export interface Command {
   symbol?: string;
   side?: Side;
   volume?: number;
+  fraction?: number;
   price?: number;
   tp?: number;
   sl?: number;
   ticket?: number;
   magic?: number;
   accountId?: string;
+  strategy?: string;
   reason?: string;
+  source?: string;
+}
+
+export type OverrideKind = 'PRESET' | 'DIRECTION' | 'DISABLE_CASCADE' | 'GUARD_LEVEL';
+
+export interface Override {
+  id: string;
+  kind: OverrideKind;
+  accountId?: string;
+  symbol?: string;
+  value?: string;
+  reason: string;
+  author: string;
+  createdAt: string;
+  expiresAt: string;
 }
 
+export interface ScopeState {
+  accountId?: string;
+  symbol?: string;
+  strategy?: string;
+  mode: EngineMode;
+  reason: string;
+  since: string;
+}
+
+export type WSTopic =
+  | 'status'
+  | 'tick'
+  | 'position'
+  | 'account'
+  | 'guard'
+  | 'command'
+  | 'signal'
+  | 'alert';
+
 export interface WSMessage {
-  type: string;
+  seq?: number; // per topic; a gap means messages were dropped
+  type: WSTopic;
   data: unknown;
   timestamp: string;
 }
+
+export interface PositionEvent {
+  action: 'OPENED' | 'UPDATED' | 'REDUCED' | 'CLOSED';
+  position: Position;
+}
+
+export interface GuardEvent {
+  accountId: string;
+  from: string;
+  to: string;
+  drawdownPct: number;
+  equity: number;
+}
+
+export interface CommandEvent {
+  status: 'APPLIED' | 'SENT' | 'FILLED' | 'REJECTED' | 'FAILED';
+  command: Command;
+}
+
+export interface Alert {
+  severity: 'INFO' | 'WARNING' | 'CRITICAL';
+  code: string;
+  message: string;
+  accountId?: string;
+  symbol?: string;
+}
+
+export type UserRole = 'ADMIN' | 'OPERATOR' | 'VIEWER';
+
+export interface DashboardUser {
+  id: string;
+  username: string;
+  role: UserRole;
+  locale: string;
+}
+
+export interface LoginResponse {
+  accessToken: string;
+  refreshToken: string;
+  accessExpiresAt: string;
+  refreshExpiresAt: string;
+  user: DashboardUser;
+}
+
+export interface UserInfo extends DashboardUser {
+  disabled: boolean;
+  mustResetPassword: boolean;
+  createdAt: string;
+  updatedAt: string;
+}